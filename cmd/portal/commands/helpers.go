@@ -1,11 +1,16 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 
+	"github.com/SpatiumPortae/portal/internal/bytesize"
+	"github.com/SpatiumPortae/portal/internal/file"
+	"github.com/SpatiumPortae/portal/internal/password"
+	"github.com/SpatiumPortae/portal/internal/relay"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/viper"
 )
@@ -15,9 +20,15 @@ const (
   - 127.0.0.1:8080
   - [::1]:8080
   - somedomain.com/relay
+  - wss://somedomain.com (always TLS)
+  - ws://somedomain.com (never TLS)
 	- ...
+Addresses without a scheme use TLS, unless the relay does not speak TLS.
 	`
-	tuiStyleFlagDesc = "Style of the tui (rich|raw)"
+	tuiStyleFlagDesc      = "Style of the tui (rich|raw)"
+	limitRateFlagDesc     = "Maximum transfer rate, such as 512KB/s or 5MB/s"
+	passwordWordsFlagDesc = "Amount of words in generated passwords"
+	wordlistFlagDesc      = "Wordlist that generated passwords are drawn from (space|large), or the path to a file with a word per line"
 )
 
 func setupLoggingFromViper(cmd string) (*os.File, error) {
@@ -31,3 +42,57 @@ func setupLoggingFromViper(cmd string) (*os.File, error) {
 	log.SetOutput(io.Discard)
 	return nil, nil
 }
+
+// relayOptionsFromViper returns the options for connecting to the configured relay.
+func relayOptionsFromViper() []relay.Option {
+	var opts []relay.Option
+	if caFile := viper.GetString("relay_ca_file"); caFile != "" {
+		opts = append(opts, relay.WithCA(caFile))
+	}
+	if pin := viper.GetString("relay_cert_pin"); pin != "" {
+		opts = append(opts, relay.WithPin(pin))
+	}
+	if token := viper.GetString("relay_token"); token != "" {
+		opts = append(opts, relay.WithToken(token))
+	}
+	return opts
+}
+
+// rateLimitFromViper returns the configured maximum transfer rate in bytes per second, or 0 without a limit.
+func rateLimitFromViper() (int64, error) {
+	limit := viper.GetString("rate_limit")
+	if limit == "" {
+		return 0, nil
+	}
+	bytesPerSecond, err := bytesize.ParseRate(limit)
+	if err != nil {
+		return 0, fmt.Errorf("parsing rate limit: %w", err)
+	}
+	return bytesPerSecond, nil
+}
+
+// unpackLimitsFromViper returns the configured limits of the files extracted from received archives.
+func unpackLimitsFromViper() (file.Limits, error) {
+	limits := file.Limits{
+		MaxRatio:     viper.GetInt64("receive_max_ratio"),
+		MinEntrySize: viper.GetInt64("receive_min_entry_size"),
+	}
+	if limits.MaxRatio < 0 || limits.MinEntrySize < 0 {
+		return file.Limits{}, errors.New("receive_max_ratio and receive_min_entry_size can not be negative, use 0 to disable the limits")
+	}
+	return limits, nil
+}
+
+// passwordGeneratorFromViper returns the generator of passwords with the configured amount of words,
+// drawn from the configured wordlist.
+func passwordGeneratorFromViper() (password.Generator, error) {
+	words := viper.GetInt("password_words")
+	if words < password.MinLength || words > password.MaxLength {
+		return password.Generator{}, fmt.Errorf("the amount of password words must be between %d and %d", password.MinLength, password.MaxLength)
+	}
+	wordlist, err := password.LoadWordlist(viper.GetString("password_wordlist"))
+	if err != nil {
+		return password.Generator{}, fmt.Errorf("loading password wordlist: %w", err)
+	}
+	return password.Generator{Words: words, Wordlist: wordlist}, nil
+}
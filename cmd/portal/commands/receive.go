@@ -12,11 +12,14 @@ import (
 
 	"github.com/SpatiumPortae/portal/cmd/portal/config"
 	receiver_tui "github.com/SpatiumPortae/portal/cmd/portal/tui/receiver"
-	"github.com/SpatiumPortae/portal/data"
 	"github.com/SpatiumPortae/portal/internal/file"
+	"github.com/SpatiumPortae/portal/internal/link"
 	"github.com/SpatiumPortae/portal/internal/password"
 	"github.com/SpatiumPortae/portal/internal/portal"
+	"github.com/SpatiumPortae/portal/internal/receiver"
 	"github.com/SpatiumPortae/portal/internal/semver"
+	"github.com/SpatiumPortae/portal/protocol/transfer"
+	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"golang.org/x/exp/slices"
@@ -26,10 +29,10 @@ import (
 
 func Receive(version string) *cobra.Command {
 	receiveCmd := &cobra.Command{
-		Use:               "receive",
-		Short:             "Receive files",
-		Long:              "The receive command receives files from the sender with the matching password.",
-		Args:              cobra.ExactArgs(1),
+		Use:               "receive [password|link]",
+		Short:             "Receive files, text, or stdin",
+		Long:              "The receive command receives files from the sender with the matching password. Text is printed, and data sent from stdin is written to stdout, or to the file named by the sender. Instead of the password, a link of the form portal://<relay>/<password> or https://<relay>/r/<password> receives from the relay of the link. With --listen, the password is instead generated by the receiver and handed to the sender.",
+		Args:              cobra.MaximumNArgs(1),
 		ValidArgsFunction: passwordCompletion,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			// Bind flags to viper.
@@ -40,6 +43,18 @@ func Receive(version string) *cobra.Command {
 			if err := viper.BindPFlag("tui_style", cmd.Flags().Lookup("tui-style")); err != nil {
 				return fmt.Errorf("binding tui-style flag: %w", err)
 			}
+			if err := viper.BindPFlag("rate_limit", cmd.Flags().Lookup("limit-rate")); err != nil {
+				return fmt.Errorf("binding limit-rate flag: %w", err)
+			}
+			if err := viper.BindPFlag("password_words", cmd.Flags().Lookup("password-words")); err != nil {
+				return fmt.Errorf("binding password-words flag: %w", err)
+			}
+			if err := viper.BindPFlag("password_wordlist", cmd.Flags().Lookup("wordlist")); err != nil {
+				return fmt.Errorf("binding wordlist flag: %w", err)
+			}
+			if err := viper.BindPFlag("receive_dir", cmd.Flags().Lookup("output-dir")); err != nil {
+				return fmt.Errorf("binding output-dir flag: %w", err)
+			}
 
 			// Reverse the --yes/-y flag value as it has an inverse relationship
 			// with the configuration value 'prompt_overwrite_files'.
@@ -63,18 +78,78 @@ func Receive(version string) *cobra.Command {
 			}
 			defer logFile.Close()
 
-			pwd := args[0]
-			if !password.IsValid(pwd) {
-				return fmt.Errorf("invalid password format")
+			stream, err := cmd.Flags().GetBool("stream")
+			if err != nil {
+				return fmt.Errorf("reading stream flag: %w", err)
+			}
+
+			listen, err := cmd.Flags().GetBool("listen")
+			if err != nil {
+				return fmt.Errorf("reading listen flag: %w", err)
+			}
+
+			output, err := cmd.Flags().GetString("output")
+			if err != nil {
+				return fmt.Errorf("reading output flag: %w", err)
+			}
+			toStdout := output == "-"
+			if output != "" && !toStdout {
+				return errors.New("only - is supported as output, which writes the payload to stdout")
+			}
+			if toStdout && stream {
+				return errors.New("the payload is always streamed when written to stdout, --stream can not be provided")
+			}
+			if toStdout && cmd.Flags().Changed("output-dir") {
+				return errors.New("the payload is written to stdout, --output-dir can not be provided")
+			}
+			outputDir, err := homedir.Expand(viper.GetString("receive_dir"))
+			if err != nil {
+				return fmt.Errorf("resolving output directory: %w", err)
+			}
+
+			var pwd string
+			switch {
+			case listen && len(args) > 0:
+				return errors.New("a password can not be provided when listening")
+			case !listen && len(args) == 0:
+				return errors.New("a password is required, or use --listen to generate one")
+			case !listen && link.IsLink(args[0]):
+				if cmd.Flags().Changed("relay") {
+					return errors.New("a relay can not be provided along with a link, the link includes the relay")
+				}
+				var relayAddr string
+				if relayAddr, pwd, err = link.Parse(args[0]); err != nil {
+					return err
+				}
+				viper.Set("relay", relayAddr)
+			case !listen:
+				pwd = args[0]
+				if !password.IsValid(pwd) {
+					return fmt.Errorf("invalid password format")
+				}
+			}
+			rateLimit, err := rateLimitFromViper()
+			if err != nil {
+				return err
+			}
+			limits, err := unpackLimitsFromViper()
+			if err != nil {
+				return err
+			}
+			var gen password.Generator
+			if listen {
+				if gen, err = passwordGeneratorFromViper(); err != nil {
+					return err
+				}
 			}
 			switch viper.GetString("tui_style") {
 			case config.StyleRich:
-				if err := handleReceiveCommand(version, pwd); err != nil {
+				if err := handleReceiveCommand(version, pwd, stream, listen, toStdout, outputDir, limits, rateLimit, gen); err != nil {
 					return fmt.Errorf("running rich receive command: %w", err)
 				}
 				return nil
 			case config.StyleRaw:
-				if err := handleReceiveCommandRaw(version, pwd); err != nil {
+				if err := handleReceiveCommandRaw(version, pwd, stream, listen, toStdout, outputDir, limits, rateLimit, gen); err != nil {
 					return fmt.Errorf("running raw receive command: %w", err)
 				}
 				return nil
@@ -86,35 +161,62 @@ func Receive(version string) *cobra.Command {
 	receiveCmd.Flags().StringP("relay", "r", "", relayFlagDesc)
 	receiveCmd.Flags().BoolP("yes", "y", false, "Overwrite existing files without [Y/n] prompts")
 	receiveCmd.Flags().StringP("tui-style", "s", "", tuiStyleFlagDesc)
+	receiveCmd.Flags().Bool("stream", false, "Unpack files while receiving them, existing files are skipped unless --yes is provided. Files are written before the payload checksum is verified, and are removed if the transfer fails")
+	receiveCmd.Flags().BoolP("listen", "l", false, "Generate a password for the sender to send files to, instead of using the password of the sender")
+	receiveCmd.Flags().StringP("output", "o", "", "Write the payload to stdout (-) while receiving it, instead of unpacking it. A single file is written as its content, other files as an uncompressed tar archive")
+	receiveCmd.Flags().String("output-dir", "", "Directory to write the received files to, created if it does not exist (default is the current directory)")
+	receiveCmd.Flags().String("limit-rate", "", limitRateFlagDesc)
+	receiveCmd.Flags().Int("password-words", 0, passwordWordsFlagDesc)
+	receiveCmd.Flags().String("wordlist", "", wordlistFlagDesc)
 	return receiveCmd
 }
 
 // ------------------------------------------------------ Handlers -----------------------------------------------------
 
 // handleReceiveCommand is the receive application.
-func handleReceiveCommand(version string, password string) error {
+func handleReceiveCommand(version string, password string, stream bool, listen bool, toStdout bool, outputDir string, limits file.Limits, rateLimit int64, gen password.Generator) error {
 	var opts []receiver_tui.Option
 	ver, err := semver.Parse(version)
 	if err == nil {
 		opts = append(opts, receiver_tui.WithVersion(ver))
 	}
+	if stream {
+		opts = append(opts, receiver_tui.WithStream())
+	}
+	if listen {
+		opts = append(opts, receiver_tui.WithListen(), receiver_tui.WithPasswordGenerator(gen))
+	}
+	if rateLimit > 0 {
+		opts = append(opts, receiver_tui.WithRateLimit(rateLimit))
+	}
+	if outputDir != "" {
+		opts = append(opts, receiver_tui.WithOutputDir(outputDir))
+	}
+	opts = append(opts, receiver_tui.WithUnpackLimits(limits))
+	// The tui is rendered on stderr when the payload is written to stdout.
+	info := os.Stdout
+	if toStdout {
+		opts = append(opts, receiver_tui.WithStdout())
+		info = os.Stderr
+	}
+	opts = append(opts, receiver_tui.WithRelayOptions(relayOptionsFromViper()...))
 	receiver := receiver_tui.New(viper.GetString("relay"), password, opts...)
 
 	if _, err := receiver.Run(); err != nil {
 		return fmt.Errorf("running receiver tui: %w", err)
 	}
-	fmt.Println("")
+	fmt.Fprintln(info, "")
 	return nil
 }
 
-func handleReceiveCommandRaw(version string, password string) error {
+func handleReceiveCommandRaw(version string, password string, stream bool, listen bool, toStdout bool, outputDir string, limits file.Limits, rateLimit int64, gen password.Generator) error {
 	ctx := context.Background()
 	relayAddr := viper.GetString("relay")
 	ver, err := semver.Parse(version)
 	if err != nil {
 		return fmt.Errorf("parsing version: %w", err)
 	}
-	serverVer, err := semver.GetRendezvousVersion(ctx, relayAddr)
+	serverVer, err := semver.GetRendezvousVersion(ctx, relayAddr, relayOptionsFromViper()...)
 	if err != nil {
 		return fmt.Errorf("fetching version from relay: %w", err)
 	}
@@ -123,34 +225,114 @@ func handleReceiveCommandRaw(version string, password string) error {
 	}
 	cnf := portal.Config{
 		RendezvousAddr: relayAddr,
+		RelayCAFile:    viper.GetString("relay_ca_file"),
+		RelayCertPin:   viper.GetString("relay_cert_pin"),
+		RelayToken:     viper.GetString("relay_token"),
+		RateLimit:      rateLimit,
+		PasswordWords:  gen.Words,
+		Wordlist:       gen.Wordlist,
 	}
-	temp, err := os.CreateTemp(os.TempDir(), file.RECEIVE_TEMP_FILE_NAME_PREFIX)
-	if err != nil {
-		return fmt.Errorf("creating temp receiver file: %w", err)
+	receive := func(ctx context.Context, w io.Writer) error {
+		return portal.Receive(ctx, w, password, &cnf)
 	}
-
-	if err := portal.Receive(ctx, temp, password, &cnf); err != nil {
-		return fmt.Errorf("receiving files: %w", err)
+	if listen {
+		password, receive, err = portal.Listen(ctx, &cnf)
+		if err != nil {
+			return fmt.Errorf("doing initial handshake: %w", err)
+		}
+		if toStdout {
+			fmt.Fprintln(os.Stderr, password)
+		} else {
+			fmt.Println(password)
+		}
 	}
-
-	if _, err := temp.Seek(0, 0); err != nil {
-		return fmt.Errorf("seeking to start of temp file: %w", err)
+	if toStdout {
+		output := receiver.NewOutput(os.Stdout)
+		err := receive(ctx, output)
+		if closeErr := output.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("receiving payload: %w", err)
+		}
+		return nil
 	}
-	unpacker, err := file.NewUnpacker(viper.GetBool("prompt_overwrite_files"), temp)
-	if err != nil {
-		return fmt.Errorf("creating unpacker: %w", err)
+	var unpacker *file.Unpacker
+	if stream {
+		// Only archives of files can be unpacked while they are received.
+		unpacker, err = file.NewStreamUnpacker(ctx, viper.GetBool("prompt_overwrite_files"), outputDir, func(ctx context.Context, w io.Writer) error {
+			return receive(ctx, receiver.ArchiveDestination{Writer: w})
+		})
+		if errors.Is(err, receiver.ErrNotArchive) {
+			return errors.New("the sender did not send files, which are the only payloads that can be received with --stream")
+		}
+		if err != nil {
+			return fmt.Errorf("receiving files: %w", err)
+		}
+	} else {
+		temp, err := os.CreateTemp(os.TempDir(), file.RECEIVE_TEMP_FILE_NAME_PREFIX)
+		if err != nil {
+			return fmt.Errorf("creating temp receiver file: %w", err)
+		}
+		defer file.RemoveTemporaryFiles(file.RECEIVE_TEMP_FILE_NAME_PREFIX)
+
+		dst := &receiver.Destination{Writer: temp}
+		if err := receive(ctx, dst); err != nil {
+			return fmt.Errorf("receiving files: %w", err)
+		}
+
+		if _, err := temp.Seek(0, 0); err != nil {
+			return fmt.Errorf("seeking to start of temp file: %w", err)
+		}
+		switch {
+		case dst.Type == transfer.TextPayload:
+			defer temp.Close()
+			return printText(temp)
+		case dst.Type == transfer.RawPayload && dst.Name == "":
+			defer temp.Close()
+			if _, err := io.Copy(os.Stdout, temp); err != nil {
+				return fmt.Errorf("writing payload to stdout: %w", err)
+			}
+			return nil
+		case dst.Type == transfer.RawPayload:
+			unpacker, err = file.NewFileUnpacker(viper.GetBool("prompt_overwrite_files"), outputDir, temp, dst.Name)
+		default:
+			unpacker, err = file.NewUnpacker(viper.GetBool("prompt_overwrite_files"), outputDir, temp)
+		}
+		if err != nil {
+			return fmt.Errorf("creating unpacker: %w", err)
+		}
+		// The entire payload has been received, the size of the temp file is the size of the payload.
+		info, err := temp.Stat()
+		if err != nil {
+			return fmt.Errorf("reading size of temp receiver file: %w", err)
+		}
+		unpacker.SetPayloadSize(info.Size())
 	}
 	defer unpacker.Close()
-	defer file.RemoveTemporaryFiles(file.RECEIVE_TEMP_FILE_NAME_PREFIX)
+	unpacker.SetLimits(limits)
+	return unpackFiles(unpacker, stream)
+}
 
+// unpackFiles unpacks and commits the files of the unpacker, prompting before overwriting existing files.
+// Existing files can not be prompted for while streaming, and are skipped instead.
+func unpackFiles(unpacker *file.Unpacker, stream bool) error {
 	input := bufio.NewReader(os.Stdin)
 	for {
 		committer, err := unpacker.Unpack()
 		switch {
 		case errors.Is(err, io.EOF):
+			// Closing a streaming unpacker waits for the transfer to complete.
+			if err := unpacker.Close(); err != nil {
+				return fmt.Errorf("receiving files: %w", err)
+			}
 			return nil
+		case errors.Is(err, file.ErrUnpackFileExists) && stream:
+			// We can not prompt while the files are streamed, existing files are skipped.
+			fmt.Printf("skipping existing file %s\n", committer.Path())
+			continue
 		case errors.Is(err, file.ErrUnpackFileExists):
-			fmt.Printf("overwrite %s? [Y/n] ", committer.FileName())
+			fmt.Printf("overwrite %s? [Y/n] ", committer.Path())
 			response, err := input.ReadString('\n')
 			if err != nil {
 				return fmt.Errorf("unable to read input from stdin: %w", err)
@@ -172,12 +354,27 @@ func handleReceiveCommandRaw(version string, password string) error {
 	}
 }
 
+// printText prints the received text to stdout, ending it with a newline.
+func printText(r io.Reader) error {
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("reading received text: %w", err)
+	}
+	if len(text) > 0 && text[len(text)-1] != '\n' {
+		text = append(text, '\n')
+	}
+	if _, err := os.Stdout.Write(text); err != nil {
+		return fmt.Errorf("printing received text: %w", err)
+	}
+	return nil
+}
+
 // ------------------------------------------------ Password Completion ------------------------------------------------
 
 func passwordCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 	components := strings.Split(toComplete, "-")
 
-	if len(components) > password.Length+1 || len(components) == 0 {
+	if len(components) > password.MaxLength+1 || len(components) == 0 {
 		return nil, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
 	}
 	if len(components) == 1 {
@@ -186,16 +383,29 @@ func passwordCompletion(cmd *cobra.Command, args []string, toComplete string) ([
 		}
 		return []string{fmt.Sprintf("%s-", components[0])}, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
 	}
+	// The flags are not bound to the config when completing, the wordlist flag takes precedence if provided.
+	name := viper.GetString("password_wordlist")
+	if flag := cmd.Flags().Lookup("wordlist"); flag != nil && flag.Changed {
+		name = flag.Value.String()
+	}
+	wordlist, err := password.LoadWordlist(name)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+	}
 	// Remove previous components of password, and filter based on prefix.
-	suggs := filterPrefix(removeElems(data.SpaceWordList, components[:len(components)-1]), components[len(components)-1])
+	suggs := filterPrefix(removeElems(wordlist, components[:len(components)-1]), components[len(components)-1])
+	words := len(components) - 1
 	var res []string
 	for _, sugg := range suggs {
 		components := append(components[:len(components)-1], sugg)
 		pw := strings.Join(components, "-")
-		if len(components) <= password.Length {
-			pw += "-"
+		// Passwords have a variable amount of words, suggest both ending the password and continuing it.
+		if words >= password.MinLength {
+			res = append(res, pw)
+		}
+		if words < password.MaxLength {
+			res = append(res, pw+"-")
 		}
-		res = append(res, pw)
 	}
 	return res, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
 }
@@ -4,25 +4,46 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/SpatiumPortae/portal/cmd/portal/config"
+	"github.com/SpatiumPortae/portal/cmd/portal/tui"
 	sender_ui "github.com/SpatiumPortae/portal/cmd/portal/tui/sender"
 	"github.com/SpatiumPortae/portal/internal/file"
+	"github.com/SpatiumPortae/portal/internal/link"
+	"github.com/SpatiumPortae/portal/internal/password"
 	"github.com/SpatiumPortae/portal/internal/portal"
 	"github.com/SpatiumPortae/portal/internal/semver"
+	"github.com/SpatiumPortae/portal/internal/sender"
+	"github.com/SpatiumPortae/portal/protocol/rendezvous"
+	"github.com/SpatiumPortae/portal/protocol/transfer"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
 )
 
 // -------------------------------------------------------- Send -------------------------------------------------------
 
 func Send(version string) *cobra.Command {
 	sendCmd := &cobra.Command{
-		Use:   "send file1 file2...",
-		Short: "Send one or more files",
-		Long:  "The send command adds one or more files to be sent. Files are archived and compressed before sending.",
-		Args:  cobra.MinimumNArgs(1),
+		Use:   "send [file1 file2...|-]",
+		Short: "Send one or more files, text, or stdin",
+		Long:  "The send command adds one or more files to be sent. Files are archived and compressed before sending. Instead of files, --text sends the provided text, which the receiver prints, and - sends the data read from stdin, which the receiver writes to stdout or to the file named by --name.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			switch {
+			case cmd.Flags().Changed("text") && len(args) > 0:
+				return errors.New("files can not be sent along with text")
+			case cmd.Flags().Changed("text"):
+				return nil
+			case len(args) == 0:
+				return errors.New("requires at least one file, - to send stdin, or --text")
+			case slices.Contains(args, "-") && len(args) > 1:
+				return errors.New("stdin can not be sent along with files")
+			}
+			return nil
+		},
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			if err := viper.BindPFlag("relay", cmd.Flags().Lookup("relay")); err != nil {
 				return fmt.Errorf("binding relay flag: %w", err)
@@ -30,12 +51,78 @@ func Send(version string) *cobra.Command {
 			if err := viper.BindPFlag("tui_style", cmd.Flags().Lookup("tui-style")); err != nil {
 				return fmt.Errorf("binding tui-style flag: %w", err)
 			}
+			if err := viper.BindPFlag("rate_limit", cmd.Flags().Lookup("limit-rate")); err != nil {
+				return fmt.Errorf("binding limit-rate flag: %w", err)
+			}
+			if err := viper.BindPFlag("password_words", cmd.Flags().Lookup("password-words")); err != nil {
+				return fmt.Errorf("binding password-words flag: %w", err)
+			}
+			if err := viper.BindPFlag("password_wordlist", cmd.Flags().Lookup("wordlist")); err != nil {
+				return fmt.Errorf("binding wordlist flag: %w", err)
+			}
 			return nil
 
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			file.RemoveTemporaryFiles(file.SEND_TEMP_FILE_NAME_PREFIX)
 
+			stream, err := cmd.Flags().GetBool("stream")
+			if err != nil {
+				return fmt.Errorf("reading stream flag: %w", err)
+			}
+			receivers, err := cmd.Flags().GetInt("receivers")
+			if err != nil {
+				return fmt.Errorf("reading receivers flag: %w", err)
+			}
+			if receivers < 1 || receivers > rendezvous.MAX_RECEIVERS {
+				return fmt.Errorf("the amount of receivers must be between 1 and %d", rendezvous.MAX_RECEIVERS)
+			}
+			if stream && receivers > 1 {
+				return errors.New("streaming is not supported when sending to multiple receivers")
+			}
+			payload, payloadSize, err := typedPayloadFromFlags(cmd, args)
+			if err != nil {
+				return err
+			}
+			if payload != nil {
+				defer file.RemoveTemporaryFiles(file.SEND_TEMP_FILE_NAME_PREFIX)
+				if stream {
+					return errors.New("streaming is only supported when sending files")
+				}
+				args = nil
+			}
+			pwd, err := cmd.Flags().GetString("password")
+			if err != nil {
+				return fmt.Errorf("reading password flag: %w", err)
+			}
+			if pwd != "" && !password.IsValid(pwd) {
+				return errors.New("invalid password format")
+			}
+			if pwd != "" && receivers > 1 {
+				return errors.New("a listening receiver can not be sent to along with other receivers")
+			}
+			rateLimit, err := rateLimitFromViper()
+			if err != nil {
+				return err
+			}
+			qr, err := cmd.Flags().GetString("qr")
+			if err != nil {
+				return fmt.Errorf("reading qr flag: %w", err)
+			}
+			qrContent, err := parseQRContent(qr)
+			if err != nil {
+				return err
+			}
+			if qrContent != sender_ui.QRHidden && pwd != "" {
+				return errors.New("a QR code can not be shown when sending to a listening receiver")
+			}
+			var gen password.Generator
+			if pwd == "" {
+				if gen, err = passwordGeneratorFromViper(); err != nil {
+					return err
+				}
+			}
+
 			logFile, err := setupLoggingFromViper("send")
 			if err != nil {
 				return err
@@ -43,11 +130,11 @@ func Send(version string) *cobra.Command {
 			defer logFile.Close()
 			switch viper.GetString("tui_style") {
 			case config.StyleRich:
-				if err := handleSendCommand(version, args); err != nil {
+				if err := handleSendCommand(version, args, payload, payloadSize, pwd, stream, receivers, rateLimit, gen, qrContent); err != nil {
 					return fmt.Errorf("running rich send command: %w", err)
 				}
 			case config.StyleRaw:
-				if err := handleSendCommandRaw(version, args); err != nil {
+				if err := handleSendCommandRaw(version, args, payload, payloadSize, pwd, stream, receivers, rateLimit, gen, qrContent); err != nil {
 					return fmt.Errorf("running raw send command: %w", err)
 				}
 			default:
@@ -58,19 +145,50 @@ func Send(version string) *cobra.Command {
 	}
 	sendCmd.Flags().StringP("relay", "r", "", relayFlagDesc)
 	sendCmd.Flags().StringP("tui-style", "s", "", tuiStyleFlagDesc)
+	sendCmd.Flags().Bool("stream", false, "Compress files while sending instead of staging the archive on disk")
+	sendCmd.Flags().IntP("receivers", "n", 1, fmt.Sprintf("Number of receivers to send the files to, at most %d", rendezvous.MAX_RECEIVERS))
+	sendCmd.Flags().StringP("password", "p", "", "Send the files to a receiver listening with the provided password")
+	sendCmd.Flags().String("limit-rate", "", limitRateFlagDesc)
+	sendCmd.Flags().Int("password-words", 0, passwordWordsFlagDesc)
+	sendCmd.Flags().String("wordlist", "", wordlistFlagDesc)
+	sendCmd.Flags().String("qr", "", "Show a QR code of the portal link (link) or of the password (password)")
+	sendCmd.Flags().Lookup("qr").NoOptDefVal = "link"
+	sendCmd.Flags().String("text", "", "Send the provided text, which the receiver prints, instead of files")
+	sendCmd.Flags().String("name", "", "File name that the receiver writes the data sent from stdin to, instead of stdout")
 	return sendCmd
 }
 
 // ------------------------------------------------------ Handlers -----------------------------------------------------
 
-// handleSendCommand is the sender application.
-func handleSendCommand(version string, fileNames []string) error {
+// handleSendCommand is the sender application. The provided typed payload is sent instead of files, unless it is nil.
+func handleSendCommand(version string, fileNames []string, payload sender.TypedPayload, payloadSize int64, password string, stream bool, receivers int, rateLimit int64, gen password.Generator, qrContent sender_ui.QRContent) error {
 	var opts []sender_ui.Option
 	ver, err := semver.Parse(version)
 	// Conditionally add option to sender ui
 	if err == nil {
 		opts = append(opts, sender_ui.WithVersion(ver))
 	}
+	if stream {
+		opts = append(opts, sender_ui.WithStream())
+	}
+	if receivers > 1 {
+		opts = append(opts, sender_ui.WithReceivers(receivers))
+	}
+	if password != "" {
+		opts = append(opts, sender_ui.WithPassword(password))
+	} else {
+		opts = append(opts, sender_ui.WithPasswordGenerator(gen))
+	}
+	if qrContent != sender_ui.QRHidden {
+		opts = append(opts, sender_ui.WithQRCode(qrContent))
+	}
+	if payload != nil {
+		opts = append(opts, sender_ui.WithPayload(payload, payloadSize))
+	}
+	if rateLimit > 0 {
+		opts = append(opts, sender_ui.WithRateLimit(rateLimit))
+	}
+	opts = append(opts, sender_ui.WithRelayOptions(relayOptionsFromViper()...))
 	relayAddr := viper.GetString("relay")
 	sender := sender_ui.New(fileNames, relayAddr, opts...)
 	if _, err := sender.Run(); err != nil {
@@ -80,14 +198,14 @@ func handleSendCommand(version string, fileNames []string) error {
 	return nil
 }
 
-func handleSendCommandRaw(version string, filenames []string) error {
+func handleSendCommandRaw(version string, filenames []string, typed sender.TypedPayload, typedSize int64, password string, stream bool, receivers int, rateLimit int64, gen password.Generator, qrContent sender_ui.QRContent) error {
 	ctx := context.Background()
 	relayAddr := viper.GetString("relay")
 	ver, err := semver.Parse(version)
 	if err != nil {
 		return fmt.Errorf("parsing version: %w", err)
 	}
-	serverVer, err := semver.GetRendezvousVersion(ctx, relayAddr)
+	serverVer, err := semver.GetRendezvousVersion(ctx, relayAddr, relayOptionsFromViper()...)
 	if err != nil {
 		return fmt.Errorf("fetching version from relay: %w", err)
 	}
@@ -103,23 +221,135 @@ func handleSendCommandRaw(version string, filenames []string) error {
 		defer f.Close()
 		files = append(files, f)
 	}
-	payload, size, err := file.PackFiles(files)
-	if err != nil {
-		return fmt.Errorf("error packing files: %w", err)
+	// Archives of a single file are named by it, so that the receiver can write the content of the file to stdout.
+	singleName, single := file.SingleFileName(files)
+	var payload io.Reader
+	var size int64
+	switch {
+	case typed != nil:
+		payload, size = typed, typedSize
+	case stream:
+		// The size of the archive is unknown, use the uncompressed size as an estimate.
+		for _, f := range files {
+			fileSize, err := file.ContentSize(f.Name())
+			if err != nil {
+				return fmt.Errorf("reading size of file %q: %w", f.Name(), err)
+			}
+			size += fileSize
+		}
+		stream := file.PackFilesStream(files)
+		defer stream.Close()
+		payload = stream
+		if single {
+			payload = sender.NewTypedStream(stream, transfer.ArchivePayload, singleName)
+		}
+	default:
+		archive, archiveSize, err := file.PackFiles(files)
+		if err != nil {
+			return fmt.Errorf("error packing files: %w", err)
+		}
+		defer file.RemoveTemporaryFiles(file.SEND_TEMP_FILE_NAME_PREFIX)
+		defer archive.Close()
+		payload, size = archive, archiveSize
+		if single {
+			payload = sender.NewTypedPayload(archive, archiveSize, transfer.ArchivePayload, singleName)
+		}
 	}
-	defer payload.Close()
-	defer file.RemoveTemporaryFiles(file.SEND_TEMP_FILE_NAME_PREFIX)
 	cnf := portal.Config{
 		RendezvousAddr: relayAddr,
+		Receivers:      receivers,
+		Password:       password,
+		RelayCAFile:    viper.GetString("relay_ca_file"),
+		RelayCertPin:   viper.GetString("relay_cert_pin"),
+		RelayToken:     viper.GetString("relay_token"),
+		RateLimit:      rateLimit,
+		PasswordWords:  gen.Words,
+		Wordlist:       gen.Wordlist,
 	}
 	password, err, errC := portal.Send(ctx, payload, size, &cnf)
 	if err != nil {
 		return fmt.Errorf("doing initial handshake: %w", err)
 	}
-	fmt.Println(password)
-	err = <-errC
+	if cnf.Password == "" {
+		fmt.Println(password)
+		if err := printQRCode(relayAddr, password, qrContent); err != nil {
+			return err
+		}
+	}
+	// The channel is closed once the transfers to all receivers are done.
+	for err := range errC {
+		if err != nil {
+			return fmt.Errorf("doing portal transfer: %w", err)
+		}
+	}
+	return nil
+}
+
+// typedPayloadFromFlags returns the text or the data read from stdin to send, along with its size. Returns
+// a nil payload if files are sent. Data read from stdin is staged in a temporary file.
+func typedPayloadFromFlags(cmd *cobra.Command, args []string) (sender.TypedPayload, int64, error) {
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading name flag: %w", err)
+	}
+	stdin := len(args) == 1 && args[0] == "-"
+	if name != "" && !stdin {
+		return nil, 0, errors.New("a name can only be provided when sending stdin")
+	}
+	if name != "" {
+		if err := file.ValidateFileName(name); err != nil {
+			return nil, 0, err
+		}
+	}
+	switch {
+	case cmd.Flags().Changed("text"):
+		text, err := cmd.Flags().GetString("text")
+		if err != nil {
+			return nil, 0, fmt.Errorf("reading text flag: %w", err)
+		}
+		return sender.NewTypedPayload(strings.NewReader(text), int64(len(text)), transfer.TextPayload, ""), int64(len(text)), nil
+	case stdin:
+		staged, size, err := file.Stage(os.Stdin)
+		if err != nil {
+			return nil, 0, fmt.Errorf("reading stdin: %w", err)
+		}
+		return sender.NewTypedPayload(staged, size, transfer.RawPayload, name), size, nil
+	default:
+		return nil, 0, nil
+	}
+}
+
+// parseQRContent parses the value of the qr flag.
+func parseQRContent(qr string) (sender_ui.QRContent, error) {
+	switch qr {
+	case "":
+		return sender_ui.QRHidden, nil
+	case "link":
+		return sender_ui.QRLink, nil
+	case "password":
+		return sender_ui.QRPassword, nil
+	default:
+		return sender_ui.QRHidden, fmt.Errorf("invalid QR code content %q, must be link or password", qr)
+	}
+}
+
+// printQRCode prints a QR code of the provided content to stdout.
+func printQRCode(relayAddr string, password string, qrContent sender_ui.QRContent) error {
+	content := password
+	switch qrContent {
+	case sender_ui.QRHidden:
+		return nil
+	case sender_ui.QRLink:
+		uri, err := link.URI(relayAddr, password)
+		if err != nil {
+			return fmt.Errorf("creating link: %w", err)
+		}
+		content = uri
+	}
+	qrCode, err := tui.QRCode(content)
 	if err != nil {
-		return fmt.Errorf("doing portal transfer: %w", err)
+		return err
 	}
+	fmt.Println(qrCode)
 	return nil
 }
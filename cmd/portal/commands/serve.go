@@ -1,8 +1,11 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
+	"os"
 
+	"github.com/SpatiumPortae/portal/internal/bytesize"
 	"github.com/SpatiumPortae/portal/internal/rendezvous"
 	"github.com/SpatiumPortae/portal/internal/semver"
 	"github.com/spf13/cobra"
@@ -13,12 +16,60 @@ func Serve(version string) *cobra.Command {
 	serveCmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Serve the relay server",
-		Long:  "The serve command serves the relay server locally.",
+		Long:  fmt.Sprintf("The serve command serves the relay server locally. The admin API is served at /admin when a token for it is provided in %s. When terminated, new transfers are refused and the transfers in progress are given until the drain timeout to finish.", rendezvous.ADMIN_TOKEN_ENV),
 		Args:  cobra.MatchAll(cobra.ExactArgs(0), cobra.NoArgs),
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			if err := viper.BindPFlag("relay_serve_port", cmd.Flags().Lookup("port")); err != nil {
 				return fmt.Errorf("binding relay-port flag: %w", err)
 			}
+			if err := viper.BindPFlag("relay_serve_tls_cert", cmd.Flags().Lookup("tls-cert")); err != nil {
+				return fmt.Errorf("binding tls-cert flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_tls_key", cmd.Flags().Lookup("tls-key")); err != nil {
+				return fmt.Errorf("binding tls-key flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_token_file", cmd.Flags().Lookup("token-file")); err != nil {
+				return fmt.Errorf("binding token-file flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_max_transfers", cmd.Flags().Lookup("max-transfers")); err != nil {
+				return fmt.Errorf("binding max-transfers flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_max_transfers_per_ip", cmd.Flags().Lookup("max-transfers-per-ip")); err != nil {
+				return fmt.Errorf("binding max-transfers-per-ip flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_max_connects_per_minute", cmd.Flags().Lookup("max-connects-per-minute")); err != nil {
+				return fmt.Errorf("binding max-connects-per-minute flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_max_relay_rate", cmd.Flags().Lookup("max-relay-rate")); err != nil {
+				return fmt.Errorf("binding max-relay-rate flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_max_session_relay_rate", cmd.Flags().Lookup("max-session-relay-rate")); err != nil {
+				return fmt.Errorf("binding max-session-relay-rate flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_max_relayed_size", cmd.Flags().Lookup("max-relayed-size")); err != nil {
+				return fmt.Errorf("binding max-relayed-size flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_drain_timeout", cmd.Flags().Lookup("drain-timeout")); err != nil {
+				return fmt.Errorf("binding drain-timeout flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_min_id", cmd.Flags().Lookup("min-id")); err != nil {
+				return fmt.Errorf("binding min-id flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_max_id", cmd.Flags().Lookup("max-id")); err != nil {
+				return fmt.Errorf("binding max-id flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_trusted_proxies", cmd.Flags().Lookup("trusted-proxies")); err != nil {
+				return fmt.Errorf("binding trusted-proxies flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_public_metrics", cmd.Flags().Lookup("public-metrics")); err != nil {
+				return fmt.Errorf("binding public-metrics flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_cluster_store", cmd.Flags().Lookup("cluster-store")); err != nil {
+				return fmt.Errorf("binding cluster-store flag: %w", err)
+			}
+			if err := viper.BindPFlag("relay_serve_cluster_addr", cmd.Flags().Lookup("cluster-addr")); err != nil {
+				return fmt.Errorf("binding cluster-addr flag: %w", err)
+			}
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -26,11 +77,88 @@ func Serve(version string) *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("server requires version to be set: %w", err)
 			}
-			server := rendezvous.NewServer(viper.GetInt("relay_serve_port"), ver)
+			var opts []rendezvous.Option
+			cert, key := viper.GetString("relay_serve_tls_cert"), viper.GetString("relay_serve_tls_key")
+			switch {
+			case cert != "" && key != "":
+				opts = append(opts, rendezvous.WithTLS(cert, key))
+			case cert != "" || key != "":
+				return errors.New("both a TLS certificate and key are required to serve using TLS")
+			}
+			tokens, err := rendezvous.LoadTokens(viper.GetString("relay_serve_token_file"))
+			if err != nil {
+				return fmt.Errorf("loading relay tokens: %w", err)
+			}
+			if len(tokens) > 0 {
+				opts = append(opts, rendezvous.WithTokens(tokens...))
+			}
+			if token := os.Getenv(rendezvous.ADMIN_TOKEN_ENV); token != "" {
+				opts = append(opts, rendezvous.WithAdminToken(token))
+			}
+			if viper.GetBool("relay_serve_public_metrics") {
+				opts = append(opts, rendezvous.WithPublicMetrics())
+			}
+			limits := rendezvous.Limits{
+				MaxMailboxes:         viper.GetInt("relay_serve_max_transfers"),
+				MaxMailboxesPerIP:    viper.GetInt("relay_serve_max_transfers_per_ip"),
+				MaxAttemptsPerMinute: viper.GetInt("relay_serve_max_connects_per_minute"),
+			}
+			for key, limit := range map[string]*int64{
+				"relay_serve_max_relay_rate":         &limits.MaxRelayRate,
+				"relay_serve_max_session_relay_rate": &limits.MaxSessionRelayRate,
+				"relay_serve_max_relayed_size":       &limits.MaxRelayedBytes,
+			} {
+				if size := viper.GetString(key); size != "" {
+					if *limit, err = bytesize.Parse(size); err != nil {
+						return fmt.Errorf("parsing %s: %w", key, err)
+					}
+				}
+			}
+			opts = append(opts, rendezvous.WithLimits(limits))
+			proxies, err := rendezvous.ParseTrustedProxies(viper.GetString("relay_serve_trusted_proxies"))
+			if err != nil {
+				return fmt.Errorf("parsing trusted proxies: %w", err)
+			}
+			opts = append(opts, rendezvous.WithTrustedProxies(proxies...))
+			storeURL, clusterAddr := viper.GetString("relay_serve_cluster_store"), viper.GetString("relay_serve_cluster_addr")
+			switch {
+			case storeURL != "" && clusterAddr != "":
+				store, err := rendezvous.NewRedisStore(storeURL)
+				if err != nil {
+					return fmt.Errorf("connecting to cluster store: %w", err)
+				}
+				defer store.Close()
+				opts = append(opts, rendezvous.WithCluster(store, clusterAddr, relayOptionsFromViper()...))
+			case storeURL != "" || clusterAddr != "":
+				return errors.New("both a cluster store and the cluster address of the relay server are required to run in a cluster")
+			}
+			minID, maxID := viper.GetInt("relay_serve_min_id"), viper.GetInt("relay_serve_max_id")
+			if minID < 1 || maxID < minID {
+				return fmt.Errorf("invalid id range %d-%d, ids must be positive and the max id at least the min id", minID, maxID)
+			}
+			opts = append(opts, rendezvous.WithIDRange(minID, maxID))
+			opts = append(opts, rendezvous.WithDrainTimeout(viper.GetDuration("relay_serve_drain_timeout")))
+			server := rendezvous.NewServer(viper.GetInt("relay_serve_port"), ver, opts...)
 			server.Start()
 			return nil
 		},
 	}
 	serveCmd.Flags().IntP("port", "p", 0, "port to run the portal relay server on")
+	serveCmd.Flags().String("tls-cert", "", "path to the TLS certificate file, serves the relay server using TLS")
+	serveCmd.Flags().String("tls-key", "", "path to the TLS private key file, serves the relay server using TLS")
+	serveCmd.Flags().String("token-file", "", fmt.Sprintf("path to a file with the tokens accepted by the relay server, one per line. Tokens can also be provided in %s", rendezvous.TOKENS_ENV))
+	serveCmd.Flags().Int("max-transfers", 0, "maximum amount of concurrent transfers on the relay server, 0 for no limit")
+	serveCmd.Flags().Int("max-transfers-per-ip", 0, "maximum amount of concurrent transfers from a single IP address, 0 for no limit")
+	serveCmd.Flags().Int("max-connects-per-minute", 0, "maximum amount of connections per minute from a single IP address, 0 for no limit")
+	serveCmd.Flags().String("max-relay-rate", "", "maximum rate of relayed traffic across all transfers, in bytes per second (e.g. 100MB)")
+	serveCmd.Flags().String("max-session-relay-rate", "", "maximum rate of relayed traffic per transfer, in bytes per second (e.g. 10MB)")
+	serveCmd.Flags().String("max-relayed-size", "", "maximum size of a relayed transfer (e.g. 5GB), larger transfers are terminated")
+	serveCmd.Flags().Duration("drain-timeout", 0, "how long to wait for transfers in progress to finish when terminated, before shutting down")
+	serveCmd.Flags().Int("min-id", 0, "smallest id prefixing the passwords of transfers")
+	serveCmd.Flags().Int("max-id", 0, "largest id prefixing the passwords of transfers, limits the amount of concurrent transfers")
+	serveCmd.Flags().Bool("public-metrics", false, fmt.Sprintf("expose the metrics without authentication, otherwise they require the admin token in %s", rendezvous.ADMIN_TOKEN_ENV))
+	serveCmd.Flags().String("cluster-store", "", "url of the redis server shared by the relay servers of a cluster (e.g. redis://10.0.0.2:6379/0)")
+	serveCmd.Flags().String("cluster-addr", "", "relay address that the other relay servers of the cluster reach this server on (e.g. wss://10.0.0.1:8080)")
+	serveCmd.Flags().String("trusted-proxies", "", "comma separated addresses or CIDR ranges of reverse proxies whose X-Forwarded-For headers are trusted")
 	return serveCmd
 }
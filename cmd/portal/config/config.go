@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/fatih/structs"
 	"github.com/mitchellh/go-homedir"
@@ -22,20 +23,55 @@ const (
 )
 
 type Config struct {
-	Relay                string `mapstructure:"relay"`
-	Verbose              bool   `mapstructure:"verbose"`
-	PromptOverwriteFiles bool   `mapstructure:"prompt_overwrite_files"`
-	RelayServePort       int    `mapstructure:"relay_serve_port"`
-	TuiStyle             string `mapstructure:"tui_style"`
+	Relay                          string        `mapstructure:"relay"`
+	RelayCAFile                    string        `mapstructure:"relay_ca_file"`
+	RelayCertPin                   string        `mapstructure:"relay_cert_pin"`
+	RelayToken                     string        `mapstructure:"relay_token"`
+	Verbose                        bool          `mapstructure:"verbose"`
+	PromptOverwriteFiles           bool          `mapstructure:"prompt_overwrite_files"`
+	ReceiveDir                     string        `mapstructure:"receive_dir"`
+	ReceiveMaxRatio                int           `mapstructure:"receive_max_ratio"`
+	ReceiveMinEntrySize            int           `mapstructure:"receive_min_entry_size"`
+	RateLimit                      string        `mapstructure:"rate_limit"`
+	PasswordWords                  int           `mapstructure:"password_words"`
+	PasswordWordlist               string        `mapstructure:"password_wordlist"`
+	RelayServePort                 int           `mapstructure:"relay_serve_port"`
+	RelayServeTLSCert              string        `mapstructure:"relay_serve_tls_cert"`
+	RelayServeTLSKey               string        `mapstructure:"relay_serve_tls_key"`
+	RelayServeTokenFile            string        `mapstructure:"relay_serve_token_file"`
+	RelayServeMaxTransfers         int           `mapstructure:"relay_serve_max_transfers"`
+	RelayServeMaxTransfersPerIP    int           `mapstructure:"relay_serve_max_transfers_per_ip"`
+	RelayServeMaxConnectsPerMinute int           `mapstructure:"relay_serve_max_connects_per_minute"`
+	RelayServeMaxRelayRate         string        `mapstructure:"relay_serve_max_relay_rate"`
+	RelayServeMaxSessionRelayRate  string        `mapstructure:"relay_serve_max_session_relay_rate"`
+	RelayServeMaxRelayedSize       string        `mapstructure:"relay_serve_max_relayed_size"`
+	RelayServeDrainTimeout         time.Duration `mapstructure:"relay_serve_drain_timeout"`
+	RelayServeMinID                int           `mapstructure:"relay_serve_min_id"`
+	RelayServeMaxID                int           `mapstructure:"relay_serve_max_id"`
+	RelayServeTrustedProxies       string        `mapstructure:"relay_serve_trusted_proxies"`
+	RelayServePublicMetrics        bool          `mapstructure:"relay_serve_public_metrics"`
+	RelayServeClusterStore         string        `mapstructure:"relay_serve_cluster_store"`
+	RelayServeClusterAddr          string        `mapstructure:"relay_serve_cluster_addr"`
+	TuiStyle                       string        `mapstructure:"tui_style"`
 }
 
 func GetDefault() Config {
 	return Config{
-		Relay:                "portal.spatiumportae.com",
-		Verbose:              false,
-		PromptOverwriteFiles: true,
-		RelayServePort:       8080,
-		TuiStyle:             StyleRich,
+		Relay:                          "portal.spatiumportae.com",
+		Verbose:                        false,
+		PromptOverwriteFiles:           true,
+		ReceiveMaxRatio:                100,
+		ReceiveMinEntrySize:            4,
+		PasswordWords:                  3,
+		PasswordWordlist:               "space",
+		RelayServePort:                 8080,
+		RelayServeMaxTransfers:         1000,
+		RelayServeMaxTransfersPerIP:    20,
+		RelayServeMaxConnectsPerMinute: 60,
+		RelayServeDrainTimeout:         10 * time.Minute,
+		RelayServeMinID:                1,
+		RelayServeMaxID:                9999,
+		TuiStyle:                       StyleRich,
 	}
 }
 
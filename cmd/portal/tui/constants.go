@@ -28,6 +28,8 @@ const (
 type KeyMap struct {
 	Quit                   key.Binding
 	CopyPassword           key.Binding
+	CopyLink               key.Binding
+	ToggleQRCode           key.Binding
 	FileListUp             key.Binding
 	FileListDown           key.Binding
 	OverwritePromptYes     key.Binding
@@ -39,6 +41,8 @@ func (k KeyMap) ShortHelp() []key.Binding {
 	return []key.Binding{
 		k.Quit,
 		k.CopyPassword,
+		k.CopyLink,
+		k.ToggleQRCode,
 		k.FileListUp,
 		k.FileListDown,
 		k.OverwritePromptYes,
@@ -52,6 +56,8 @@ func (k KeyMap) FullHelp() [][]key.Binding {
 		{
 			k.Quit,
 			k.CopyPassword,
+			k.CopyLink,
+			k.ToggleQRCode,
 			k.FileListUp,
 			k.FileListDown,
 			k.OverwritePromptYes,
@@ -77,6 +83,16 @@ var Keys = KeyMap{
 		key.WithHelp("(c)", CopyKeyHelpText),
 		key.WithDisabled(),
 	),
+	CopyLink: key.NewBinding(
+		key.WithKeys("l"),
+		key.WithHelp("(l)", CopyLinkKeyHelpText),
+		key.WithDisabled(),
+	),
+	ToggleQRCode: key.NewBinding(
+		key.WithKeys("r"),
+		key.WithHelp("(r)", QRCodeKeyHelpText),
+		key.WithDisabled(),
+	),
 	FileListUp: key.NewBinding(
 		key.WithKeys("up", "k"),
 		key.WithHelp("(↑/k)", "file summary up"),
@@ -117,3 +133,8 @@ var SuccessText = BaseStyle.Copy().Foreground(lipgloss.Color(CHECK_COLOR)).Rende
 
 var CopyKeyHelpText = BaseStyle.Render("password → clipboard")
 var CopyKeyActiveHelpText = SuccessText("✓") + HelpStyle(" password → clipboard")
+var CopyLinkKeyHelpText = BaseStyle.Render("link → clipboard")
+var CopyLinkKeyActiveHelpText = SuccessText("✓") + HelpStyle(" link → clipboard")
+var QRCodeKeyHelpText = BaseStyle.Render("show QR code")
+var QRCodePasswordKeyHelpText = BaseStyle.Render("QR code of password")
+var QRCodeHideKeyHelpText = BaseStyle.Render("hide QR code")
@@ -0,0 +1,42 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/skip2/go-qrcode"
+)
+
+// qrStyle draws the QR code light on dark regardless of the colors of the terminal.
+var qrStyle = BaseStyle.Copy().Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#000000"))
+
+// QRCode renders the provided content as a QR code of block characters, each character holding two rows of modules.
+func QRCode(content string) (string, error) {
+	qr, err := qrcode.New(content, qrcode.Low)
+	if err != nil {
+		return "", fmt.Errorf("encoding QR code: %w", err)
+	}
+	// The bitmap includes the quiet zone around the code, true for dark modules.
+	bitmap := qr.Bitmap()
+	lines := make([]string, 0, (len(bitmap)+1)/2)
+	for y := 0; y < len(bitmap); y += 2 {
+		var line strings.Builder
+		for x := range bitmap[y] {
+			top := !bitmap[y][x]
+			bottom := y+1 < len(bitmap) && !bitmap[y+1][x]
+			switch {
+			case top && bottom:
+				line.WriteRune('█')
+			case top:
+				line.WriteRune('▀')
+			case bottom:
+				line.WriteRune('▄')
+			default:
+				line.WriteRune(' ')
+			}
+		}
+		lines = append(lines, qrStyle.Render(line.String()))
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -7,19 +7,26 @@ import (
 	"io"
 	"math"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/SpatiumPortae/portal/cmd/portal/config"
 	"github.com/SpatiumPortae/portal/cmd/portal/tui"
 	"github.com/SpatiumPortae/portal/cmd/portal/tui/filetable"
 	"github.com/SpatiumPortae/portal/cmd/portal/tui/transferprogress"
 	"github.com/SpatiumPortae/portal/internal/conn"
 	"github.com/SpatiumPortae/portal/internal/file"
+	"github.com/SpatiumPortae/portal/internal/password"
 	"github.com/SpatiumPortae/portal/internal/receiver"
+	"github.com/SpatiumPortae/portal/internal/relay"
 	"github.com/SpatiumPortae/portal/internal/semver"
+	"github.com/SpatiumPortae/portal/internal/throttle"
 	"github.com/SpatiumPortae/portal/protocol/transfer"
+	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/timer"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/erikgeiser/promptkit"
@@ -41,15 +48,25 @@ const (
 
 // ------------------------------------------------------ Messages -----------------------------------------------------
 type connectMsg struct {
-	conn conn.Rendezvous
+	conn     conn.Rendezvous
+	password string
 }
 
 type payloadSizeMsg struct {
-	size int64
+	size      int64
+	estimated bool
 }
 
 type receiveDoneMsg struct {
-	temp *os.File
+	temp        *os.File
+	payloadType transfer.PayloadType
+	name        string
+}
+
+type outputDoneMsg struct{}
+
+type streamStartedMsg struct {
+	unpacker *file.Unpacker
 }
 
 type unpackDoneMsg struct{}
@@ -71,23 +88,93 @@ func WithVersion(version semver.Version) Option {
 	}
 }
 
+// WithStream makes the receiver unpack the files while they are being received.
+// Overwrite prompts are not possible while streaming, existing files are instead
+// skipped unless configured to be overwritten.
+func WithStream() Option {
+	return func(m *model) {
+		m.stream = true
+	}
+}
+
+// WithStdout makes the receiver write the payload to stdout while receiving it, instead of unpacking it,
+// see receiver.Output. The tui is rendered on stderr instead.
+func WithStdout() Option {
+	return func(m *model) {
+		m.stdout = true
+	}
+}
+
+// WithOutputDir makes the receiver unpack the files into the provided directory, instead of the
+// current working directory. The directory is created if it does not exist.
+func WithOutputDir(dir string) Option {
+	return func(m *model) {
+		m.outputDir = dir
+	}
+}
+
+// WithUnpackLimits limits the files extracted from the received archive, see file.Limits.
+func WithUnpackLimits(limits file.Limits) Option {
+	return func(m *model) {
+		m.unpackLimits = limits
+	}
+}
+
+// WithListen makes the receiver generate the password, and listen
+// for a sender using it.
+func WithListen() Option {
+	return func(m *model) {
+		m.listen = true
+	}
+}
+
+// WithPasswordGenerator makes the listening receiver generate the password using the provided generator.
+func WithPasswordGenerator(gen password.Generator) Option {
+	return func(m *model) {
+		m.passwordGen = gen
+	}
+}
+
+// WithRelayOptions configures the connections to the relay server.
+func WithRelayOptions(opts ...relay.Option) Option {
+	return func(m *model) {
+		m.relayOpts = opts
+	}
+}
+
+// WithRateLimit limits the rate at which the files are received to the provided amount of bytes per second.
+func WithRateLimit(bytesPerSecond int64) Option {
+	return func(m *model) {
+		m.ctx = throttle.WithLimit(m.ctx, bytesPerSecond)
+		m.transferProgress = transferprogress.New(transferprogress.WithRateLimit(bytesPerSecond))
+	}
+}
+
 type model struct {
 	state        tuiState
 	transferType transfer.Type
+	payloadType  transfer.PayloadType
 	password     string
+	passwordGen  password.Generator
+	stream       bool
+	stdout       bool
+	listen       bool
+	outputDir    string // absolute once the files are being unpacked
 
 	ctx  context.Context
 	msgs chan interface{}
 
 	rendezvousAddr string
+	relayOpts      []relay.Option
 
 	receivedFiles           []string
 	payloadSize             int64
 	decompressedPayloadSize int64
 	version                 *semver.Version
 
-	unpacker *file.Unpacker
-	commiter file.Committer
+	unpacker     *file.Unpacker
+	unpackLimits file.Limits
+	commiter     file.Committer
 
 	width            int
 	spinner          spinner.Model
@@ -96,6 +183,7 @@ type model struct {
 	overwritePrompt  confirmation.Model
 	help             help.Model
 	keys             tui.KeyMap
+	copyMessageTimer timer.Model
 }
 
 // New creates a new receiver program.
@@ -109,21 +197,30 @@ func New(addr string, password string, opts ...Option) *tea.Program {
 		overwritePrompt:  *confirmation.NewModel(confirmation.New("", confirmation.Undecided)),
 		help:             help.New(),
 		keys:             tui.Keys,
+		copyMessageTimer: timer.NewWithInterval(tui.TEMP_UI_MESSAGE_DURATION, 100*time.Millisecond),
 		ctx:              context.Background(),
+		unpackLimits:     file.DefaultLimits,
 	}
 	for _, opt := range opts {
 		opt(&m)
 	}
 	m.resetSpinner()
+	if m.stdout {
+		return tea.NewProgram(m, tea.WithOutput(os.Stderr))
+	}
 	return tea.NewProgram(m)
 }
 
 func (m model) Init() tea.Cmd {
 	var versionCmd tea.Cmd
 	if m.version != nil {
-		versionCmd = tui.VersionCmd(m.ctx, m.rendezvousAddr)
+		versionCmd = tui.VersionCmd(m.ctx, m.rendezvousAddr, m.relayOpts...)
 	}
-	return tea.Sequence(versionCmd, tea.Batch(m.spinner.Tick, connectCmd(m.rendezvousAddr)))
+	connect := connectCmd(m.rendezvousAddr, m.relayOpts...)
+	if m.listen {
+		connect = listenCmd(m.ctx, m.rendezvousAddr, m.passwordGen, m.relayOpts...)
+	}
+	return tea.Sequence(versionCmd, tea.Batch(m.spinner.Tick, connect))
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -148,16 +245,50 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case connectMsg:
 		message := fmt.Sprintf("Connected to Portal server (%s)", m.rendezvousAddr)
+		if m.listen {
+			m.password = msg.password
+			m.keys.CopyPassword.SetEnabled(true)
+		}
 		return m, tui.TaskCmd(message, secureCmd(m.ctx, msg.conn, m.password))
 
+	case timer.TickMsg:
+		var cmd tea.Cmd
+		m.copyMessageTimer, cmd = m.copyMessageTimer.Update(msg)
+		if m.copyMessageTimer.Running() {
+			m.keys.CopyPassword.SetHelp(m.keys.CopyPassword.Help().Key, tui.CopyKeyActiveHelpText)
+		}
+		return m, cmd
+
+	case timer.TimeoutMsg:
+		var cmd tea.Cmd
+		m.copyMessageTimer, cmd = m.copyMessageTimer.Update(msg)
+		m.keys.CopyPassword.SetHelp(m.keys.CopyPassword.Help().Key, tui.CopyKeyHelpText)
+		return m, cmd
+
 	case tui.SecureMsg:
+		m.keys.CopyPassword.SetEnabled(false)
 		message := "Established encrypted connection to sender"
+		if m.stdout {
+			return m, tui.TaskCmd(message,
+				tea.Batch(listenReceiveCmd(m.msgs), outputReceiveCmd(m.ctx, msg.Conn, m.msgs)))
+		}
+		if m.stream {
+			return m, tui.TaskCmd(message,
+				tea.Batch(listenReceiveCmd(m.msgs), streamReceiveCmd(m.ctx, msg.Conn, m.outputDir, m.msgs)))
+		}
 		return m, tui.TaskCmd(message,
 			tea.Batch(listenReceiveCmd(m.msgs), receiveCmd(m.ctx, msg.Conn, m.msgs)))
 
+	case streamStartedMsg:
+		m.unpacker = msg.unpacker
+		m.unpacker.SetLimits(m.unpackLimits)
+		m.outputDir = m.unpacker.Dir()
+		return m, m.unpackCmd()
+
 	case payloadSizeMsg:
 		m.payloadSize = msg.size
 		m.transferProgress.PayloadSize = msg.size
+		m.transferProgress.PayloadSizeEstimated = msg.estimated
 		return m, listenReceiveCmd(m.msgs)
 
 	case tui.TransferTypeMsg:
@@ -173,7 +304,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case tui.ProgressMsg:
 		cmds := []tea.Cmd{listenReceiveCmd(m.msgs)}
-		if m.state != showReceivingProgress {
+		if m.state == showEstablishing {
 			m.state = showReceivingProgress
 			m.resetSpinner()
 			m.transferProgress.StartTransfer()
@@ -187,6 +318,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case receiveDoneMsg:
 		m.state = showDecompressing
 		m.resetSpinner()
+		m.finishTransfer()
 
 		message := fmt.Sprintf("Transfer completed in %s with average transfer speed %s/s",
 			time.Since(m.transferProgress.TransferStartTime).Round(time.Millisecond).String(),
@@ -196,14 +328,48 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.fileTable.SetMaxHeight(math.MaxInt)
 		m.fileTable = m.fileTable.Finalize().(filetable.Model)
 
+		m.payloadType = msg.payloadType
 		var err error
-		m.unpacker, err = file.NewUnpacker(viper.GetBool("prompt_overwrite_files"), msg.temp)
+		switch {
+		case msg.payloadType == transfer.TextPayload,
+			msg.payloadType == transfer.RawPayload && msg.name == "":
+			// Text and unnamed data are printed rather than written to disk.
+			defer msg.temp.Close()
+			content, err := io.ReadAll(msg.temp)
+			if err != nil {
+				return m, tui.ErrorCmd(err)
+			}
+			m.state = showFinished
+			m.decompressedPayloadSize = int64(len(content))
+			return m, tui.TaskCmd(message, tea.Sequence(tea.Println(strings.TrimSuffix(string(content), "\n")), tui.QuitCmd()))
+		case msg.payloadType == transfer.RawPayload:
+			m.unpacker, err = file.NewFileUnpacker(viper.GetBool("prompt_overwrite_files"), m.outputDir, msg.temp, msg.name)
+		default:
+			m.unpacker, err = file.NewUnpacker(viper.GetBool("prompt_overwrite_files"), m.outputDir, msg.temp)
+		}
 		if err != nil {
 			return m, tui.ErrorCmd(err)
 		}
+		m.unpacker.SetLimits(m.unpackLimits)
+		// The entire payload has been received, the size of the temp file is the size of the payload.
+		info, err := msg.temp.Stat()
+		if err != nil {
+			return m, tui.ErrorCmd(err)
+		}
+		m.unpacker.SetPayloadSize(info.Size())
+		m.outputDir = m.unpacker.Dir()
 
 		return m, tui.TaskCmd(message, tea.Batch(m.spinner.Tick, m.unpackCmd()))
 
+	case outputDoneMsg:
+		m.state = showFinished
+		m.finishTransfer()
+		message := fmt.Sprintf("Transfer completed in %s with average transfer speed %s/s",
+			time.Since(m.transferProgress.TransferStartTime).Round(time.Millisecond).String(),
+			tui.ByteCountSI(m.transferProgress.TransferSpeedEstimateBps),
+		)
+		return m, tui.TaskCmd(message, tui.QuitCmd())
+
 	case commitMsg:
 		m.receivedFiles = append(m.receivedFiles, msg.name)
 		m.decompressedPayloadSize += msg.size
@@ -216,22 +382,49 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.keys.OverwritePromptYes.SetEnabled(true)
 		m.keys.OverwritePromptNo.SetEnabled(true)
 		m.keys.OverwritePromptConfirm.SetEnabled(true)
-		return m, tea.Batch(m.spinner.Tick, m.newOverwritePrompt(msg.commiter.FileName()))
+		return m, tea.Batch(m.spinner.Tick, m.newOverwritePrompt(msg.commiter.Path()))
 
 	case unpackDoneMsg:
-		m.unpacker.Close()
+		if !m.stream {
+			m.unpacker.Close()
+			m.state = showFinished
+			m.fileTable.SetFiles(m.receivedFiles)
+			return m, tui.QuitCmd()
+		}
+		// Closing a streaming unpacker waits for the transfer to complete.
+		err := m.unpacker.Close()
+		m.unpacker = nil
+		if err != nil {
+			return m, tui.ErrorCmd(err)
+		}
 		m.state = showFinished
+		m.finishTransfer()
+		message := fmt.Sprintf("Transfer completed in %s with average transfer speed %s/s",
+			time.Since(m.transferProgress.TransferStartTime).Round(time.Millisecond).String(),
+			tui.ByteCountSI(m.transferProgress.TransferSpeedEstimateBps),
+		)
+		m.fileTable.SetMaxHeight(math.MaxInt)
+		m.fileTable = m.fileTable.Finalize().(filetable.Model)
 		m.fileTable.SetFiles(m.receivedFiles)
-		return m, tui.QuitCmd()
+		return m, tui.TaskCmd(message, tui.QuitCmd())
 
 	case tui.ErrorMsg:
-		return m, tui.ErrorCmd(errors.New(msg.Error()))
+		m.closeStream()
+		return m, tui.ErrorCmd(msg)
 
 	case tea.KeyMsg:
 		var cmds []tea.Cmd
 		switch {
 		case key.Matches(msg, m.keys.Quit):
+			m.closeStream()
 			return m, tea.Quit
+		case key.Matches(msg, m.keys.CopyPassword):
+			if err := clipboard.WriteAll(m.copySenderCommand()); err != nil {
+				//lint:ignore ST1005 error string displayed in tui
+				return m, tui.ErrorCmd(errors.New("Failed to copy password to clipboard"))
+			}
+			m.copyMessageTimer.Timeout = tui.TEMP_UI_MESSAGE_DURATION
+			return m, m.copyMessageTimer.Init()
 		}
 
 		fileTableModel, fileTableCmd := m.fileTable.Update(msg)
@@ -286,6 +479,13 @@ func (m model) View() string {
 	switch m.state {
 
 	case showEstablishing:
+		if m.listen && m.password != "" {
+			return tui.PadText + tui.LogSeparator(m.width) +
+				tui.PadText + tui.InfoStyle(fmt.Sprintf("%s Listening for sender", m.spinner.View())) + "\n\n" +
+				tui.PadText + tui.InfoStyle("On the sending end, run:") + "\n" +
+				tui.PadText + tui.InfoStyle(m.copySenderCommand()) + "\n\n" +
+				tui.PadText + m.help.View(m.keys) + "\n\n"
+		}
 		return tui.PadText + tui.LogSeparator(m.width) +
 			tui.PadText + tui.InfoStyle(fmt.Sprintf("%s Establishing connection with sender", m.spinner.View())) + "\n\n" +
 			tui.PadText + m.help.View(m.keys) + "\n\n"
@@ -299,6 +499,9 @@ func (m model) View() string {
 		}
 
 		payloadSize := tui.BoldText(tui.ByteCountSI(m.payloadSize))
+		if m.transferProgress.PayloadSizeEstimated {
+			payloadSize = "~" + payloadSize
+		}
 		receivingText := fmt.Sprintf("%s Receiving objects (%s) using %s transfer", m.spinner.View(), payloadSize, transferType)
 		return tui.PadText + tui.LogSeparator(m.width) +
 			tui.PadText + tui.InfoStyle(receivingText) + "\n\n" +
@@ -316,6 +519,9 @@ func (m model) View() string {
 	case showDecompressing:
 		payloadSize := tui.BoldText(tui.ByteCountSI(m.payloadSize))
 		decompressingText := fmt.Sprintf("%s Decompressing payload (%s compressed) and writing to disk", m.spinner.View(), payloadSize)
+		if m.payloadType != transfer.ArchivePayload {
+			decompressingText = fmt.Sprintf("%s Writing payload (%s) to disk", m.spinner.View(), payloadSize)
+		}
 		return tui.PadText + tui.LogSeparator(m.width) +
 			tui.PadText + tui.InfoStyle(decompressingText) + "\n\n" +
 			tui.PadText + m.transferProgress.View() + "\n\n" +
@@ -327,6 +533,19 @@ func (m model) View() string {
 			oneOrMoreFiles += "s"
 		}
 		finishedText := fmt.Sprintf("Received %d %s (%s decompressed)", len(m.receivedFiles), oneOrMoreFiles, tui.ByteCountSI(m.decompressedPayloadSize))
+		switch {
+		case m.stdout:
+			finishedText = fmt.Sprintf("Received payload (%s) and wrote it to stdout", tui.ByteCountSI(m.payloadSize))
+		case m.payloadType == transfer.TextPayload:
+			finishedText = fmt.Sprintf("Received text (%s)", tui.ByteCountSI(m.decompressedPayloadSize))
+		case m.payloadType == transfer.RawPayload && len(m.receivedFiles) == 0:
+			finishedText = fmt.Sprintf("Received data (%s)", tui.ByteCountSI(m.decompressedPayloadSize))
+		case m.payloadType == transfer.RawPayload:
+			finishedText = fmt.Sprintf("Received %d %s (%s)", len(m.receivedFiles), oneOrMoreFiles, tui.ByteCountSI(m.decompressedPayloadSize))
+		}
+		if len(m.receivedFiles) > 0 {
+			finishedText += fmt.Sprintf(" into %s", m.outputDir)
+		}
 		return tui.PadText + tui.LogSeparator(m.width) +
 			tui.PadText + tui.InfoStyle(finishedText) + "\n\n" +
 			tui.PadText + m.transferProgress.View() + "\n\n" +
@@ -339,9 +558,9 @@ func (m model) View() string {
 
 // ------------------------------------------------------ Commands -----------------------------------------------------
 
-func connectCmd(addr string) tea.Cmd {
+func connectCmd(addr string, opts ...relay.Option) tea.Cmd {
 	return func() tea.Msg {
-		rc, err := receiver.ConnectRendezvous(addr)
+		rc, err := receiver.ConnectRendezvous(addr, opts...)
 		if err != nil {
 			return tui.ErrorMsg(err)
 		}
@@ -349,6 +568,18 @@ func connectCmd(addr string) tea.Cmd {
 	}
 }
 
+// listenCmd connects to the rendezvous server and acquires a password
+// for the sender to connect with.
+func listenCmd(ctx context.Context, addr string, gen password.Generator, opts ...relay.Option) tea.Cmd {
+	return func() tea.Msg {
+		rc, password, err := receiver.ListenRendezvous(ctx, addr, gen, opts...)
+		if err != nil {
+			return tui.ErrorMsg(err)
+		}
+		return connectMsg{conn: rc, password: password}
+	}
+}
+
 func secureCmd(ctx context.Context, rc conn.Rendezvous, password string) tea.Cmd {
 	return func() tea.Msg {
 		tc, err := receiver.SecureConnection(ctx, rc, password)
@@ -365,13 +596,47 @@ func receiveCmd(ctx context.Context, tc conn.Transfer, msgs ...chan interface{})
 		if err != nil {
 			return tui.ErrorMsg(err)
 		}
-		if err := receiver.Receive(ctx, tc, temp, msgs...); err != nil {
+		dst := &receiver.Destination{Writer: temp}
+		if err := receiver.Receive(ctx, tc, dst, msgs...); err != nil {
 			return tui.ErrorMsg(err)
 		}
 		if _, err := temp.Seek(0, 0); err != nil {
 			return tui.ErrorMsg(err)
 		}
-		return receiveDoneMsg{temp: temp}
+		return receiveDoneMsg{temp: temp, payloadType: dst.Type, name: dst.Name}
+	}
+}
+
+// outputReceiveCmd receives the payload, and writes it to stdout while it is being received.
+func outputReceiveCmd(ctx context.Context, tc conn.Transfer, msgs ...chan interface{}) tea.Cmd {
+	return func() tea.Msg {
+		output := receiver.NewOutput(os.Stdout)
+		err := receiver.Receive(ctx, tc, output, msgs...)
+		if closeErr := output.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return tui.ErrorMsg(err)
+		}
+		return outputDoneMsg{}
+	}
+}
+
+// streamReceiveCmd starts receiving the payload, and returns an unpacker
+// which unpacks the files while they are being received. Only archives of files can be streamed.
+func streamReceiveCmd(ctx context.Context, tc conn.Transfer, dir string, msgs ...chan interface{}) tea.Cmd {
+	return func() tea.Msg {
+		unpacker, err := file.NewStreamUnpacker(ctx, viper.GetBool("prompt_overwrite_files"), dir, func(ctx context.Context, w io.Writer) error {
+			return receiver.Receive(ctx, tc, receiver.ArchiveDestination{Writer: w}, msgs...)
+		})
+		if errors.Is(err, receiver.ErrNotArchive) {
+			//lint:ignore ST1005 error string displayed in tui
+			return tui.ErrorMsg(errors.New("The sender did not send files, which are the only payloads that can be received while streaming"))
+		}
+		if err != nil {
+			return tui.ErrorMsg(err)
+		}
+		return streamStartedMsg{unpacker: unpacker}
 	}
 }
 
@@ -387,15 +652,30 @@ func listenReceiveCmd(msgs chan interface{}) tea.Cmd {
 			return tui.ProgressMsg(v)
 		case int64:
 			return payloadSizeMsg{size: v}
+		case receiver.EstimatedPayloadSize:
+			return payloadSizeMsg{size: int64(v), estimated: true}
 		default:
 			return nil
 		}
 	}
 }
 
+// closeStream closes a streaming unpacker that is still receiving, which cancels
+// the transfer and removes the files unpacked from the incomplete payload.
+func (m *model) closeStream() {
+	if m.stream && m.unpacker != nil {
+		_ = m.unpacker.Close()
+		m.unpacker = nil
+	}
+}
+
 func (m *model) unpackCmd() tea.Cmd {
 	return func() tea.Msg {
 		commiter, err := m.unpacker.Unpack()
+		// We can not prompt while the files are streamed, existing files are skipped.
+		for m.stream && errors.Is(err, file.ErrUnpackFileExists) {
+			commiter, err = m.unpacker.Unpack()
+		}
 		switch {
 		case errors.Is(err, io.EOF):
 			return unpackDoneMsg{}
@@ -412,7 +692,7 @@ func (m *model) unpackCmd() tea.Cmd {
 		}
 		return commitMsg{
 			size: size,
-			name: commiter.FileName(),
+			name: commiter.Path(),
 		}
 	}
 }
@@ -429,7 +709,7 @@ func (m *model) commitCmd() tea.Cmd {
 		defer func() { m.commiter = nil }()
 		return commitMsg{
 			size: size,
-			name: m.commiter.FileName(),
+			name: m.commiter.Path(),
 		}
 	}
 }
@@ -448,6 +728,32 @@ func (m *model) newOverwritePrompt(fileName string) tea.Cmd {
 	return m.overwritePrompt.Init()
 }
 
+func (m *model) copySenderCommand() string {
+	var btuilder strings.Builder
+	btuilder.WriteString("portal send --password ")
+	btuilder.WriteString(m.password)
+
+	relayAddrKey := "relay"
+	if !config.IsDefault(relayAddrKey) {
+		btuilder.WriteRune(' ')
+		btuilder.WriteString(fmt.Sprintf("--%s", relayAddrKey))
+		btuilder.WriteRune(' ')
+		btuilder.WriteString(viper.GetString(relayAddrKey))
+	}
+	btuilder.WriteString(" <files>")
+
+	return btuilder.String()
+}
+
+// finishTransfer completes the transfer progress. If the sender only estimated
+// the payload size, the payload size is updated to the amount of received bytes.
+func (m *model) finishTransfer() {
+	if m.transferProgress.PayloadSizeEstimated {
+		m.transferProgress.FinishTransfer()
+		m.payloadSize = m.transferProgress.PayloadSize
+	}
+}
+
 func (m *model) resetSpinner() {
 	m.spinner = spinner.New()
 	m.spinner.Style = lipgloss.NewStyle().Foreground(lipgloss.Color(tui.ELEMENT_COLOR))
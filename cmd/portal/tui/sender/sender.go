@@ -14,8 +14,12 @@ import (
 	"github.com/SpatiumPortae/portal/cmd/portal/tui/transferprogress"
 	"github.com/SpatiumPortae/portal/internal/conn"
 	"github.com/SpatiumPortae/portal/internal/file"
+	"github.com/SpatiumPortae/portal/internal/link"
+	"github.com/SpatiumPortae/portal/internal/password"
+	"github.com/SpatiumPortae/portal/internal/relay"
 	"github.com/SpatiumPortae/portal/internal/semver"
 	"github.com/SpatiumPortae/portal/internal/sender"
+	"github.com/SpatiumPortae/portal/internal/throttle"
 	"github.com/SpatiumPortae/portal/protocol/transfer"
 	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/help"
@@ -44,7 +48,7 @@ const (
 
 type connectMsg struct {
 	password string
-	conn     conn.Rendezvous
+	conns    []conn.Rendezvous
 }
 
 type fileReadMsg struct {
@@ -57,8 +61,18 @@ type compressedMsg struct {
 	size    int64
 }
 
+type streamReadyMsg struct {
+	payload io.Reader
+}
+
 type transferDoneMsg struct{}
 
+// receiverMsg wraps a message concerning the transfer to one of the receivers.
+type receiverMsg struct {
+	index int
+	msg   tea.Msg
+}
+
 // ------------------------------------------------------- Model -------------------------------------------------------
 
 type Option func(m *model)
@@ -69,40 +83,143 @@ func WithVersion(version semver.Version) Option {
 	}
 }
 
+// WithStream makes the sender compress the files while sending them,
+// instead of compressing them up front.
+func WithStream() Option {
+	return func(m *model) {
+		m.stream = true
+	}
+}
+
+// WithReceivers makes the sender send the files to the provided amount of receivers.
+func WithReceivers(receivers int) Option {
+	return func(m *model) {
+		m.receivers = newReceivers(receivers)
+	}
+}
+
+// WithPassword makes the sender send the files to a receiver listening
+// with the provided password.
+func WithPassword(password string) Option {
+	return func(m *model) {
+		m.password = password
+		m.listeningReceiver = true
+	}
+}
+
+// WithRelayOptions configures the connections to the relay server.
+func WithRelayOptions(opts ...relay.Option) Option {
+	return func(m *model) {
+		m.relayOpts = opts
+	}
+}
+
+// WithPasswordGenerator makes the sender generate the password using the provided generator.
+func WithPasswordGenerator(gen password.Generator) Option {
+	return func(m *model) {
+		m.passwordGen = gen
+	}
+}
+
+// QRContent is the content of the QR code shown along with the password.
+type QRContent int
+
+const (
+	QRHidden   QRContent = iota // no QR code is shown
+	QRLink                      // the portal link of the password, including the relay
+	QRPassword                  // the password
+)
+
+// WithQRCode shows a QR code of the provided content along with the password. The QR code can be toggled
+// between the link, the password and hidden.
+func WithQRCode(content QRContent) Option {
+	return func(m *model) {
+		m.qrContent = content
+	}
+}
+
+// WithPayload makes the sender send the provided payload of the provided size, such as text, instead of files.
+func WithPayload(payload sender.TypedPayload, size int64) Option {
+	return func(m *model) {
+		m.typedPayload = payload
+		m.payload = payload
+		m.payloadSize = size
+		m.readyToSend = true
+	}
+}
+
+// WithRateLimit limits the rate at which the files are sent to the provided amount of bytes per second.
+// The limit is shared by all receivers.
+func WithRateLimit(bytesPerSecond int64) Option {
+	return func(m *model) {
+		m.rateLimit = bytesPerSecond
+	}
+}
+
+// receiverState keeps track of the transfer to a single receiver.
+type receiverState struct {
+	transferType     transfer.Type // defaults to 0 (Unknown)
+	connected        bool
+	done             bool
+	msgs             chan interface{}
+	transferProgress transferprogress.Model
+}
+
+func newReceivers(n int) []receiverState {
+	if n < 1 {
+		n = 1
+	}
+	receivers := make([]receiverState, n)
+	for i := range receivers {
+		receivers[i] = receiverState{
+			msgs:             make(chan interface{}, 10),
+			transferProgress: transferprogress.New(),
+		}
+	}
+	return receivers
+}
+
 type model struct {
-	state        tuiState      // defaults to 0 (showPassword)
-	transferType transfer.Type // defaults to 0 (Unknown)
-	readyToSend  bool
-	ctx          context.Context
+	state             tuiState // defaults to 0 (showPassword)
+	readyToSend       bool
+	stream            bool
+	listeningReceiver bool
+	rateLimit         int64
+	ctx               context.Context
 
-	msgs chan interface{}
+	receivers         []receiverState
+	transferStartTime time.Time
 
 	rendezvousAddr string
+	relayOpts      []relay.Option
 
 	password         string
+	passwordGen      password.Generator
+	qrContent        QRContent
+	qrCode           string
 	fileNames        []string
 	uncompressedSize int64
+	typedPayload     sender.TypedPayload // sent instead of files, if provided
 	payload          io.Reader
 	payloadSize      int64
 	version          *semver.Version
 
 	width            int
 	spinner          spinner.Model
-	transferProgress transferprogress.Model
 	fileTable        filetable.Model
 	help             help.Model
 	keys             tui.KeyMap
 	copyMessageTimer timer.Model
+	copiedLink       bool // whether the link rather than the password was copied last
 }
 
 // New creates a new sender program.
 func New(filenames []string, addr string, opts ...Option) *tea.Program {
 	m := model{
-		transferProgress: transferprogress.New(),
+		receivers:        newReceivers(1),
 		fileTable:        filetable.New(filetable.WithFiles(filenames)),
 		fileNames:        filenames,
 		rendezvousAddr:   addr,
-		msgs:             make(chan interface{}, 10),
 		help:             help.New(),
 		keys:             tui.Keys,
 		copyMessageTimer: timer.NewWithInterval(tui.TEMP_UI_MESSAGE_DURATION, 100*time.Millisecond),
@@ -113,16 +230,33 @@ func New(filenames []string, addr string, opts ...Option) *tea.Program {
 	for _, opt := range opts {
 		opt(&m)
 	}
+	if m.rateLimit > 0 {
+		m.ctx = throttle.WithLimit(m.ctx, m.rateLimit)
+		for i := range m.receivers {
+			m.receivers[i].transferProgress = transferprogress.New(transferprogress.WithRateLimit(m.rateLimit))
+		}
+	}
+	var programOpts []tea.ProgramOption
+	if m.typedPayload != nil {
+		m.setPayloadSize(m.payloadSize)
+		// Raw payloads are read from stdin, the keys are instead read from the terminal.
+		if m.typedPayload.PayloadType() == transfer.RawPayload {
+			programOpts = append(programOpts, tea.WithInputTTY())
+		}
+	}
 	m.resetSpinner()
-	return tea.NewProgram(m)
+	return tea.NewProgram(m, programOpts...)
 }
 
 func (m model) Init() tea.Cmd {
 	var versionCmd tea.Cmd
 	if m.version != nil {
-		versionCmd = tui.VersionCmd(m.ctx, m.rendezvousAddr)
+		versionCmd = tui.VersionCmd(m.ctx, m.rendezvousAddr, m.relayOpts...)
 	}
-	return tea.Sequence(versionCmd, tea.Batch(m.spinner.Tick, readFilesCmd(m.fileNames), connectCmd(m.ctx, m.rendezvousAddr)))
+	if m.typedPayload != nil {
+		return tea.Sequence(versionCmd, tea.Batch(m.spinner.Tick, m.connectCmd()))
+	}
+	return tea.Sequence(versionCmd, tea.Batch(m.spinner.Tick, readFilesCmd(m.fileNames), m.connectCmd()))
 }
 
 // ------------------------------------------------------- Update ------------------------------------------------------
@@ -154,12 +288,24 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if len(m.fileNames) == 1 {
 			message = fmt.Sprintf("Read %d object (%s)", len(m.fileNames), tui.ByteCountSI(msg.size))
 		}
+		if m.stream {
+			return m, tui.TaskCmd(message, streamFilesCmd(msg.files))
+		}
 		return m, tui.TaskCmd(message, compressFilesCmd(msg.files))
 
+	case streamReadyMsg:
+		// The compressed size is unknown when streaming, use the uncompressed size as an estimate.
+		m.payload = msg.payload
+		m.payloadSize = m.uncompressedSize
+		m.setPayloadSize(m.uncompressedSize)
+		m.readyToSend = true
+		m.resetSpinner()
+		return m, tui.TaskCmd("Compressing objects while sending", m.spinner.Tick)
+
 	case compressedMsg:
 		m.payload = msg.payload
 		m.payloadSize = msg.size
-		m.transferProgress.PayloadSize = msg.size
+		m.setPayloadSize(msg.size)
 		m.readyToSend = true
 		m.resetSpinner()
 		message := fmt.Sprintf("Compressed objects (%s)", tui.ByteCountSI(msg.size))
@@ -169,16 +315,33 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, tui.TaskCmd(message, m.spinner.Tick)
 
 	case connectMsg:
-		m.keys.CopyPassword.SetEnabled(true)
+		// The password of a listening receiver is already known on the receiving end.
+		m.keys.CopyPassword.SetEnabled(!m.listeningReceiver)
+		m.keys.CopyLink.SetEnabled(!m.listeningReceiver)
+		m.keys.ToggleQRCode.SetEnabled(!m.listeningReceiver)
 		m.password = msg.password
+		if err := m.renderQRCode(); err != nil {
+			return m, tui.ErrorCmd(err)
+		}
 		connectMessage := fmt.Sprintf("Connected to Portal server (%s)", m.rendezvousAddr)
-		return m, tui.TaskCmd(connectMessage, secureCmd(m.ctx, msg.conn, msg.password))
+		cmds := make([]tea.Cmd, 0, len(msg.conns))
+		for i, rc := range msg.conns {
+			cmds = append(cmds, secureCmd(m.ctx, i, rc, msg.password))
+		}
+		return m, tui.TaskCmd(connectMessage, tea.Batch(cmds...))
+
+	case receiverMsg:
+		return m.updateReceiver(msg.index, msg.msg)
 
 	case timer.TickMsg:
 		var cmd tea.Cmd
 		m.copyMessageTimer, cmd = m.copyMessageTimer.Update(msg)
 		if m.copyMessageTimer.Running() {
-			m.keys.CopyPassword.SetHelp(m.keys.CopyPassword.Help().Key, tui.CopyKeyActiveHelpText)
+			if m.copiedLink {
+				m.keys.CopyLink.SetHelp(m.keys.CopyLink.Help().Key, tui.CopyLinkKeyActiveHelpText)
+			} else {
+				m.keys.CopyPassword.SetHelp(m.keys.CopyPassword.Help().Key, tui.CopyKeyActiveHelpText)
+			}
 		}
 		return m, cmd
 
@@ -187,98 +350,162 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.state = showPassword
 		m.copyMessageTimer, cmd = m.copyMessageTimer.Update(msg)
 		m.keys.CopyPassword.SetHelp(m.keys.CopyPassword.Help().Key, tui.CopyKeyHelpText)
+		m.keys.CopyLink.SetHelp(m.keys.CopyLink.Help().Key, tui.CopyLinkKeyHelpText)
+		return m, cmd
+
+	case tui.ErrorMsg:
+		if errors.Is(msg, sender.ErrPasswordInvalidated) {
+			//lint:ignore ST1005 error string displayed in tui
+			return m, tui.ErrorCmd(errors.New("Someone tried a wrong code too many times, the password has been invalidated. Send again to get a new password"))
+		}
+		return m, tui.ErrorCmd(msg)
+
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.Quit):
+			return m, tea.Quit
+		case key.Matches(msg, m.keys.CopyPassword):
+			err := clipboard.WriteAll(m.copyReceiverCommand())
+			if err != nil {
+				return m, tui.ErrorCmd(errors.New("Failed to copy password to clipboard"))
+			} else {
+				m.copiedLink = false
+				m.copyMessageTimer.Timeout = tui.TEMP_UI_MESSAGE_DURATION
+				cmd := m.copyMessageTimer.Init()
+				return m, cmd
+			}
+		case key.Matches(msg, m.keys.CopyLink):
+			uri, err := link.URI(m.rendezvousAddr, m.password)
+			if err != nil {
+				return m, tui.ErrorCmd(fmt.Errorf("creating link: %w", err))
+			}
+			if err := clipboard.WriteAll(uri); err != nil {
+				return m, tui.ErrorCmd(errors.New("Failed to copy link to clipboard"))
+			}
+			m.copiedLink = true
+			m.copyMessageTimer.Timeout = tui.TEMP_UI_MESSAGE_DURATION
+			return m, m.copyMessageTimer.Init()
+		case key.Matches(msg, m.keys.ToggleQRCode):
+			m.qrContent = (m.qrContent + 1) % (QRPassword + 1)
+			if err := m.renderQRCode(); err != nil {
+				return m, tui.ErrorCmd(err)
+			}
+			return m, nil
+		}
+
+		fileTableModel, fileTableCmd := m.fileTable.Update(msg)
+		m.fileTable = fileTableModel.(filetable.Model)
+
+		return m, fileTableCmd
+
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		cmds := make([]tea.Cmd, 0, len(m.receivers)+1)
+		for i := range m.receivers {
+			transferProgressModel, transferProgressCmd := m.receivers[i].transferProgress.Update(msg)
+			m.receivers[i].transferProgress = transferProgressModel.(transferprogress.Model)
+			cmds = append(cmds, transferProgressCmd)
+		}
+		fileTableModel, fileTableCmd := m.fileTable.Update(msg)
+		m.fileTable = fileTableModel.(filetable.Model)
+		return m, tea.Batch(append(cmds, fileTableCmd)...)
+
+	default:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
 		return m, cmd
+	}
+}
+
+// updateReceiver handles messages concerning the transfer to the receiver with the provided index.
+func (m model) updateReceiver(i int, msg tea.Msg) (tea.Model, tea.Cmd) {
+	r := &m.receivers[i]
+	switch msg := msg.(type) {
 
 	case tui.TransferTypeMsg:
-		m.transferType = msg.Type
+		r.transferType = msg.Type
 		var message string
-		switch m.transferType {
+		switch r.transferType {
 		case transfer.Direct:
 			message = "Using direct connection to receiver"
 		case transfer.Relay:
 			message = "Using relayed connection to receiver"
 		}
-		return m, tui.TaskCmd(message, listenTransferCmd(m.msgs))
+		return m, tui.TaskCmd(m.receiverText(i, message), listenTransferCmd(i, r.msgs))
 
 	case tui.SecureMsg:
 		// In the case we are not ready to send yet we pass on the same message.
 		if !m.readyToSend {
 			return m, func() tea.Msg {
-				return msg
+				return receiverMsg{index: i, msg: msg}
 			}
 		}
+		payload := m.payload
+		if len(m.receivers) > 1 {
+			// Every receiver reads the payload independently of the others.
+			ra, ok := m.payload.(io.ReaderAt)
+			if !ok {
+				return m, tui.ErrorCmd(errors.New("Payload can not be sent to multiple receivers"))
+			}
+			payload = sender.SectionPayload(ra, m.payloadSize)
+		}
 		cmd := tea.Batch(
-			listenTransferCmd(m.msgs),
-			transferCmd(m.ctx, msg.Conn, m.payload, m.payloadSize, m.msgs))
+			listenTransferCmd(i, r.msgs),
+			transferCmd(m.ctx, i, msg.Conn, payload, m.payloadSize, r.msgs))
 		return m, cmd
 
 	case tui.TransferStateMessage:
 		var message string
 		switch msg.State {
 		case transfer.ReceiverRequestPayload:
-			m.keys.CopyPassword.SetEnabled(false)
+			r.connected = true
+			if m.all(func(r receiverState) bool { return r.connected }) {
+				m.keys.CopyPassword.SetEnabled(false)
+				m.keys.CopyLink.SetEnabled(false)
+				m.keys.ToggleQRCode.SetEnabled(false)
+			}
 			message = "Established encrypted connection to receiver"
 		}
-		return m, tui.TaskCmd(message, listenTransferCmd(m.msgs))
+		return m, tui.TaskCmd(m.receiverText(i, message), listenTransferCmd(i, r.msgs))
 
 	case tui.ProgressMsg:
-		cmds := []tea.Cmd{listenTransferCmd(m.msgs)}
+		cmds := []tea.Cmd{listenTransferCmd(i, r.msgs)}
 		if m.state != showSendingProgress {
 			m.state = showSendingProgress
+			m.transferStartTime = time.Now()
 			m.resetSpinner()
-			m.transferProgress.StartTransfer()
 			cmds = append(cmds, m.spinner.Tick)
 		}
-		transferProgressModel, transferProgressCmd := m.transferProgress.Update(msg)
-		m.transferProgress = transferProgressModel.(transferprogress.Model)
+		if r.transferProgress.TransferStartTime.IsZero() {
+			r.transferProgress.StartTransfer()
+		}
+		transferProgressModel, transferProgressCmd := r.transferProgress.Update(msg)
+		r.transferProgress = transferProgressModel.(transferprogress.Model)
 		cmds = append(cmds, transferProgressCmd)
 		return m, tea.Batch(cmds...)
 
 	case transferDoneMsg:
-		m.state = showFinished
+		r.done = true
 		message := fmt.Sprintf("Transfer completed in %s with average transfer speed %s/s",
-			time.Since(m.transferProgress.TransferStartTime).Round(time.Millisecond).String(),
-			tui.ByteCountSI(m.transferProgress.TransferSpeedEstimateBps),
+			time.Since(r.transferProgress.TransferStartTime).Round(time.Millisecond).String(),
+			tui.ByteCountSI(r.transferProgress.TransferSpeedEstimateBps),
 		)
+		if !m.all(func(r receiverState) bool { return r.done }) {
+			return m, tui.TaskCmd(m.receiverText(i, message), nil)
+		}
 
+		m.state = showFinished
 		m.fileTable = m.fileTable.Finalize().(filetable.Model)
-		return m, tui.TaskCmd(message, tui.QuitCmd())
-
-	case tui.ErrorMsg:
-		return m, tui.ErrorCmd(errors.New(msg.Error()))
-
-	case tea.KeyMsg:
-		switch {
-		case key.Matches(msg, m.keys.Quit):
-			return m, tea.Quit
-		case key.Matches(msg, m.keys.CopyPassword):
-			err := clipboard.WriteAll(m.copyReceiverCommand())
-			if err != nil {
-				return m, tui.ErrorCmd(errors.New("Failed to copy password to clipboard"))
-			} else {
-				m.copyMessageTimer.Timeout = tui.TEMP_UI_MESSAGE_DURATION
-				cmd := m.copyMessageTimer.Init()
-				return m, cmd
-			}
+		if len(m.receivers) > 1 {
+			return m, tea.Sequence(
+				tui.TaskCmd(m.receiverText(i, message), nil),
+				tui.TaskCmd(fmt.Sprintf("Transfers to %d receivers completed in %s", len(m.receivers),
+					time.Since(m.transferStartTime).Round(time.Millisecond).String()), tui.QuitCmd()))
 		}
-
-		fileTableModel, fileTableCmd := m.fileTable.Update(msg)
-		m.fileTable = fileTableModel.(filetable.Model)
-
-		return m, fileTableCmd
-
-	case tea.WindowSizeMsg:
-		m.width = msg.Width
-		transferProgressModel, transferProgressCmd := m.transferProgress.Update(msg)
-		m.transferProgress = transferProgressModel.(transferprogress.Model)
-		fileTableModel, fileTableCmd := m.fileTable.Update(msg)
-		m.fileTable = fileTableModel.(filetable.Model)
-		return m, tea.Batch(transferProgressCmd, fileTableCmd)
+		return m, tui.TaskCmd(message, tui.QuitCmd())
 
 	default:
-		var cmd tea.Cmd
-		m.spinner, cmd = m.spinner.Update(msg)
-		return m, cmd
+		return m, nil
 	}
 }
 
@@ -297,46 +524,59 @@ func (m model) View() string {
 
 	slices.Sort(m.fileNames)
 	btuilder := strings.Builder{}
-	btuilder.WriteString(fmt.Sprintf("%s %d object", readiness, len(m.fileNames)))
-	if len(m.fileNames) > 1 {
-		btuilder.WriteRune('s')
-	}
-	if m.payloadSize != 0 {
+	btuilder.WriteString(fmt.Sprintf("%s %s", readiness, m.objectsText()))
+	if m.payloadSize != 0 && !m.stream {
 		compressed := tui.BoldText(tui.ByteCountSI(m.payloadSize))
 		btuilder.WriteString(fmt.Sprintf(" (%s)", compressed))
 	}
 
-	switch m.transferType {
-	case transfer.Direct:
-		btuilder.WriteString(" using direct transfer")
-	case transfer.Relay:
-		btuilder.WriteString(" using relayed transfer")
-	case transfer.Unknown:
+	if len(m.receivers) == 1 {
+		btuilder.WriteString(transferTypeText(m.receivers[0].transferType))
+	} else {
+		btuilder.WriteString(fmt.Sprintf(" to %d receivers", len(m.receivers)))
 	}
 
 	statusText := btuilder.String()
 
 	switch m.state {
 	case showPassword:
+		receivingEndText := "On the receiving end, run:"
+		if len(m.receivers) > 1 {
+			receivingEndText = fmt.Sprintf("On each of the %d receiving ends, run:", len(m.receivers))
+		}
+		if m.listeningReceiver {
+			return tui.PadText + tui.LogSeparator(m.width) +
+				tui.PadText + tui.InfoStyle(statusText) + "\n\n" +
+				tui.PadText + tui.InfoStyle(fmt.Sprintf("Sending to receiver listening with password %s", tui.BoldText(m.password))) + "\n\n" +
+				m.fileTable.View() +
+				tui.PadText + m.help.View(m.keys) + "\n\n"
+		}
 		return tui.PadText + tui.LogSeparator(m.width) +
 			tui.PadText + tui.InfoStyle(statusText) + "\n\n" +
-			tui.PadText + tui.InfoStyle("On the receiving end, run:") + "\n" +
+			tui.PadText + tui.InfoStyle(receivingEndText) + "\n" +
 			tui.PadText + tui.InfoStyle(m.copyReceiverCommand()) + "\n\n" +
+			m.qrCodeView() +
 			m.fileTable.View() +
 			tui.PadText + m.help.View(m.keys) + "\n\n"
 
 	case showSendingProgress:
 		return tui.PadText + tui.LogSeparator(m.width) +
 			tui.PadText + tui.InfoStyle(statusText) + "\n\n" +
-			tui.PadText + m.transferProgress.View() + "\n\n" +
+			m.transferProgressView() +
 			m.fileTable.View() +
 			tui.PadText + m.help.View(m.keys) + "\n\n"
 
 	case showFinished:
 		finishedText := fmt.Sprintf("Sent %d object(s) (%s compressed)", len(m.fileNames), tui.ByteCountSI(m.payloadSize))
+		if m.stream {
+			finishedText = fmt.Sprintf("Sent %d object(s) (%s uncompressed)", len(m.fileNames), tui.ByteCountSI(m.uncompressedSize))
+		}
+		if m.typedPayload != nil {
+			finishedText = fmt.Sprintf("Sent %s (%s)", m.objectsText(), tui.ByteCountSI(m.payloadSize))
+		}
 		return tui.PadText + tui.LogSeparator(m.width) +
 			tui.PadText + tui.InfoStyle(finishedText) + "\n\n" +
-			tui.PadText + m.transferProgress.View() + "\n\n" +
+			m.transferProgressView() +
 			m.fileTable.View()
 
 	default:
@@ -346,37 +586,67 @@ func (m model) View() string {
 
 // ------------------------------------------------------ Commands -----------------------------------------------------
 
+// connectCmd returns the command that connects to the rendezvous server,
+// either as the first sender or by joining a listening receiver.
+func (m *model) connectCmd() tea.Cmd {
+	if m.listeningReceiver {
+		return joinCmd(m.ctx, m.rendezvousAddr, m.password, m.relayOpts...)
+	}
+	return connectCmd(m.ctx, m.rendezvousAddr, len(m.receivers), m.passwordGen, m.relayOpts...)
+}
+
 // connectCmd command that connects to the rendezvous server.
-func connectCmd(ctx context.Context, addr string) tea.Cmd {
+// A connection is made for every receiver.
+func connectCmd(ctx context.Context, addr string, receivers int, gen password.Generator, opts ...relay.Option) tea.Cmd {
+	return func() tea.Msg {
+		rc, password, err := sender.ConnectRendezvous(ctx, addr, receivers, gen, opts...)
+		if err != nil {
+			return tui.ErrorMsg(err)
+		}
+		conns := []conn.Rendezvous{rc}
+		for i := 1; i < receivers; i++ {
+			rc, err := sender.JoinRendezvous(ctx, addr, password, opts...)
+			if err != nil {
+				return tui.ErrorMsg(err)
+			}
+			conns = append(conns, rc)
+		}
+		return connectMsg{password: password, conns: conns}
+	}
+}
+
+// joinCmd command that connects to the rendezvous server, joining
+// the receiver listening with the provided password.
+func joinCmd(ctx context.Context, addr string, password string, opts ...relay.Option) tea.Cmd {
 	return func() tea.Msg {
-		rc, password, err := sender.ConnectRendezvous(ctx, addr)
+		rc, err := sender.JoinRendezvous(ctx, addr, password, opts...)
 		if err != nil {
 			return tui.ErrorMsg(err)
 		}
-		return connectMsg{password: password, conn: rc}
+		return connectMsg{password: password, conns: []conn.Rendezvous{rc}}
 	}
 }
 
 // secureCmd command that secures a connection for transfer.
-func secureCmd(ctx context.Context, rc conn.Rendezvous, password string) tea.Cmd {
+func secureCmd(ctx context.Context, index int, rc conn.Rendezvous, password string) tea.Cmd {
 	return func() tea.Msg {
 		tc, err := sender.SecureConnection(ctx, rc, password)
 		if err != nil {
 			return tui.ErrorMsg(err)
 		}
-		return tui.SecureMsg{Conn: tc}
+		return receiverMsg{index: index, msg: tui.SecureMsg{Conn: tc}}
 	}
 }
 
 // transferCmd command that does the transfer sequence.
 // The msgs channel is used to provide intermediate messages to the tui.
-func transferCmd(ctx context.Context, tc conn.Transfer, payload io.Reader, payloadSize int64, msgs ...chan interface{}) tea.Cmd {
+func transferCmd(ctx context.Context, index int, tc conn.Transfer, payload io.Reader, payloadSize int64, msgs ...chan interface{}) tea.Cmd {
 	return func() tea.Msg {
 		err := sender.Transfer(ctx, tc, payload, payloadSize, msgs...)
 		if err != nil {
 			return tui.ErrorMsg(err)
 		}
-		return transferDoneMsg{}
+		return receiverMsg{index: index, msg: transferDoneMsg{}}
 	}
 }
 
@@ -390,7 +660,7 @@ func readFilesCmd(paths []string) tea.Cmd {
 
 		var totalSize int64
 		for _, f := range files {
-			size, err := file.FileSize(f.Name())
+			size, err := file.ContentSize(f.Name())
 			if err != nil {
 				return tui.ErrorMsg(err)
 			}
@@ -414,22 +684,38 @@ func compressFilesCmd(files []*os.File) tea.Cmd {
 		if err != nil {
 			return tui.ErrorMsg(err)
 		}
+		// Archives of a single file are named by it, so that the receiver can write the content of the file to stdout.
+		if name, single := file.SingleFileName(files); single {
+			return compressedMsg{payload: sender.NewTypedPayload(tar, size, transfer.ArchivePayload, name), size: size}
+		}
 		return compressedMsg{payload: tar, size: size}
 	}
 }
 
+// streamFilesCmd is a command that archives and compresses the
+// provided files while they are being sent.
+func streamFilesCmd(files []*os.File) tea.Cmd {
+	return func() tea.Msg {
+		stream := file.PackFilesStream(files)
+		if name, single := file.SingleFileName(files); single {
+			return streamReadyMsg{payload: sender.NewTypedStream(stream, transfer.ArchivePayload, name)}
+		}
+		return streamReadyMsg{payload: stream}
+	}
+}
+
 // listenTransferCmd is a command that listens to the provided
-// channel and formats messages.
-func listenTransferCmd(msgs chan interface{}) tea.Cmd {
+// channel and formats messages for the receiver with the provided index.
+func listenTransferCmd(index int, msgs chan interface{}) tea.Cmd {
 	return func() tea.Msg {
 		msg := <-msgs
 		switch v := msg.(type) {
 		case transfer.Type:
-			return tui.TransferTypeMsg{Type: v}
+			return receiverMsg{index: index, msg: tui.TransferTypeMsg{Type: v}}
 		case transfer.MsgType:
-			return tui.TransferStateMessage{State: v}
+			return receiverMsg{index: index, msg: tui.TransferStateMessage{State: v}}
 		case int:
-			return tui.ProgressMsg(v)
+			return receiverMsg{index: index, msg: tui.ProgressMsg(v)}
 		default:
 			return nil
 		}
@@ -451,6 +737,114 @@ func (m *model) resetSpinner() {
 	}
 }
 
+// objectsText describes what is sent, either the amount of objects or the content of the typed payload.
+func (m *model) objectsText() string {
+	if m.typedPayload != nil {
+		switch {
+		case m.typedPayload.PayloadType() == transfer.TextPayload:
+			return "text"
+		case m.typedPayload.PayloadName() != "":
+			return fmt.Sprintf("stdin as %s", m.typedPayload.PayloadName())
+		default:
+			return "stdin"
+		}
+	}
+	if len(m.fileNames) == 1 {
+		return "1 object"
+	}
+	return fmt.Sprintf("%d objects", len(m.fileNames))
+}
+
+func (m *model) setPayloadSize(size int64) {
+	for i := range m.receivers {
+		m.receivers[i].transferProgress.PayloadSize = size
+	}
+}
+
+// all reports whether the provided predicate holds for all receivers.
+func (m *model) all(f func(r receiverState) bool) bool {
+	for _, r := range m.receivers {
+		if !f(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// receiverText prefixes the provided text with the receiver it concerns,
+// in the case of multiple receivers.
+func (m *model) receiverText(i int, text string) string {
+	if len(m.receivers) == 1 {
+		return text
+	}
+	return fmt.Sprintf("Receiver %d: %s", i+1, text)
+}
+
+func (m *model) transferProgressView() string {
+	if len(m.receivers) == 1 {
+		return tui.PadText + m.receivers[0].transferProgress.View() + "\n\n"
+	}
+	var btuilder strings.Builder
+	for i, r := range m.receivers {
+		btuilder.WriteString(tui.PadText + tui.InfoStyle(m.receiverText(i, "sending"+transferTypeText(r.transferType))) + "\n")
+		btuilder.WriteString(tui.PadText + r.transferProgress.View() + "\n\n")
+	}
+	return btuilder.String()
+}
+
+func transferTypeText(transferType transfer.Type) string {
+	switch transferType {
+	case transfer.Direct:
+		return " using direct transfer"
+	case transfer.Relay:
+		return " using relayed transfer"
+	default:
+		return ""
+	}
+}
+
+// renderQRCode renders the QR code of the selected content, and updates the help of the key toggling it.
+func (m *model) renderQRCode() error {
+	help := map[QRContent]string{
+		QRHidden:   tui.QRCodeKeyHelpText,
+		QRLink:     tui.QRCodePasswordKeyHelpText,
+		QRPassword: tui.QRCodeHideKeyHelpText,
+	}
+	m.keys.ToggleQRCode.SetHelp(m.keys.ToggleQRCode.Help().Key, help[m.qrContent])
+
+	m.qrCode = ""
+	content := m.password
+	switch m.qrContent {
+	case QRHidden:
+		return nil
+	case QRLink:
+		uri, err := link.URI(m.rendezvousAddr, m.password)
+		if err != nil {
+			return fmt.Errorf("creating link: %w", err)
+		}
+		content = uri
+	}
+	qrCode, err := tui.QRCode(content)
+	if err != nil {
+		return err
+	}
+	m.qrCode = qrCode
+	return nil
+}
+
+// qrCodeView returns the view of the QR code, if shown.
+func (m *model) qrCodeView() string {
+	if m.qrCode == "" {
+		return ""
+	}
+	var builder strings.Builder
+	for _, line := range strings.Split(m.qrCode, "\n") {
+		builder.WriteString(tui.PadText + line + "\n")
+	}
+	builder.WriteString("\n")
+	return builder.String()
+}
+
 func (m *model) copyReceiverCommand() string {
 	var btuilder strings.Builder
 	btuilder.WriteString("portal receive ")
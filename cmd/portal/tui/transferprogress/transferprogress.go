@@ -18,9 +18,11 @@ type Model struct {
 	Width int
 
 	PayloadSize                int64
+	PayloadSizeEstimated       bool // the payload size is an estimate, no remaining duration is shown
 	bytesTransferred           int64
 	TransferStartTime          time.Time
 	TransferSpeedEstimateBps   int64
+	RateLimitBps               int64 // maximum transfer speed, 0 without a limit
 	estimatedRemainingDuration time.Duration
 
 	progress    float64
@@ -31,6 +33,22 @@ func (m *Model) StartTransfer() {
 	m.TransferStartTime = time.Now()
 }
 
+// FinishTransfer marks the transfer as completed, which is needed
+// when the payload size is an estimate.
+func (m *Model) FinishTransfer() {
+	m.PayloadSize = m.bytesTransferred
+	m.PayloadSizeEstimated = false
+	m.estimatedRemainingDuration = 0
+	m.progress = 1.0
+}
+
+// WithRateLimit shows the provided maximum transfer speed alongside the current speed.
+func WithRateLimit(bytesPerSecond int64) Option {
+	return func(m *Model) {
+		m.RateLimitBps = bytesPerSecond
+	}
+}
+
 func New(opts ...Option) Model {
 	m := Model{
 		progressBar: tui.NewProgressBar(),
@@ -49,15 +67,22 @@ func (Model) Init() tea.Cmd {
 func (m Model) View() string {
 	bytesProgress := strings.Builder{}
 	bytesProgress.WriteRune('(')
-	bytesProgress.WriteString(fmt.Sprintf("%s/%s", tui.ByteCountSI(m.bytesTransferred), tui.ByteCountSI(m.PayloadSize)))
+	if m.PayloadSizeEstimated {
+		bytesProgress.WriteString(fmt.Sprintf("%s/~%s", tui.ByteCountSI(m.bytesTransferred), tui.ByteCountSI(m.PayloadSize)))
+	} else {
+		bytesProgress.WriteString(fmt.Sprintf("%s/%s", tui.ByteCountSI(m.bytesTransferred), tui.ByteCountSI(m.PayloadSize)))
+	}
 	if m.TransferSpeedEstimateBps > 0 {
 		bytesProgress.WriteString(fmt.Sprintf(", %s/s", tui.ByteCountSI(m.TransferSpeedEstimateBps)))
 	}
+	if m.RateLimitBps > 0 {
+		bytesProgress.WriteString(fmt.Sprintf(", max %s/s", tui.ByteCountSI(m.RateLimitBps)))
+	}
 	bytesProgress.WriteRune(')')
 
 	secondsRemaining := m.estimatedRemainingDuration.Round(time.Second)
 	var eta string
-	if secondsRemaining > 0 {
+	if secondsRemaining > 0 && !m.PayloadSizeEstimated {
 		eta = fmt.Sprintf("%v remaining", secondsRemaining.String())
 	}
 	progressBar := m.progressBar.ViewAs(m.progress)
@@ -2,6 +2,7 @@ package tui
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"sort"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/SpatiumPortae/portal/internal/conn"
+	"github.com/SpatiumPortae/portal/internal/relay"
 	"github.com/SpatiumPortae/portal/internal/semver"
 	"github.com/SpatiumPortae/portal/protocol/transfer"
 	"github.com/charmbracelet/bubbles/spinner"
@@ -123,9 +125,9 @@ func QuitCmd() tea.Cmd {
 	}
 }
 
-func VersionCmd(ctx context.Context, rendezvousAddr string) tea.Cmd {
+func VersionCmd(ctx context.Context, rendezvousAddr string, opts ...relay.Option) tea.Cmd {
 	return func() tea.Msg {
-		ver, err := semver.GetRendezvousVersion(ctx, rendezvousAddr)
+		ver, err := semver.GetRendezvousVersion(ctx, rendezvousAddr, opts...)
 		if err != nil {
 			return ErrorMsg(err)
 		}
@@ -136,5 +138,10 @@ func VersionCmd(ctx context.Context, rendezvousAddr string) tea.Cmd {
 }
 
 func ErrorCmd(err error) tea.Cmd {
+	var pinErr relay.PinError
+	if errors.As(err, &pinErr) {
+		//lint:ignore ST1005 error string displayed in tui
+		err = fmt.Errorf("Relay %s presented a certificate with fingerprint %x, which does not match the pinned fingerprint %x. Refusing to connect", pinErr.Host, pinErr.Got, pinErr.Expected)
+	}
 	return TaskCmd(ErrorText(err.Error()), QuitCmd())
 }
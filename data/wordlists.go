@@ -0,0 +1,13 @@
+package data
+
+import (
+	_ "embed"
+	"strings"
+)
+
+//go:embed eff_large_wordlist.txt
+var effLargeWordList string
+
+// LargeWordList is EFF's long wordlist for random passphrases, excluding the words containing hyphens.
+// See https://www.eff.org/deeplinks/2016/07/new-wordlists-random-passphrases.
+var LargeWordList = strings.Fields(effLargeWordList)
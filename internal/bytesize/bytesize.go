@@ -0,0 +1,61 @@
+// Package bytesize parses human readable amounts of bytes.
+package bytesize
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var units = map[string]float64{
+	"":    1,
+	"B":   1,
+	"K":   1e3,
+	"KB":  1e3,
+	"M":   1e6,
+	"MB":  1e6,
+	"G":   1e9,
+	"GB":  1e9,
+	"T":   1e12,
+	"TB":  1e12,
+	"KIB": 1 << 10,
+	"MIB": 1 << 20,
+	"GIB": 1 << 30,
+	"TIB": 1 << 40,
+}
+
+// Parse parses the provided amount of bytes, such as "512", "1.5MB" or "10 MiB". Units are case insensitive,
+// and SI units (kB, MB, ...) are powers of 1000, while IEC units (KiB, MiB, ...) are powers of 1024.
+func Parse(s string) (int64, error) {
+	trimmed := strings.TrimSpace(s)
+	i := strings.IndexFunc(trimmed, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(trimmed)
+	}
+	number, unit := trimmed[:i], strings.ToUpper(strings.TrimSpace(trimmed[i:]))
+	multiplier, ok := units[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid unit %q in amount of bytes %q", unit, s)
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount of bytes %q", s)
+	}
+	bytes := value * multiplier
+	if bytes > math.MaxInt64 {
+		return 0, fmt.Errorf("amount of bytes %q is too large", s)
+	}
+	return int64(bytes), nil
+}
+
+// ParseRate parses the provided amount of bytes per second, such as "512KB/s" or "5MB". The "/s" suffix is optional.
+func ParseRate(s string) (int64, error) {
+	trimmed := strings.TrimSpace(s)
+	if strings.HasSuffix(strings.ToLower(trimmed), "/s") {
+		trimmed = trimmed[:len(trimmed)-len("/s")]
+	}
+	return Parse(trimmed)
+}
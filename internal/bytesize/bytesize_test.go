@@ -0,0 +1,62 @@
+package bytesize_test
+
+import (
+	"testing"
+
+	"github.com/SpatiumPortae/portal/internal/bytesize"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in  string
+		out int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"10k", 10000},
+		{"10KB", 10000},
+		{"1.5MB", 1500000},
+		{"10 MiB", 10 << 20},
+		{"2gib", 2 << 30},
+		{" 1TB ", 1e12},
+	}
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			out, err := bytesize.Parse(tc.in)
+			require.NoError(t, err)
+			assert.Equal(t, tc.out, out)
+		})
+	}
+
+	for _, in := range []string{"", "MB", "-1MB", "10 parsecs", "1.2.3", "1e30TB"} {
+		_, err := bytesize.Parse(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in  string
+		out int64
+	}{
+		{"512", 512},
+		{"5MB/s", 5000000},
+		{"5MB", 5000000},
+		{"10 KiB/S", 10 << 10},
+	}
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			out, err := bytesize.ParseRate(tc.in)
+			require.NoError(t, err)
+			assert.Equal(t, tc.out, out)
+		})
+	}
+
+	for _, in := range []string{"/s", "5MB/h", "fast"} {
+		_, err := bytesize.ParseRate(in)
+		assert.Error(t, err, in)
+	}
+}
@@ -3,10 +3,12 @@ package conn
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"math"
 
 	"github.com/SpatiumPortae/portal/protocol/rendezvous"
 	"github.com/SpatiumPortae/portal/protocol/transfer"
+	"golang.org/x/exp/slices"
 	"nhooyr.io/websocket"
 )
 
@@ -37,6 +39,10 @@ func (ws *WS) Write(ctx context.Context, payload []byte) error {
 	return ws.Conn.Write(ctx, websocket.MessageBinary, payload)
 }
 
+func (ws *WS) Close() error {
+	return ws.Conn.Close(websocket.StatusNormalClosure, "")
+}
+
 // ------------------ Rendezvous Conn ------------------------
 
 // Rendezvous specifies a connection to the rendezvous server.
@@ -44,6 +50,14 @@ type Rendezvous struct {
 	Conn Conn
 }
 
+// Close closes the underlying connection, if it can be closed.
+func (r Rendezvous) Close() error {
+	if c, ok := r.Conn.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
 // ReadRaw reads raw bytes from the underlying connection.
 func (r Rendezvous) ReadRaw(ctx context.Context) ([]byte, error) {
 	b, err := r.Conn.Read(ctx)
@@ -69,7 +83,10 @@ func (r Rendezvous) ReadMsg(ctx context.Context, expected ...rendezvous.MsgType)
 	if err := json.Unmarshal(b, &msg); err != nil {
 		return rendezvous.Msg{}, err
 	}
-	if len(expected) != 0 && expected[0] != msg.Type {
+	if msg.Type == rendezvous.RendezvousToClientError && !slices.Contains(expected, msg.Type) {
+		return rendezvous.Msg{}, rendezvous.RejectedError{Reason: msg.Payload.Error}
+	}
+	if len(expected) != 0 && !slices.Contains(expected, msg.Type) {
 		return rendezvous.Msg{}, rendezvous.Error{Expected: expected, Got: msg.Type}
 	}
 	return msg, nil
@@ -120,7 +137,16 @@ func (t Transfer) ReadRaw(ctx context.Context) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return t.crypt.Decrypt(b)
+	dec, err := t.crypt.Decrypt(b)
+	if err != nil {
+		// A relayed connection can be terminated by the rendezvous server, which communicates the reason unencrypted.
+		var msg rendezvous.Msg
+		if json.Unmarshal(b, &msg) == nil && msg.Type == rendezvous.RendezvousToClientError {
+			return nil, rendezvous.RejectedError{Reason: msg.Payload.Error}
+		}
+		return nil, err
+	}
+	return dec, nil
 }
 
 // WriteRaw encrypts and writes the raw bytes to the underlying connection.
@@ -143,7 +169,7 @@ func (t Transfer) ReadMsg(ctx context.Context, expected ...transfer.MsgType) (tr
 		return transfer.Msg{}, err
 	}
 
-	if len(expected) != 0 && expected[0] != msg.Type {
+	if len(expected) != 0 && !slices.Contains(expected, msg.Type) {
 		return transfer.Msg{}, transfer.Error{Expected: expected, Got: msg.Type}
 	}
 	return msg, nil
@@ -42,6 +42,21 @@ func TestConn(t *testing.T) {
 		assert.Equal(t, msg.Type, rendezvous.SenderToRendezvousEstablish)
 	})
 
+	t.Run("rejected rendezvous conn", func(t *testing.T) {
+		r1 := conn.Rendezvous{Conn: conn1}
+		r2 := conn.Rendezvous{Conn: conn2}
+
+		ctx := context.Background()
+		err := r1.WriteMsg(ctx, rendezvous.Msg{
+			Type:    rendezvous.RendezvousToClientError,
+			Payload: rendezvous.Payload{Error: "too many connections"},
+		})
+		assert.NoError(t, err)
+
+		_, err = r2.ReadMsg(ctx, rendezvous.RendezvousToSenderBind)
+		assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: "too many connections"})
+	})
+
 	t.Run("transfer conn", func(t *testing.T) {
 		sessionkey := []byte("sssshh... very secret secret")
 		salt := make([]byte, 8)
@@ -59,4 +74,24 @@ func TestConn(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, msg.Type, transfer.ReceiverHandshake)
 	})
+
+	t.Run("terminated transfer conn", func(t *testing.T) {
+		sessionkey := []byte("sssshh... very secret secret")
+		salt := make([]byte, 8)
+		_, err := rand.Read(salt)
+		assert.NoError(t, err)
+
+		ctx := context.Background()
+		r1 := conn.Rendezvous{Conn: conn1}
+		t2 := conn.TransferFromSession(&conn2, sessionkey, salt)
+
+		err = r1.WriteMsg(ctx, rendezvous.Msg{
+			Type:    rendezvous.RendezvousToClientError,
+			Payload: rendezvous.Payload{Error: "transfer too large"},
+		})
+		assert.NoError(t, err)
+
+		_, err = t2.ReadMsg(ctx)
+		assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: "transfer too large"})
+	})
 }
@@ -3,12 +3,16 @@ package file
 import (
 	"archive/tar"
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/klauspost/pgzip"
 )
@@ -43,7 +47,7 @@ func PackFiles(files []*os.File) (*os.File, int64, error) {
 	tw := tar.NewWriter(gw)
 
 	for _, file := range files {
-		err := addToTarArchive(tw, file)
+		err := addToTarArchive(tw, file, io.Discard)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -63,50 +67,280 @@ func PackFiles(files []*os.File) (*os.File, int64, error) {
 	return tempFile, fileInfo.Size(), nil
 }
 
+// SingleFileName returns the name of the file in the archive of the provided files, if the archive only
+// contains a single regular file.
+func SingleFileName(files []*os.File) (string, bool) {
+	if len(files) != 1 {
+		return "", false
+	}
+	fi, err := files[0].Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return "", false
+	}
+	return filepath.Base(files[0].Name()), true
+}
+
+// Stage copies the provided reader into a temporary file, returning it along with its size. Payloads that
+// can only be read once, such as stdin, are staged so that they can be resumed and sent to multiple receivers.
+func Stage(r io.Reader) (*os.File, int64, error) {
+	tempFile, err := os.CreateTemp(os.TempDir(), SEND_TEMP_FILE_NAME_PREFIX)
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := io.Copy(tempFile, r)
+	if err != nil {
+		tempFile.Close()
+		return nil, 0, err
+	}
+	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+		tempFile.Close()
+		return nil, 0, err
+	}
+	return tempFile, size, nil
+}
+
+// Stream is a compressed tar archive that is packed on the fly while it is being read.
+type Stream struct {
+	r      *io.PipeReader
+	packed byteCounter
+}
+
+// PackFilesStream tars and gzip-compresses files while the returned stream is being read,
+// without staging the archive on disk. The size of the archive is not known up front, the
+// progress of the stream can be tracked by the amount of uncompressed bytes that has been packed.
+func PackFilesStream(files []*os.File) *Stream {
+	pr, pw := io.Pipe()
+	s := &Stream{r: pr}
+	go func() {
+		gw := pgzip.NewWriter(pw)
+		tw := tar.NewWriter(gw)
+		for _, file := range files {
+			if err := addToTarArchive(tw, file, &s.packed); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		if err := tw.Close(); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(gw.Close())
+	}()
+	return s
+}
+
+// Read reads compressed bytes from the archive.
+func (s *Stream) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+// Close closes the stream, aborting the packing of files.
+func (s *Stream) Close() error {
+	return s.r.Close()
+}
+
+// Progress returns the amount of uncompressed bytes that has been packed into the stream.
+func (s *Stream) Progress() int64 {
+	return s.packed.Load()
+}
+
 // ---------------------------------------------------- Unpack Files ---------------------------------------------------
 
 var ErrUnpackNoHeader = errors.New("no header in tar archive")
 var ErrUnpackFileExists = errors.New("file exists")
 var ErrUninitialized = errors.New("unpacker is uninitialized")
+var ErrUnpackAborted = errors.New("unpacking aborted")
+var ErrInvalidFileName = errors.New("invalid file name")
+var ErrUnpackPathTraversal = errors.New("file outside of the output directory")
+var ErrUnpackLink = errors.New("links are not supported")
+var ErrUnpackTooLarge = errors.New("extracted files exceed the size limit")
+var ErrUnpackTooManyEntries = errors.New("archive exceeds the entry limit")
+
+const (
+	DEFAULT_UNPACK_MAX_RATIO      = 100
+	DEFAULT_UNPACK_MIN_ENTRY_SIZE = 4
+
+	// MIN_UNPACK_SIZE and MIN_UNPACK_ENTRIES are always allowed to be extracted, regardless of the payload size,
+	// so that small payloads of highly compressible files are not mistaken for archive bombs.
+	MIN_UNPACK_SIZE    = 64 << 20
+	MIN_UNPACK_ENTRIES = 1000
+)
+
+// Limits limits the files extracted by an unpacker relative to the size of the payload, protecting against
+// archives that expand far beyond their size, so called archive bombs, exhausting the disk or its inodes.
+// The size of the payload is the size set using Unpacker.SetPayloadSize, or the amount of payload bytes read
+// so far if larger. A zero value disables the respective limit.
+type Limits struct {
+	// MaxRatio is the maximum ratio between the total size of the extracted files and the size of the payload.
+	MaxRatio int64
+	// MinEntrySize is the minimum amount of payload bytes per entry in the archive.
+	MinEntrySize int64
+}
+
+// DefaultLimits are the limits of unpackers, unless configured otherwise.
+var DefaultLimits = Limits{MaxRatio: DEFAULT_UNPACK_MAX_RATIO, MinEntrySize: DEFAULT_UNPACK_MIN_ENTRY_SIZE}
 
 // Unpacker defines an encapsulated unit for unpacking a compressed
-// tar archive
+// tar archive. Entries resolving outside of the output directory and
+// links are rejected, and the extracted files are bounded by the limits
+// of the unpacker.
 type Unpacker struct {
-	prompt bool // prompt defines whether we should prompt the user to overwrite files
-	cwd    string
+	prompt   bool   // prompt defines whether we should prompt the user to overwrite files
+	dir      string // dir defines the absolute path of the directory that the files are unpacked into
+	finished bool   // finished defines whether the entire archive has been unpacked
+	name     string // name defines the name of the single file that is unpacked, if the payload is not an archive
 
 	gr *pgzip.Reader
 	tr *tar.Reader
 	r  io.ReadCloser
+
+	limits      Limits
+	read        byteCounter   // read defines the amount of payload bytes read
+	payloadSize *atomic.Int64 // payloadSize defines the size of the entire payload, if known
+	extracted   int64         // extracted defines the amount of bytes of file content extracted
+	entries     int64         // entries defines the amount of entries unpacked
+
+	written []string // written defines the paths that have been written by the unpacker, in order
 }
 
-func NewUnpacker(prompt bool, r io.ReadCloser) (*Unpacker, error) {
-	gr, err := pgzip.NewReader(r)
+// NewUnpacker creates an unpacker that unpacks the archive read from r into the provided directory.
+// The directory is created if it does not exist, the current working directory is used if dir is empty.
+func NewUnpacker(prompt bool, dir string, r io.ReadCloser) (*Unpacker, error) {
+	dir, err := unpackDir(dir)
 	if err != nil {
 		return nil, err
 	}
-	cwd, err := os.Getwd()
+	u := &Unpacker{
+		prompt:      prompt,
+		dir:         dir,
+		r:           r,
+		limits:      DefaultLimits,
+		payloadSize: &atomic.Int64{},
+	}
+	gr, err := pgzip.NewReader(io.TeeReader(r, &u.read))
 	if err != nil {
 		return nil, err
 	}
-	tr := tar.NewReader(gr)
+	u.gr = gr
+	u.tr = tar.NewReader(gr)
+	return u, nil
+}
 
+// NewFileUnpacker creates an unpacker that unpacks a payload that is not an archive, such as data read
+// from stdin, as a single file with the provided name in the provided directory, see NewUnpacker.
+// The name must not contain any directories.
+func NewFileUnpacker(prompt bool, dir string, r io.ReadCloser, name string) (*Unpacker, error) {
+	if err := ValidateFileName(name); err != nil {
+		return nil, err
+	}
+	dir, err := unpackDir(dir)
+	if err != nil {
+		return nil, err
+	}
 	return &Unpacker{
-		prompt: prompt,
-		cwd:    cwd,
-		gr:     gr,
-		tr:     tr,
-		r:      r,
+		prompt:      prompt,
+		dir:         dir,
+		name:        name,
+		r:           r,
+		limits:      DefaultLimits,
+		payloadSize: &atomic.Int64{},
 	}, nil
 }
 
+// ValidateFileName returns ErrInvalidFileName unless the provided name is the name of a file in the
+// current directory, without any directories.
+func ValidateFileName(name string) error {
+	if name != filepath.Base(name) || name == "." || name == ".." || name == string(filepath.Separator) {
+		return fmt.Errorf("%w: %q", ErrInvalidFileName, name)
+	}
+	return nil
+}
+
+// unpackDir resolves the absolute path of the directory to unpack into, creating it if it does not exist.
+func unpackDir(dir string) (string, error) {
+	if dir == "" {
+		return os.Getwd()
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("creating output directory: %w", err)
+	}
+	return dir, nil
+}
+
+// NewStreamUnpacker creates an unpacker that unpacks the archive into the provided directory while it is being received.
+// The provided receive function is run concurrently and should write the archive into the
+// provided writer, the context passed to it is cancelled if the unpacker is closed before the
+// archive has been unpacked. Closing the unpacker waits for receive to return, and returns its error.
+// As the files are written before the transfer is complete, the files written by the unpacker
+// are removed if receiving fails or is aborted, for instance if the checksum of the payload does not match.
+// The writer passed to receive implements SetPayloadSize, which sets the size of the payload, see Unpacker.SetPayloadSize.
+func NewStreamUnpacker(ctx context.Context, prompt bool, dir string, receive func(context.Context, io.Writer) error) (*Unpacker, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	sr := &streamReader{pr: pr, done: make(chan error, 1), cancel: cancel}
+	sw := &streamWriter{PipeWriter: pw, payloadSize: &atomic.Int64{}}
+	go func() {
+		err := receive(ctx, sw)
+		pw.CloseWithError(err)
+		sr.done <- err
+	}()
+	u, err := NewUnpacker(prompt, dir, sr)
+	if err != nil {
+		_ = sr.abort()
+		return nil, err
+	}
+	// The size of the payload is set while receiving, before the payload is written.
+	u.payloadSize = sw.payloadSize
+	return u, nil
+}
+
+// Dir returns the absolute path of the directory that the unpacker unpacks into.
+func (u *Unpacker) Dir() string {
+	return u.dir
+}
+
+// SetPayloadSize sets the size of the entire payload, such as the size announced by the sender, so that the
+// limits of the unpacker are relative to the entire payload rather than the part of it read so far. Otherwise
+// archives starting with highly compressible files are mistaken for archive bombs.
+func (u *Unpacker) SetPayloadSize(size int64) {
+	u.payloadSize.Store(size)
+}
+
+// SetLimits sets the limits of the unpacker, replacing DefaultLimits.
+func (u *Unpacker) SetLimits(limits Limits) {
+	u.limits = limits
+}
+
 // Close closes all underlying readers of the unpacker.
 func (u *Unpacker) Close() error {
+	sr, isStream := u.r.(*streamReader)
+	if isStream && !u.finished {
+		// Abort before closing the decompressor, which waits for its pending reads of the stream.
+		err := sr.abort()
+		if u.gr != nil {
+			_ = u.gr.Close()
+		}
+		if err != nil {
+			u.removeWritten()
+		}
+		return err
+	}
 	if u.gr != nil {
 		if err := u.gr.Close(); err != nil {
 			return err
 		}
 	}
+	if isStream {
+		if err := sr.Close(); err != nil {
+			u.removeWritten()
+			return err
+		}
+		return nil
+	}
 	if u.r != nil {
 		if err := u.r.Close(); err != nil {
 			return err
@@ -115,27 +349,43 @@ func (u *Unpacker) Close() error {
 	return nil
 }
 
+// removeWritten optimistically removes the files and directories written by the unpacker.
+// Directories are only removed if they are empty.
+func (u *Unpacker) removeWritten() {
+	for i := len(u.written) - 1; i >= 0; i-- {
+		os.Remove(u.written[i])
+	}
+	u.written = nil
+}
+
 // Unpack will decompress and unpack the archive. Resolves a Committer
 // which can be used to write file to disk. If the unpacker is configured to prompt
 // it will return a ErrUnpackFileExists along with the committer. Returns a io.EOF
 // once the archive has been fully consumed.
 func (u *Unpacker) Unpack() (Committer, error) {
-	if u.tr == nil {
+	if u.tr == nil && u.name == "" {
 		return nil, ErrUninitialized
 	}
-	header, err := u.tr.Next()
+	header, r, err := u.next()
 	switch {
+	case errors.Is(err, io.EOF):
+		u.finished = true
+		return nil, err
 	case err != nil:
 		return nil, err
 	case header == nil:
 		return nil, ErrUnpackNoHeader
 	}
-	path := filepath.Join(u.cwd, header.Name)
+	if err := u.check(header); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(u.dir, header.Name)
 	commiter := committer{
-		cwd:    u.cwd,
-		name:   header.Name,
-		tr:     u.tr,
-		header: header,
+		dir:     u.dir,
+		name:    header.Name,
+		r:       &limitedReader{r: r, u: u},
+		header:  header,
+		written: &u.written,
 	}
 
 	if u.prompt && header.Typeflag == tar.TypeReg && fileExists(path) {
@@ -144,31 +394,226 @@ func (u *Unpacker) Unpack() (Committer, error) {
 	return &commiter, nil
 }
 
+// next returns the header of the next file to unpack, along with the reader of its content.
+func (u *Unpacker) next() (*tar.Header, io.Reader, error) {
+	if u.name == "" {
+		header, err := u.tr.Next()
+		return header, u.tr, err
+	}
+	if u.finished {
+		return nil, nil, io.EOF
+	}
+	u.finished = true
+	return &tar.Header{Name: u.name, Typeflag: tar.TypeReg}, io.TeeReader(u.r, &u.read), nil
+}
+
+// check rejects entries that would be written outside of the output directory, links,
+// and entries exceeding the entry limit.
+func (u *Unpacker) check(header *tar.Header) error {
+	u.entries++
+	if max := u.maxEntries(); max > 0 && u.entries > max {
+		return fmt.Errorf("%w of one entry per %d bytes of payload", ErrUnpackTooManyEntries, u.limits.MinEntrySize)
+	}
+	if !filepath.IsLocal(header.Name) {
+		return fmt.Errorf("%w: %q", ErrUnpackPathTraversal, header.Name)
+	}
+	// Links are replaced by the files that they point to when packing, archives
+	// containing them are not created by portal and are rejected rather than
+	// checking whether they point outside of the output directory.
+	if header.Typeflag == tar.TypeSymlink || header.Typeflag == tar.TypeLink {
+		return fmt.Errorf("%w: %q", ErrUnpackLink, header.Name)
+	}
+	return nil
+}
+
+// payload returns the size of the payload that the limits are relative to.
+func (u *Unpacker) payload() int64 {
+	size, read := u.payloadSize.Load(), u.read.Load()
+	if size > read {
+		return size
+	}
+	return read
+}
+
+// maxSize returns the amount of bytes that may be extracted given the size of the payload, 0 for no limit.
+func (u *Unpacker) maxSize() int64 {
+	if u.limits.MaxRatio <= 0 {
+		return 0
+	}
+	payload := u.payload()
+	if payload > math.MaxInt64/u.limits.MaxRatio {
+		return 0
+	}
+	if max := payload * u.limits.MaxRatio; max > MIN_UNPACK_SIZE {
+		return max
+	}
+	return MIN_UNPACK_SIZE
+}
+
+// maxEntries returns the amount of entries that may be unpacked given the size of the payload, 0 for no limit.
+func (u *Unpacker) maxEntries() int64 {
+	if u.limits.MinEntrySize <= 0 {
+		return 0
+	}
+	if max := u.payload() / u.limits.MinEntrySize; max > MIN_UNPACK_ENTRIES {
+		return max
+	}
+	return MIN_UNPACK_ENTRIES
+}
+
+// limitedReader reads the content of an entry, failing once the files extracted by the unpacker exceed its size limit.
+type limitedReader struct {
+	r io.Reader
+	u *Unpacker
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.u.extracted += int64(n)
+	if max := l.u.maxSize(); max > 0 && l.u.extracted > max {
+		// Only the bytes within the limit are extracted.
+		n -= int(l.u.extracted - max)
+		l.u.extracted = max
+		return n, fmt.Errorf("%w of %d times the payload size", ErrUnpackTooLarge, l.u.limits.MaxRatio)
+	}
+	return n, err
+}
+
+// archiveWriter decompresses an archive while it is written to it.
+type archiveWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// NewArchiveWriter returns a writer that decompresses the archive written to it, and writes the uncompressed
+// tar archive into the provided writer. If single is set, only the content of the single file in the archive
+// is written. Closing the returned writer waits for the archive to be written, and returns any error doing so.
+func NewArchiveWriter(w io.Writer, single bool) io.WriteCloser {
+	pr, pw := io.Pipe()
+	aw := &archiveWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		err := decompress(pr, w, single)
+		// Writes to the archive writer fail once decompressing fails.
+		pr.CloseWithError(err)
+		aw.done <- err
+	}()
+	return aw
+}
+
+func (a *archiveWriter) Write(p []byte) (int, error) {
+	return a.pw.Write(p)
+}
+
+func (a *archiveWriter) Close() error {
+	a.pw.Close()
+	return <-a.done
+}
+
+// decompress decompresses the archive read from r into w, see NewArchiveWriter.
+func decompress(r io.Reader, w io.Writer, single bool) error {
+	gr, err := pgzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	if !single {
+		_, err := io.Copy(w, gr)
+		return err
+	}
+	tr := tar.NewReader(gr)
+	header, err := tr.Next()
+	if err != nil {
+		return err
+	}
+	if header.Typeflag != tar.TypeReg {
+		return fmt.Errorf("archive does not contain a single file, got %q", header.Name)
+	}
+	if _, err := io.Copy(w, tr); err != nil {
+		return err
+	}
+	// Discard the remainder of the archive, such as padding.
+	_, err = io.Copy(io.Discard, gr)
+	return err
+}
+
+// streamReader reads an archive that is being received concurrently.
+// streamWriter is the writer of the stream of a stream unpacker, which the size of the payload is set on.
+type streamWriter struct {
+	*io.PipeWriter
+	payloadSize *atomic.Int64
+}
+
+// SetPayloadSize sets the size of the payload, see Unpacker.SetPayloadSize.
+func (s *streamWriter) SetPayloadSize(size int64) {
+	s.payloadSize.Store(size)
+}
+
+type streamReader struct {
+	pr     *io.PipeReader
+	done   chan error
+	cancel context.CancelFunc
+	once   sync.Once
+	err    error
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	return s.pr.Read(p)
+}
+
+// Close discards the remainder of the stream, such as archive padding, and waits
+// for the receiving to finish.
+func (s *streamReader) Close() error {
+	s.once.Do(func() {
+		_, _ = io.Copy(io.Discard, s.pr)
+		s.err = <-s.done
+		s.cancel()
+	})
+	return s.err
+}
+
+// abort closes the stream before it has been fully read, cancels the receiving, and waits for it to finish.
+func (s *streamReader) abort() error {
+	s.once.Do(func() {
+		s.pr.CloseWithError(ErrUnpackAborted)
+		s.cancel()
+		s.err = <-s.done
+	})
+	return s.err
+}
+
 // Committer defines a unit that can commit a file to disk
 type Committer interface {
 	FileName() string
+	// Path returns the absolute path that the file is committed to.
+	Path() string
 	Commit() (int64, error)
 }
 
 type committer struct {
-	cwd    string
-	name   string
-	tr     *tar.Reader
-	header *tar.Header
+	dir     string
+	name    string
+	r       io.Reader
+	header  *tar.Header
+	written *[]string
 }
 
 func (c *committer) FileName() string {
 	return c.name
 }
 
+func (c *committer) Path() string {
+	return filepath.Join(c.dir, c.name)
+}
+
 func (c *committer) Commit() (int64, error) {
-	path := filepath.Join(c.cwd, c.name)
+	path := c.Path()
 	switch c.header.Typeflag {
 	case tar.TypeDir:
 		if _, err := os.Stat(path); err != nil {
 			if err := os.MkdirAll(path, 0755); err != nil {
 				return 0, err
 			}
+			c.wrote(path)
 		}
 		return 0, nil
 	case tar.TypeReg:
@@ -176,8 +621,9 @@ func (c *committer) Commit() (int64, error) {
 		if err != nil {
 			return 0, err
 		}
+		c.wrote(path)
 		defer f.Close()
-		if _, err := io.Copy(f, c.tr); err != nil {
+		if _, err := io.Copy(f, c.r); err != nil {
 			return 0, err
 		}
 		info, err := f.Stat()
@@ -190,6 +636,13 @@ func (c *committer) Commit() (int64, error) {
 	}
 }
 
+// wrote records that the committer has written the provided path.
+func (c *committer) wrote(path string) {
+	if c.written != nil {
+		*c.written = append(*c.written, path)
+	}
+}
+
 // ----------------------------------------------------- Utilities -----------------------------------------------------
 
 // Traverses a file or directory recursively for total size in bytes.
@@ -208,6 +661,30 @@ func FileSize(filePath string) (int64, error) {
 	return size, nil
 }
 
+// ContentSize traverses a file or directory recursively for the total size in bytes of the file contents
+// that are archived, following symlinks like the archive does. Unlike FileSize, directories do not count.
+func ContentSize(filePath string) (int64, error) {
+	var size int64
+	err := filepath.Walk(filePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if (info.Mode() & os.ModeSymlink) == os.ModeSymlink {
+			if info, err = os.Stat(path); err != nil {
+				return err
+			}
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
 // optimistically remove files created by portal with the specified prefix
 func RemoveTemporaryFiles(prefix string) {
 	tempFiles, err := os.ReadDir(os.TempDir())
@@ -230,7 +707,8 @@ func RemoveTemporaryFiles(prefix string) {
 
 // addToTarArchive adds a file/folder to a tar archive.
 // Handles symlinks by replacing them with the files that they point to.
-func addToTarArchive(tw *tar.Writer, file *os.File) error {
+// The contents of the added files are also written to the provided progress writer.
+func addToTarArchive(tw *tar.Writer, file *os.File, progress io.Writer) error {
 	var absoluteBase string
 	absPath, err := filepath.Abs(file.Name())
 	if err != nil {
@@ -239,6 +717,9 @@ func addToTarArchive(tw *tar.Writer, file *os.File) error {
 	absoluteBase = filepath.Dir(absPath)
 
 	return filepath.Walk(file.Name(), func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
 		if (fi.Mode() & os.ModeSymlink) == os.ModeSymlink {
 			// read path that the symlink is pointing to
 			var link string
@@ -278,7 +759,7 @@ func addToTarArchive(tw *tar.Writer, file *os.File) error {
 				return err
 			}
 			defer data.Close()
-			if _, err := io.Copy(tw, data); err != nil {
+			if _, err := io.Copy(tw, io.TeeReader(data, progress)); err != nil {
 				return err
 			}
 		}
@@ -286,6 +767,16 @@ func addToTarArchive(tw *tar.Writer, file *os.File) error {
 	})
 }
 
+// byteCounter is a writer that counts the bytes written to it.
+type byteCounter struct {
+	atomic.Int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.Add(int64(len(p)))
+	return len(p), nil
+}
+
 func fileExists(filename string) bool {
 	_, err := os.Stat(filename)
 	return !os.IsNotExist(err)
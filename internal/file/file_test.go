@@ -0,0 +1,438 @@
+package file
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/pgzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTree creates a directory with a nested directory and a symlink, returning its path.
+func writeTree(t *testing.T) string {
+	root := filepath.Join(t.TempDir(), "tree")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "nested"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello portal"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "nested", "b.txt"), make([]byte, 4096), 0644))
+	require.NoError(t, os.Symlink(filepath.Join(root, "a.txt"), filepath.Join(root, "link.txt")))
+	return root
+}
+
+// chdir changes the working directory for the duration of the test, as the unpacker unpacks into it.
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func TestContentSize(t *testing.T) {
+	root := writeTree(t)
+	size, err := ContentSize(root)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2*len("hello portal")+4096), size)
+}
+
+// packTree packs the provided directory as a stream, returning the archive along with the stream.
+func packTree(t *testing.T, root string) ([]byte, *Stream) {
+	f, err := os.Open(root)
+	require.NoError(t, err)
+	defer f.Close()
+	stream := PackFilesStream([]*os.File{f})
+	archive, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	return archive, stream
+}
+
+// unpackAll unpacks and commits every file in the archive.
+func unpackAll(t *testing.T, u *Unpacker) {
+	for {
+		c, err := u.Unpack()
+		if err == io.EOF {
+			return
+		}
+		require.NoError(t, err)
+		_, err = c.Commit()
+		require.NoError(t, err)
+	}
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	root := writeTree(t)
+	archive, stream := packTree(t, root)
+
+	// The progress of the stream ends at the estimated payload size.
+	size, err := ContentSize(root)
+	require.NoError(t, err)
+	assert.Equal(t, size, stream.Progress())
+
+	chdir(t, t.TempDir())
+	u, err := NewStreamUnpacker(context.Background(), false, "", func(_ context.Context, w io.Writer) error {
+		_, err := w.Write(archive)
+		return err
+	})
+	require.NoError(t, err)
+	unpackAll(t, u)
+	require.NoError(t, u.Close())
+
+	for _, name := range []string{"a.txt", "link.txt", filepath.Join("nested", "b.txt")} {
+		expected, err := os.ReadFile(filepath.Join(root, name))
+		require.NoError(t, err)
+		actual, err := os.ReadFile(filepath.Join("tree", name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual, name)
+	}
+}
+
+func TestUnpackerOutputDir(t *testing.T) {
+	archive, _ := packTree(t, writeTree(t))
+	dir := filepath.Join(t.TempDir(), "downloads", "portal")
+
+	// The output directory is created if it does not exist.
+	u, err := NewUnpacker(false, dir, io.NopCloser(bytes.NewReader(archive)))
+	require.NoError(t, err)
+	assert.Equal(t, dir, u.Dir())
+	c, err := u.Unpack()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "tree"), c.Path())
+	_, err = c.Commit()
+	require.NoError(t, err)
+	unpackAll(t, u)
+	require.NoError(t, u.Close())
+
+	content, err := os.ReadFile(filepath.Join(dir, "tree", "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello portal", string(content))
+}
+
+func TestStreamUnpackerFailedReceive(t *testing.T) {
+	archive, _ := packTree(t, writeTree(t))
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	// The entire archive is received, but the payload is rejected afterwards, as with a checksum mismatch.
+	errRejected := errors.New("payload rejected")
+	u, err := NewStreamUnpacker(context.Background(), false, "", func(_ context.Context, w io.Writer) error {
+		if _, err := w.Write(archive); err != nil {
+			return err
+		}
+		return errRejected
+	})
+	require.NoError(t, err)
+	unpackAll(t, u)
+	assert.ErrorIs(t, u.Close(), errRejected)
+
+	// The unpacked files are removed.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestStreamUnpackerAbort(t *testing.T) {
+	archive, _ := packTree(t, writeTree(t))
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	// The archive arrives, after which receiving blocks on the network until it is cancelled.
+	u, err := NewStreamUnpacker(context.Background(), false, "", func(ctx context.Context, w io.Writer) error {
+		if _, err := w.Write(archive); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		c, err := u.Unpack()
+		require.NoError(t, err)
+		_, err = c.Commit()
+		require.NoError(t, err)
+	}
+
+	// Closing before the archive has been unpacked aborts receiving.
+	closed := make(chan error, 1)
+	go func() { closed <- u.Close() }()
+	select {
+	case err := <-closed:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing the unpacker did not abort receiving")
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestStage(t *testing.T) {
+	staged, size, err := Stage(strings.NewReader("hello portal"))
+	require.NoError(t, err)
+	defer os.Remove(staged.Name())
+	defer staged.Close()
+	assert.Equal(t, int64(len("hello portal")), size)
+	content, err := io.ReadAll(staged)
+	require.NoError(t, err)
+	assert.Equal(t, "hello portal", string(content))
+}
+
+func TestFileUnpacker(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	u, err := NewFileUnpacker(true, "", io.NopCloser(strings.NewReader("hello portal")), "hello.txt")
+	require.NoError(t, err)
+	unpackAll(t, u)
+	require.NoError(t, u.Close())
+	content, err := os.ReadFile(filepath.Join(dir, "hello.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello portal", string(content))
+
+	// Existing files are prompted for.
+	u, err = NewFileUnpacker(true, "", io.NopCloser(strings.NewReader("goodbye")), "hello.txt")
+	require.NoError(t, err)
+	c, err := u.Unpack()
+	assert.ErrorIs(t, err, ErrUnpackFileExists)
+	assert.Equal(t, "hello.txt", c.FileName())
+
+	for _, name := range []string{"", ".", "..", "/", "../hello.txt", "nested/hello.txt", "/tmp/hello.txt"} {
+		_, err := NewFileUnpacker(false, "", io.NopCloser(strings.NewReader("")), name)
+		assert.ErrorIs(t, err, ErrInvalidFileName, name)
+	}
+}
+
+func TestArchiveWriter(t *testing.T) {
+	root := writeTree(t)
+
+	t.Run("archive", func(t *testing.T) {
+		archive, _ := packTree(t, root)
+		out := &bytes.Buffer{}
+		w := NewArchiveWriter(out, false)
+		_, err := w.Write(archive)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		var names []string
+		tr := tar.NewReader(out)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			names = append(names, header.Name)
+		}
+		assert.ElementsMatch(t, []string{"tree", "tree/a.txt", "tree/link.txt", "tree/nested", "tree/nested/b.txt"}, names)
+	})
+
+	t.Run("single file", func(t *testing.T) {
+		f, err := os.Open(filepath.Join(root, "a.txt"))
+		require.NoError(t, err)
+		defer f.Close()
+		name, single := SingleFileName([]*os.File{f})
+		assert.True(t, single)
+		assert.Equal(t, "a.txt", name)
+		archive, err := io.ReadAll(PackFilesStream([]*os.File{f}))
+		require.NoError(t, err)
+
+		out := &bytes.Buffer{}
+		w := NewArchiveWriter(out, true)
+		_, err = w.Write(archive)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		assert.Equal(t, "hello portal", out.String())
+	})
+
+	t.Run("single file of folder", func(t *testing.T) {
+		archive, _ := packTree(t, root)
+		w := NewArchiveWriter(io.Discard, true)
+		_, _ = w.Write(archive)
+		assert.Error(t, w.Close())
+	})
+}
+
+// craftArchive creates a compressed tar archive of the provided headers, filling regular files with their size in zeros.
+func craftArchive(t *testing.T, headers ...*tar.Header) []byte {
+	buf := &bytes.Buffer{}
+	gw := pgzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for _, header := range headers {
+		if header.Mode == 0 {
+			header.Mode = 0644
+		}
+		require.NoError(t, tw.WriteHeader(header))
+		if header.Typeflag == tar.TypeReg {
+			_, err := io.CopyN(tw, zeros{}, header.Size)
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// unpackUntilError unpacks and commits the files of the archive into the provided directory, returning the first error.
+func unpackUntilError(t *testing.T, dir string, archive []byte, limits Limits) error {
+	u, err := NewUnpacker(false, dir, io.NopCloser(bytes.NewReader(archive)))
+	require.NoError(t, err)
+	defer u.Close()
+	u.SetLimits(limits)
+	for {
+		c, err := u.Unpack()
+		if err != nil {
+			return err
+		}
+		if _, err := c.Commit(); err != nil {
+			return err
+		}
+	}
+}
+
+func TestUnpackerPathTraversal(t *testing.T) {
+	for _, name := range []string{"../evil.txt", "nested/../../evil.txt", "/tmp/evil.txt", ""} {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "out")
+			archive := craftArchive(t,
+				&tar.Header{Name: "ok.txt", Typeflag: tar.TypeReg, Size: 1},
+				&tar.Header{Name: name, Typeflag: tar.TypeReg, Size: 1},
+			)
+			assert.ErrorIs(t, unpackUntilError(t, dir, archive, DefaultLimits), ErrUnpackPathTraversal)
+
+			// Nothing is written outside of the output directory.
+			entries, err := os.ReadDir(root)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, "out", entries[0].Name())
+			_, err = os.Stat("/tmp/evil.txt")
+			assert.ErrorIs(t, err, os.ErrNotExist)
+		})
+	}
+
+	// Names that stay inside of the output directory are allowed.
+	dir := t.TempDir()
+	archive := craftArchive(t, &tar.Header{Name: "nested/../ok.txt", Typeflag: tar.TypeReg, Size: 1})
+	assert.ErrorIs(t, unpackUntilError(t, dir, archive, DefaultLimits), io.EOF)
+	assert.FileExists(t, filepath.Join(dir, "ok.txt"))
+}
+
+func TestUnpackerLinks(t *testing.T) {
+	for _, header := range []*tar.Header{
+		{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+		{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+		{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: "ok.txt"},
+		{Name: "evil", Typeflag: tar.TypeLink, Linkname: "/etc/passwd"},
+		{Name: "evil", Typeflag: tar.TypeLink, Linkname: "ok.txt"},
+	} {
+		t.Run(header.Linkname, func(t *testing.T) {
+			dir := t.TempDir()
+			archive := craftArchive(t,
+				&tar.Header{Name: "ok.txt", Typeflag: tar.TypeReg, Size: 1},
+				header,
+				// Writing through the link would escape the output directory.
+				&tar.Header{Name: "evil/evil.txt", Typeflag: tar.TypeReg, Size: 1},
+			)
+			assert.ErrorIs(t, unpackUntilError(t, dir, archive, DefaultLimits), ErrUnpackLink)
+			_, err := os.Lstat(filepath.Join(dir, "evil"))
+			assert.ErrorIs(t, err, os.ErrNotExist)
+		})
+	}
+}
+
+func TestUnpackerLimits(t *testing.T) {
+	t.Run("size", func(t *testing.T) {
+		// A file of zeros compresses to a fraction of the allowed ratio.
+		archive := craftArchive(t, &tar.Header{Name: "bomb", Typeflag: tar.TypeReg, Size: MIN_UNPACK_SIZE + 1<<20})
+		require.Less(t, int64(len(archive))*DEFAULT_UNPACK_MAX_RATIO, int64(MIN_UNPACK_SIZE))
+		dir := t.TempDir()
+		assert.ErrorIs(t, unpackUntilError(t, dir, archive, DefaultLimits), ErrUnpackTooLarge)
+		info, err := os.Stat(filepath.Join(dir, "bomb"))
+		require.NoError(t, err)
+		assert.LessOrEqual(t, info.Size(), int64(MIN_UNPACK_SIZE))
+
+		assert.ErrorIs(t, unpackUntilError(t, t.TempDir(), archive, Limits{}), io.EOF)
+	})
+
+	t.Run("entries", func(t *testing.T) {
+		headers := make([]*tar.Header, 2*MIN_UNPACK_ENTRIES)
+		for i := range headers {
+			headers[i] = &tar.Header{Name: "dir", Typeflag: tar.TypeDir, Mode: 0755}
+		}
+		archive := craftArchive(t, headers...)
+		assert.ErrorIs(t, unpackUntilError(t, t.TempDir(), archive, DefaultLimits), ErrUnpackTooManyEntries)
+		assert.ErrorIs(t, unpackUntilError(t, t.TempDir(), archive, Limits{}), io.EOF)
+	})
+
+	t.Run("within limits", func(t *testing.T) {
+		archive, _ := packTree(t, writeTree(t))
+		assert.ErrorIs(t, unpackUntilError(t, t.TempDir(), archive, Limits{MaxRatio: 1, MinEntrySize: 1}), io.EOF)
+	})
+	t.Run("compressible first entry", func(t *testing.T) {
+		// Zeros followed by random data, the size of the extracted zeros exceeds the ratio relative to the payload
+		// read before the random data, but not relative to the entire payload.
+		buf := &bytes.Buffer{}
+		gw := pgzip.NewWriter(buf)
+		tw := tar.NewWriter(gw)
+		for _, entry := range []struct {
+			name string
+			r    io.Reader
+			size int64
+		}{{"zeros", zeros{}, MIN_UNPACK_SIZE + 1<<20}, {"random", rand.Reader, 16 << 20}} {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: entry.name, Typeflag: tar.TypeReg, Mode: 0644, Size: entry.size}))
+			_, err := io.CopyN(tw, entry.r, entry.size)
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, gw.Close())
+		archive := buf.Bytes()
+		limits := Limits{MaxRatio: 6}
+
+		assert.ErrorIs(t, unpackUntilError(t, t.TempDir(), archive, limits), ErrUnpackTooLarge,
+			"limits are relative to the payload read so far without the payload size")
+
+		unpack := func(u *Unpacker) error {
+			defer u.Close()
+			u.SetLimits(limits)
+			for {
+				c, err := u.Unpack()
+				if err != nil {
+					return err
+				}
+				if _, err := c.Commit(); err != nil {
+					return err
+				}
+			}
+		}
+		u, err := NewUnpacker(false, t.TempDir(), io.NopCloser(bytes.NewReader(archive)))
+		require.NoError(t, err)
+		u.SetPayloadSize(int64(len(archive)))
+		assert.ErrorIs(t, unpack(u), io.EOF)
+
+		// The size of the payload is set on the stream of stream unpackers while receiving.
+		u, err = NewStreamUnpacker(context.Background(), false, t.TempDir(), func(ctx context.Context, w io.Writer) error {
+			w.(interface{ SetPayloadSize(int64) }).SetPayloadSize(int64(len(archive)))
+			_, err := w.Write(archive)
+			return err
+		})
+		require.NoError(t, err)
+		assert.ErrorIs(t, unpack(u), io.EOF)
+	})
+}
@@ -0,0 +1,83 @@
+// Package link formats and parses the links that combine the address of a relay with a password, so that a single
+// string is enough to receive from a sender. Links come in two forms:
+//   - portal://<relay>/<password>, such as portal://myrelay.io/1-solar-storm-moon.
+//   - https://<relay>/r/<password>, the web link of the password, which the relay serves a receive page for.
+package link
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/SpatiumPortae/portal/internal/password"
+	"github.com/SpatiumPortae/portal/internal/relay"
+)
+
+// SCHEME is the scheme of portal links.
+const SCHEME = "portal"
+
+// WEB_PATH is the path on the relay that web links are served under.
+const WEB_PATH = "/r/"
+
+var ErrInvalidLink = errors.New("invalid link, expected portal://<relay>/<password> or https://<relay>/r/<password>")
+
+// URI returns the portal link of the provided password on the relay with the provided address, such as
+// portal://myrelay.io/1-solar-storm-moon. The scheme of the relay address is not part of the link, the relay
+// is reached using TLS unless it does not speak TLS.
+func URI(relayAddr string, password string) (string, error) {
+	addr, err := relay.ParseAddr(relayAddr)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s://%s/%s", SCHEME, addr.Host, password), nil
+}
+
+// WebURL returns the web link of the provided password on the relay with the provided address, such as
+// https://myrelay.io/r/1-solar-storm-moon.
+func WebURL(relayAddr string, password string) (string, error) {
+	addr, err := relay.ParseAddr(relayAddr)
+	if err != nil {
+		return "", err
+	}
+	return addr.HTTP(WEB_PATH + password), nil
+}
+
+// IsLink returns whether the provided string is a link, rather than a password.
+func IsLink(s string) bool {
+	return strings.Contains(s, "://")
+}
+
+// Parse parses the provided portal link or web link, returning the address of the relay and the password.
+func Parse(s string) (relayAddr string, pass string, err error) {
+	scheme, rest, found := strings.Cut(s, "://")
+	if !found {
+		return "", "", ErrInvalidLink
+	}
+	switch strings.ToLower(scheme) {
+	case SCHEME:
+		// The relay address may have a path prefix, the password is the last segment of the path.
+		i := strings.LastIndex(strings.TrimSuffix(rest, "/"), "/")
+		if i < 0 {
+			return "", "", ErrInvalidLink
+		}
+		relayAddr, pass = rest[:i], strings.TrimSuffix(rest[i+1:], "/")
+	case "https", "http":
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %s", ErrInvalidLink, err)
+		}
+		path := strings.TrimSuffix(u.Path, "/")
+		i := strings.LastIndex(path, WEB_PATH)
+		if i < 0 {
+			return "", "", ErrInvalidLink
+		}
+		relayAddr, pass = fmt.Sprintf("%s://%s%s", strings.ToLower(scheme), u.Host, path[:i]), path[i+len(WEB_PATH):]
+	default:
+		return "", "", ErrInvalidLink
+	}
+	if relayAddr == "" || !password.IsValid(pass) {
+		return "", "", ErrInvalidLink
+	}
+	return relayAddr, pass, nil
+}
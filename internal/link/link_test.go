@@ -0,0 +1,80 @@
+package link
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURI(t *testing.T) {
+	tests := []struct {
+		relay    string
+		expected string
+	}{
+		{relay: "portal.spatiumportae.com", expected: "portal://portal.spatiumportae.com/1-solar-storm-moon"},
+		{relay: "wss://myrelay.io:1234/", expected: "portal://myrelay.io:1234/1-solar-storm-moon"},
+		{relay: "http://myrelay.io/portal", expected: "portal://myrelay.io/portal/1-solar-storm-moon"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.relay, func(t *testing.T) {
+			uri, err := URI(tc.relay, "1-solar-storm-moon")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, uri)
+		})
+	}
+
+	_, err := URI("ftp://myrelay.io", "1-solar-storm-moon")
+	assert.Error(t, err)
+}
+
+func TestWebURL(t *testing.T) {
+	url, err := WebURL("myrelay.io", "1-solar-storm-moon")
+	require.NoError(t, err)
+	assert.Equal(t, "https://myrelay.io/r/1-solar-storm-moon", url)
+	url, err = WebURL("ws://localhost:8080", "1-solar-storm-moon")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/r/1-solar-storm-moon", url)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		link  string
+		relay string
+	}{
+		{link: "portal://myrelay.io/1-solar-storm-moon", relay: "myrelay.io"},
+		{link: "portal://myrelay.io:1234/relay/1-solar-storm-moon/", relay: "myrelay.io:1234/relay"},
+		{link: "https://myrelay.io/r/1-solar-storm-moon", relay: "https://myrelay.io"},
+		{link: "http://localhost:8080/relay/r/1-solar-storm-moon", relay: "http://localhost:8080/relay"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.link, func(t *testing.T) {
+			relay, pass, err := Parse(tc.link)
+			require.NoError(t, err)
+			assert.Equal(t, tc.relay, relay)
+			assert.Equal(t, "1-solar-storm-moon", pass)
+		})
+	}
+
+	for _, invalid := range []string{
+		"1-solar-storm-moon",
+		"portal://1-solar-storm-moon",
+		"portal://myrelay.io/solar-storm-moon",
+		"https://myrelay.io/1-solar-storm-moon",
+		"ftp://myrelay.io/r/1-solar-storm-moon",
+	} {
+		_, _, err := Parse(invalid)
+		assert.ErrorIs(t, err, ErrInvalidLink, invalid)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []func(string, string) (string, error){URI, WebURL} {
+		l, err := format("wss://myrelay.io/relay", "42-abacus-zoom")
+		require.NoError(t, err)
+		relay, pass, err := Parse(l)
+		require.NoError(t, err)
+		assert.Contains(t, relay, "myrelay.io/relay")
+		assert.Equal(t, "42-abacus-zoom", pass)
+	}
+}
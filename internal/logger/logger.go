@@ -5,7 +5,6 @@ import (
 	"errors"
 	"net/http"
 
-	"github.com/tomasen/realip"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -24,11 +23,13 @@ func FromContext(ctx context.Context) (*zap.Logger, error) {
 	return logger, nil
 }
 
-func Middleware(baseLogger *zap.Logger) func(http.Handler) http.Handler {
+// Middleware adds a logger to the context of requests, logging the endpoint and the IP address of the client
+// as determined by the provided function.
+func Middleware(baseLogger *zap.Logger, clientIP func(r *http.Request) string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			logger := baseLogger.With(
-				zap.String("request_ip", realip.FromRequest(r)),
+				zap.String("request_ip", clientIP(r)),
 				zap.String("endpoint", r.URL.Path),
 			)
 			next.ServeHTTP(w, r.WithContext(WithLogger(r.Context(), logger)))
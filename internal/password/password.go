@@ -1,33 +1,73 @@
 package password
 
 import (
+	"bufio"
 	crypto_rand "crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"io"
 	math_rand "math/rand"
+	"os"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/SpatiumPortae/portal/data"
 	"golang.org/x/exp/slices"
 )
 
-const Length = 3
+// DefaultLength is the amount of words in a password, unless configured otherwise.
+const DefaultLength = 3
+
+// MinLength and MaxLength bound the amount of words in a password.
+const MinLength = 2
+const MaxLength = 8
+
+// The names of the built-in wordlists.
+const (
+	WordlistSpace = "space"
+	WordlistLarge = "large"
+)
+
+var validPassword = regexp.MustCompile(fmt.Sprintf(`^\d+(-[a-z]+){%d,%d}$`, MinLength, MaxLength))
+var validWord = regexp.MustCompile(`^[a-z]+$`)
+
+// Generator generates passwords of the configured amount of words, drawn from the configured wordlist.
+type Generator struct {
+	Words    int      // amount of words, DefaultLength if 0
+	Wordlist []string // wordlist to draw the words from, the space wordlist if empty
+}
+
+// Generate generates a random password prefixed with the supplied id.
+func (g Generator) Generate(id int) (string, error) {
+	length := g.Words
+	if length == 0 {
+		length = DefaultLength
+	}
+	if length < MinLength || length > MaxLength {
+		return "", fmt.Errorf("passwords must have between %d and %d words", MinLength, MaxLength)
+	}
+	wordlist := g.Wordlist
+	if len(wordlist) == 0 {
+		wordlist = data.SpaceWordList
+	}
+	if len(wordlist) < length {
+		return "", fmt.Errorf("wordlist has less than %d words", length)
+	}
 
-// GeneratePassword generates a random password prefixed with the supplied id.
-func Generate(id int) (string, error) {
 	var words []string
-	hitlistSize := len(data.SpaceWordList)
+	hitlistSize := len(wordlist)
 
 	rng, err := random()
 	if err != nil {
 		return "", fmt.Errorf("creating rng: %w", err)
 	}
 
-	// generate three unique words
-	for len(words) != Length {
-		candidateWord := data.SpaceWordList[rng.Intn(hitlistSize)]
+	// generate unique words
+	for len(words) != length {
+		candidateWord := wordlist[rng.Intn(hitlistSize)]
 		if !slices.Contains(words, candidateWord) {
 			words = append(words, candidateWord)
 		}
@@ -35,9 +75,16 @@ func Generate(id int) (string, error) {
 	return formatPassword(id, words), nil
 }
 
+// Generate generates a random password of the default amount of words from the space wordlist,
+// prefixed with the supplied id.
+func Generate(id int) (string, error) {
+	return Generator{}.Generate(id)
+}
+
+// IsValid returns whether the provided string is an id followed by MinLength to MaxLength words.
+// The words are not required to be from any particular wordlist.
 func IsValid(passStr string) bool {
-	re := regexp.MustCompile(`^\d+-[a-z]+-[a-z]+-[a-z]+$`)
-	return re.MatchString(passStr)
+	return validPassword.MatchString(passStr)
 }
 
 func Hashed(password string) string {
@@ -47,7 +94,7 @@ func Hashed(password string) string {
 }
 
 func formatPassword(prefixIndex int, words []string) string {
-	return fmt.Sprintf("%d-%s-%s-%s", prefixIndex, words[0], words[1], words[2])
+	return fmt.Sprintf("%d-%s", prefixIndex, strings.Join(words, "-"))
 }
 
 func random() (*math_rand.Rand, error) {
@@ -58,3 +105,61 @@ func random() (*math_rand.Rand, error) {
 	}
 	return math_rand.New(math_rand.NewSource(int64(binary.LittleEndian.Uint64(b[:])))), nil
 }
+
+// ID returns the id that the provided password is prefixed with.
+func ID(password string) (int, error) {
+	prefix, _, _ := strings.Cut(password, "-")
+	id, err := strconv.Atoi(prefix)
+	if err != nil {
+		return 0, fmt.Errorf("password is not prefixed with an id: %w", err)
+	}
+	return id, nil
+}
+
+// LoadWordlist returns the built-in wordlist with the provided name, or otherwise reads the wordlist from the file
+// at the provided path.
+func LoadWordlist(name string) ([]string, error) {
+	switch name {
+	case "", WordlistSpace:
+		return data.SpaceWordList, nil
+	case WordlistLarge:
+		return data.LargeWordList, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("opening wordlist: %w", err)
+	}
+	defer f.Close()
+	return ReadWordlist(f)
+}
+
+// ReadWordlist reads a wordlist of one word per line, ignoring empty lines. The words are the last field of the
+// lines, so that diceware wordlists with lines such as "11111 abacus" can be read as is. Words may only contain
+// the lowercase letters a-z, and duplicate words are ignored.
+func ReadWordlist(r io.Reader) ([]string, error) {
+	var words []string
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		word := fields[len(fields)-1]
+		if !validWord.MatchString(word) {
+			return nil, fmt.Errorf("invalid word %q on line %d, words may only contain the letters a-z", word, line)
+		}
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading wordlist: %w", err)
+	}
+	if len(words) < MaxLength {
+		return nil, fmt.Errorf("wordlist must have at least %d words", MaxLength)
+	}
+	return words, nil
+}
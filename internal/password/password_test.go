@@ -0,0 +1,59 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SpatiumPortae/portal/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	for _, words := range []int{MinLength, DefaultLength, MaxLength} {
+		pass, err := Generator{Words: words, Wordlist: data.LargeWordList}.Generate(42)
+		require.NoError(t, err)
+		assert.True(t, IsValid(pass), pass)
+		assert.Len(t, strings.Split(pass, "-"), words+1)
+		id, err := ID(pass)
+		require.NoError(t, err)
+		assert.Equal(t, 42, id)
+	}
+
+	_, err := Generator{Words: MaxLength + 1}.Generate(1)
+	assert.Error(t, err, "generating too many words")
+	_, err = Generator{Words: 3, Wordlist: []string{"one", "two"}}.Generate(1)
+	assert.Error(t, err, "generating more words than the wordlist has")
+}
+
+func TestIsValid(t *testing.T) {
+	assert.True(t, IsValid("1-solar-storm-moon"))
+	assert.True(t, IsValid("9999-abacus-zoom"))
+	assert.True(t, IsValid("12-a-b-c-d-e-f-g-h"))
+	assert.False(t, IsValid("1-solar"), "too few words")
+	assert.False(t, IsValid("1-a-b-c-d-e-f-g-h-i"), "too many words")
+	assert.False(t, IsValid("solar-storm-moon"), "without id")
+	assert.False(t, IsValid("1-Solar-storm-moon"), "uppercase word")
+}
+
+func TestReadWordlist(t *testing.T) {
+	words, err := ReadWordlist(strings.NewReader("11111\tone\n11112\ttwo\n\nthree\nfour\nfive\nsix\nseven\neight\none\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one", "two", "three", "four", "five", "six", "seven", "eight"}, words)
+
+	_, err = ReadWordlist(strings.NewReader("one\ntwo\n"))
+	assert.Error(t, err, "too few words")
+	_, err = ReadWordlist(strings.NewReader("one\ntwo\nt-shirt\n"))
+	assert.Error(t, err, "invalid word")
+}
+
+func TestLoadWordlist(t *testing.T) {
+	words, err := LoadWordlist(WordlistLarge)
+	require.NoError(t, err)
+	assert.Equal(t, data.LargeWordList, words)
+	for _, word := range words {
+		assert.Regexp(t, validWord, word)
+	}
+	_, err = LoadWordlist("does-not-exist.txt")
+	assert.Error(t, err)
+}
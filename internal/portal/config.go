@@ -5,6 +5,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+
+	"github.com/SpatiumPortae/portal/internal/password"
+	"github.com/SpatiumPortae/portal/internal/relay"
 )
 
 // defaultConfig specifies the default config for the portal module.
@@ -15,6 +18,35 @@ var defaultConfig = Config{
 // Config specifes a config for the portal module.
 type Config struct {
 	RendezvousAddr string `json:"RendezvousAddr,omitempty"`
+	Receivers      int    `json:"Receivers,omitempty"`
+	Password       string `json:"Password,omitempty"`
+	RelayCAFile    string `json:"RelayCAFile,omitempty"`  // PEM bundle of CAs trusted to verify the relay certificate
+	RelayCertPin   string `json:"RelayCertPin,omitempty"` // hex encoded SHA-256 fingerprint the relay certificate must match
+	RelayToken     string `json:"RelayToken,omitempty"`   // bearer token used to authenticate to the relay
+	RateLimit      int64  `json:"RateLimit,omitempty"`    // maximum bytes per second transferred, shared by all receivers
+
+	PasswordWords int      `json:"PasswordWords,omitempty"` // amount of words in generated passwords
+	Wordlist      []string `json:"Wordlist,omitempty"`      // words that generated passwords are drawn from
+}
+
+// passwordGenerator returns the generator of the passwords specified by the config.
+func (c Config) passwordGenerator() password.Generator {
+	return password.Generator{Words: c.PasswordWords, Wordlist: c.Wordlist}
+}
+
+// relayOptions returns the options for connecting to the relay specified by the config.
+func (c Config) relayOptions() []relay.Option {
+	var opts []relay.Option
+	if c.RelayCAFile != "" {
+		opts = append(opts, relay.WithCA(c.RelayCAFile))
+	}
+	if c.RelayCertPin != "" {
+		opts = append(opts, relay.WithPin(c.RelayCertPin))
+	}
+	if c.RelayToken != "" {
+		opts = append(opts, relay.WithToken(c.RelayToken))
+	}
+	return opts
 }
 
 // MergeConfigReader merges the config from the reader
@@ -2,35 +2,100 @@ package portal
 
 import (
 	"context"
+	"errors"
 	"io"
+	"sync"
 
+	"github.com/SpatiumPortae/portal/internal/conn"
 	"github.com/SpatiumPortae/portal/internal/receiver"
 	"github.com/SpatiumPortae/portal/internal/sender"
+	"github.com/SpatiumPortae/portal/internal/throttle"
 )
 
+// ErrPayloadNotReaderAt is returned when sending to multiple receivers with a payload
+// that can not be read concurrently.
+var ErrPayloadNotReaderAt = errors.New("sending to multiple receivers requires a payload implementing io.ReaderAt")
+
+// ErrListeningMultipleReceivers is returned when sending to multiple receivers using a password
+// generated by a listening receiver.
+var ErrListeningMultipleReceivers = errors.New("can not send to multiple receivers using the password of a listening receiver")
+
 // Send executes the portal send sequence. The initial connection with the relay
 // server is performed synchronously, after that the transfer sequence is performed
 // asynchronously. The function returns a portal password, a error from the rendezvous
 // initial rendezvous connection, and a channel on which errors from the transfer sequence
 // can be listened to. The provided config will be merged with the default config.
+// If the config specifies more than one receiver, the payload must implement io.ReaderAt,
+// as it is sent to every receiver concurrently. If the config specifies a password, the
+// payload is sent to the receiver listening with that password. Payloads that are not archives
+// of files, such as text, implement sender.TypedPayload.
 func Send(ctx context.Context, payload io.Reader, payloadSize int64, config *Config) (string, error, chan error) {
 	merged := MergeConfig(defaultConfig, config)
-	errC := make(chan error, 1) // buffer channel as to not block send.
-	rc, password, err := sender.ConnectRendezvous(ctx, merged.RendezvousAddr)
+	ctx = throttle.WithLimit(ctx, merged.RateLimit)
+	receivers := merged.Receivers
+	if receivers < 1 {
+		receivers = 1
+	}
+	payloads := []io.Reader{payload}
+	if receivers > 1 {
+		ra, ok := payload.(io.ReaderAt)
+		if !ok {
+			return "", ErrPayloadNotReaderAt, nil
+		}
+		payloads = make([]io.Reader, receivers)
+		for i := range payloads {
+			payloads[i] = sender.SectionPayload(ra, payloadSize)
+		}
+	}
+
+	var rc conn.Rendezvous
+	var password string
+	var err error
+	if merged.Password != "" {
+		// The receiver is listening with a password it generated.
+		if receivers > 1 {
+			return "", ErrListeningMultipleReceivers, nil
+		}
+		password = merged.Password
+		rc, err = sender.JoinRendezvous(ctx, merged.RendezvousAddr, password, merged.relayOptions()...)
+	} else {
+		rc, password, err = sender.ConnectRendezvous(ctx, merged.RendezvousAddr, receivers, merged.passwordGenerator(), merged.relayOptions()...)
+	}
 	if err != nil {
 		return "", err, nil
 	}
-	go func() {
-		defer close(errC)
-		tc, err := sender.SecureConnection(ctx, rc, password)
+	rcs := []conn.Rendezvous{rc}
+	for i := 1; i < receivers; i++ {
+		rc, err := sender.JoinRendezvous(ctx, merged.RendezvousAddr, password, merged.relayOptions()...)
 		if err != nil {
-			errC <- err
-			return
-		}
-		if err := sender.Transfer(ctx, tc, payload, payloadSize); err != nil {
-			errC <- err
-			return
+			for _, rc := range rcs {
+				_ = rc.Close()
+			}
+			return "", err, nil
 		}
+		rcs = append(rcs, rc)
+	}
+
+	errC := make(chan error, receivers) // buffer channel as to not block send.
+	var wg sync.WaitGroup
+	for i, rc := range rcs {
+		wg.Add(1)
+		go func(rc conn.Rendezvous, payload io.Reader) {
+			defer wg.Done()
+			tc, err := sender.SecureConnection(ctx, rc, password)
+			if err != nil {
+				errC <- err
+				return
+			}
+			if err := sender.Transfer(ctx, tc, payload, payloadSize); err != nil {
+				errC <- err
+				return
+			}
+		}(rc, payloads[i])
+	}
+	go func() {
+		wg.Wait()
+		close(errC)
 	}()
 	return password, nil, errC
 }
@@ -40,7 +105,8 @@ func Send(ctx context.Context, payload io.Reader, payloadSize int64, config *Con
 // default config.
 func Receive(ctx context.Context, dst io.Writer, password string, config *Config) error {
 	merged := MergeConfig(defaultConfig, config)
-	rc, err := receiver.ConnectRendezvous(merged.RendezvousAddr)
+	ctx = throttle.WithLimit(ctx, merged.RateLimit)
+	rc, err := receiver.ConnectRendezvous(merged.RendezvousAddr, merged.relayOptions()...)
 	if err != nil {
 		return err
 	}
@@ -53,3 +119,24 @@ func Receive(ctx context.Context, dst io.Writer, password string, config *Config
 	}
 	return nil
 }
+
+// Listen executes the portal receive sequence with a password generated by the receiver.
+// The initial connection with the relay server is performed synchronously, the returned
+// password should be communicated to the sender. The returned function waits for the sender
+// and writes the payload to the provided writer. The provided config will be merged with
+// the default config.
+func Listen(ctx context.Context, config *Config) (string, func(ctx context.Context, dst io.Writer) error, error) {
+	merged := MergeConfig(defaultConfig, config)
+	rc, password, err := receiver.ListenRendezvous(ctx, merged.RendezvousAddr, merged.passwordGenerator(), merged.relayOptions()...)
+	if err != nil {
+		return "", nil, err
+	}
+	return password, func(ctx context.Context, dst io.Writer) error {
+		ctx = throttle.WithLimit(ctx, merged.RateLimit)
+		tc, err := receiver.SecureConnection(ctx, rc, password)
+		if err != nil {
+			return err
+		}
+		return receiver.Receive(ctx, tc, dst)
+	}, nil
+}
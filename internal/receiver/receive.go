@@ -4,8 +4,10 @@ package receiver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"time"
 
@@ -15,6 +17,16 @@ import (
 	"nhooyr.io/websocket"
 )
 
+// MAX_RESUME_ATTEMPTS is the amount of times a failed direct transfer is resumed before giving up.
+const MAX_RESUME_ATTEMPTS = 3
+
+// PROBE_TIMEOUT is the duration the receiver tries to connect directly to the sender,
+// before falling back to relay transfer.
+const PROBE_TIMEOUT = 3 * time.Second
+
+// MAX_PROBE_BACKOFF is the longest interval between attempts to connect to the sender.
+const MAX_PROBE_BACKOFF = 2 * time.Second
+
 // doReceive performs the transfer protocol on the receiving end.
 // This function is built for all platforms except js
 func doReceive(ctx context.Context, relay conn.Transfer, addr string, dst io.Writer, msgs ...chan interface{}) error {
@@ -23,8 +35,9 @@ func doReceive(ctx context.Context, relay conn.Transfer, addr string, dst io.Wri
 	rc := conn.Rendezvous{Conn: relay.Conn}
 	// Determine if we should do direct or relay transfer.
 	var tc conn.Transfer
-	direct, err := probeSender(addr, relay.Key())
-	if err != nil {
+	direct, err := probeSender(addr, relay.Key(), PROBE_TIMEOUT)
+	isDirect := err == nil
+	if !isDirect {
 		tc = relay
 		// Communicate to the sender that we are using relay transfer.
 		if err := relay.WriteMsg(ctx, transfer.Msg{Type: transfer.ReceiverRelayCommunication}); err != nil {
@@ -55,12 +68,25 @@ func doReceive(ctx context.Context, relay conn.Transfer, addr string, dst io.Wri
 		}
 	}
 
-	// Request the payload and receive it.
-	if tc.WriteMsg(ctx, transfer.Msg{Type: transfer.ReceiverRequestPayload}) != nil {
-		return err
-	}
-	if err := receivePayload(ctx, tc, dst, msgs...); err != nil {
-		return err
+	// Request the payload and receive it. If the direct connection to the sender is lost,
+	// we reconnect and resume the transfer from the last received byte. The sender keeps
+	// the payload available for transfer.RESUME_TIMEOUT after losing the connection.
+	// Relayed transfers are not resumed, as the relay releases the connection along with the sender.
+	var received int64
+	checksum := transfer.NewChecksum()
+	for attempt := 0; ; attempt++ {
+		n, err := requestPayload(ctx, tc, dst, checksum, received, msgs...)
+		received += n
+		if err == nil {
+			break
+		}
+		if !isDirect || attempt == MAX_RESUME_ATTEMPTS || ctx.Err() != nil || !isConnectionLost(err) {
+			return err
+		}
+		tc, err = probeSender(addr, relay.Key(), transfer.RESUME_TIMEOUT)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Closing handshake.
@@ -85,10 +111,10 @@ func doReceive(ctx context.Context, relay conn.Transfer, addr string, dst io.Wri
 	return nil
 }
 
-// probeSender will try to connect directly to the sender using a linear back off for up to 3 seconds.
+// probeSender will try to connect directly to the sender using an exponential back off for up to the provided timeout.
 // Returns a transfer connection channel if it succeeds, otherwise it returns an error.
-func probeSender(addr string, key []byte) (conn.Transfer, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second) // wait at most 3 seconds.
+func probeSender(addr string, key []byte, timeout time.Duration) (conn.Transfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	d := 250 * time.Millisecond
 	for {
@@ -103,10 +129,22 @@ func probeSender(addr string, key []byte) (conn.Transfer, error) {
 			)
 			if err != nil {
 				time.Sleep(d)
-				d = d * 2
+				if d < MAX_PROBE_BACKOFF {
+					d = d * 2
+				}
 				continue
 			}
 			return conn.TransferFromKey(&conn.WS{Conn: ws}, key), nil
 		}
 	}
 }
+
+// isConnectionLost reports whether the provided error is caused by losing the connection to the sender,
+// as opposed to e.g. failing to write the payload or a checksum mismatch, which resuming does not resolve.
+func isConnectionLost(err error) bool {
+	var opErr *net.OpError
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &opErr) ||
+		websocket.CloseStatus(err) != -1
+}
@@ -0,0 +1,39 @@
+//go:build !js
+
+package receiver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/SpatiumPortae/portal/protocol/transfer"
+	"github.com/stretchr/testify/assert"
+	"nhooyr.io/websocket"
+)
+
+func TestIsConnectionLost(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		lost bool
+	}{
+		{name: "eof", err: fmt.Errorf("failed to get reader: %w", io.EOF), lost: true},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, lost: true},
+		{name: "network error", err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, lost: true},
+		{name: "websocket closed", err: websocket.CloseError{Code: websocket.StatusGoingAway}, lost: true},
+		{name: "checksum mismatch", err: transfer.ChecksumError{Expected: []byte{1}, Got: []byte{2}}, lost: false},
+		{name: "disk full", err: &fs.PathError{Op: "write", Path: "payload", Err: syscall.ENOSPC}, lost: false},
+		{name: "canceled", err: context.Canceled, lost: false},
+		{name: "protocol error", err: transfer.Error{Expected: []transfer.MsgType{transfer.SenderPayloadSent}, Got: transfer.TransferError}, lost: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.lost, isConnectionLost(tc.err))
+		})
+	}
+}
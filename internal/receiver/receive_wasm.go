@@ -28,10 +28,7 @@ func doReceive(ctx context.Context, relayTc conn.Transfer, addr string, dst io.W
 	}
 
 	// Request the payload and receive it.
-	if relayTc.WriteMsg(ctx, transfer.Msg{Type: transfer.ReceiverRequestPayload}) != nil {
-		return err
-	}
-	if err := receivePayload(ctx, relayTc, dst, msgs...); err != nil {
+	if _, err := requestPayload(ctx, relayTc, dst, transfer.NewChecksum(), 0, msgs...); err != nil {
 		return err
 	}
 
@@ -1,28 +1,143 @@
 package receiver
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 
 	"github.com/SpatiumPortae/portal/internal/conn"
+	"github.com/SpatiumPortae/portal/internal/file"
 	"github.com/SpatiumPortae/portal/internal/password"
+	"github.com/SpatiumPortae/portal/internal/relay"
+	"github.com/SpatiumPortae/portal/internal/throttle"
 	"github.com/SpatiumPortae/portal/protocol/rendezvous"
 	"github.com/SpatiumPortae/portal/protocol/transfer"
 	"github.com/schollz/pake/v3"
-	"nhooyr.io/websocket"
 )
 
+// EstimatedPayloadSize is communicated instead of the payload size when the sender
+// produces the payload while sending it, and the size of the payload is only an estimate.
+type EstimatedPayloadSize int64
+
+// ErrNotArchive is returned when a payload that is not an archive of files is received into an ArchiveDestination.
+var ErrNotArchive = errors.New("the payload is not an archive of files")
+
+// TypedDestination is implemented by destinations that handle the payload according to its type. The type and name
+// of the payload announced by the sender are set before the payload is received, receiving is aborted if it fails.
+type TypedDestination interface {
+	io.Writer
+	SetPayloadType(payloadType transfer.PayloadType, name string) error
+}
+
+// SizedDestination is implemented by destinations that make use of the size of the payload announced by the
+// sender, which is set before the payload is received.
+type SizedDestination interface {
+	io.Writer
+	SetPayloadSize(size int64)
+}
+
+// Destination is a TypedDestination that records the type and name of the payload written to it.
+type Destination struct {
+	io.Writer
+	Type transfer.PayloadType
+	Name string
+}
+
+func (d *Destination) SetPayloadType(payloadType transfer.PayloadType, name string) error {
+	d.Type, d.Name = payloadType, name
+	return nil
+}
+
+// ArchiveDestination is a TypedDestination that only accepts archives of files, such as the stream of an
+// unpacker unpacking the files while they are being received.
+type ArchiveDestination struct {
+	io.Writer
+}
+
+// SetPayloadSize sets the size of the payload on the underlying writer, if it is a SizedDestination.
+func (d ArchiveDestination) SetPayloadSize(size int64) {
+	if sized, ok := d.Writer.(SizedDestination); ok {
+		sized.SetPayloadSize(size)
+	}
+}
+
+func (d ArchiveDestination) SetPayloadType(payloadType transfer.PayloadType, name string) error {
+	if payloadType != transfer.ArchivePayload {
+		return ErrNotArchive
+	}
+	return nil
+}
+
+// Output is a TypedDestination that writes the payload into the provided writer while it is received, instead
+// of staging it to be unpacked. Text and raw payloads are written as they are, while archives are decompressed.
+// Archives of a single file are written as the content of the file, other archives as an uncompressed tar archive.
+// The payload is written before its checksum is verified. The output must be closed once receiving returns.
+type Output struct {
+	w       io.Writer
+	archive io.WriteCloser
+}
+
+// NewOutput creates an output writing the payload into the provided writer.
+func NewOutput(w io.Writer) *Output {
+	return &Output{w: w}
+}
+
+func (o *Output) SetPayloadType(payloadType transfer.PayloadType, name string) error {
+	if payloadType == transfer.ArchivePayload {
+		o.archive = file.NewArchiveWriter(o.w, name != "")
+	}
+	return nil
+}
+
+func (o *Output) Write(p []byte) (int, error) {
+	if o.archive != nil {
+		return o.archive.Write(p)
+	}
+	return o.w.Write(p)
+}
+
+// Close waits for the decompressed archive to be written, and returns any error doing so.
+func (o *Output) Close() error {
+	if o.archive != nil {
+		return o.archive.Close()
+	}
+	return nil
+}
+
 // ConnectRendezvous makes the initial connection to the rendezvous server.
-func ConnectRendezvous(addr string) (conn.Rendezvous, error) {
-	ws, _, err := websocket.Dial(context.Background(), fmt.Sprintf("ws://%s/establish-receiver", addr), nil)
+func ConnectRendezvous(addr string, opts ...relay.Option) (conn.Rendezvous, error) {
+	ws, err := relay.DialWS(context.Background(), addr, "/establish-receiver", opts...)
 	if err != nil {
 		return conn.Rendezvous{}, err
 	}
 	return conn.Rendezvous{Conn: &conn.WS{Conn: ws}}, nil
 }
 
+// ListenRendezvous makes the initial connection to the rendezvous server, and acquires a password associated with
+// the connection, generated using the provided generator. The sender uses the password to join the connection.
+func ListenRendezvous(ctx context.Context, addr string, gen password.Generator, opts ...relay.Option) (conn.Rendezvous, string, error) {
+	rc, err := ConnectRendezvous(addr, opts...)
+	if err != nil {
+		return conn.Rendezvous{}, "", err
+	}
+	if err := rc.WriteMsg(ctx, rendezvous.Msg{Type: rendezvous.ReceiverToRendezvousListen}); err != nil {
+		return conn.Rendezvous{}, "", err
+	}
+	msg, err := rc.ReadMsg(ctx, rendezvous.RendezvousToReceiverBind)
+	if err != nil {
+		return conn.Rendezvous{}, "", err
+	}
+	pass, err := gen.Generate(msg.Payload.ID)
+	if err != nil {
+		return conn.Rendezvous{}, "", err
+	}
+	return rc, pass, nil
+}
+
 // SecureConnection performs the cryptographic handshake to resolve a secure connection.
 func SecureConnection(ctx context.Context, rc conn.Rendezvous, pass string) (conn.Transfer, error) {
 	// Convenience for messaging in this function.
@@ -38,9 +153,12 @@ func SecureConnection(ctx context.Context, rc conn.Rendezvous, pass string) (con
 		pakeCh <- pakeMsg{pake: p, err: err}
 	}()
 
+	// The id lets the rendezvous server count failed attempts against the password it is prefixed to.
+	id, _ := password.ID(pass)
 	if err := rc.WriteMsg(ctx, rendezvous.Msg{
 		Type: rendezvous.ReceiverToRendezvousEstablish,
 		Payload: rendezvous.Payload{
+			ID:       id,
 			Password: password.Hashed(pass),
 		},
 	}); err != nil {
@@ -87,7 +205,10 @@ func SecureConnection(ctx context.Context, rc conn.Rendezvous, pass string) (con
 
 // Receive receives the payload over the transfer connection and writes it into the provided destination.
 // The Transfer can either be direct or using a relay.
+// The transfer is throttled to the limit of the context, see throttle.WithLimit.
 // The msgs channel communicates information about the receiving process while running.
+// If the destination implements TypedDestination, the type of the payload is set on it before receiving,
+// and likewise the size of the payload if it implements SizedDestination.
 func Receive(ctx context.Context, tc conn.Transfer, dst io.Writer, msgs ...chan interface{}) error {
 	if err := tc.WriteMsg(ctx, transfer.Msg{Type: transfer.ReceiverHandshake}); err != nil {
 		return err
@@ -99,36 +220,78 @@ func Receive(ctx context.Context, tc conn.Transfer, dst io.Writer, msgs ...chan
 	}
 
 	if len(msgs) > 0 {
-		msgs[0] <- msg.Payload.PayloadSize
+		if msg.Payload.PayloadSizeEstimated {
+			msgs[0] <- EstimatedPayloadSize(msg.Payload.PayloadSize)
+		} else {
+			msgs[0] <- msg.Payload.PayloadSize
+		}
+	}
+	if typed, ok := dst.(TypedDestination); ok {
+		if err := typed.SetPayloadType(msg.Payload.PayloadType, msg.Payload.PayloadName); err != nil {
+			return err
+		}
+	}
+	if sized, ok := dst.(SizedDestination); ok {
+		sized.SetPayloadSize(msg.Payload.PayloadSize)
 	}
 	return doReceive(ctx, tc, fmt.Sprintf("%s:%d", msg.Payload.IP, msg.Payload.Port), dst, msgs...)
 }
 
+// requestPayload requests the payload, starting from the provided offset, and receives it
+// into the provided destination. Returns the amount of bytes received.
+func requestPayload(ctx context.Context, tc conn.Transfer, dst io.Writer, checksum hash.Hash, offset int64, msgs ...chan interface{}) (int64, error) {
+	if err := tc.WriteMsg(ctx, transfer.Msg{
+		Type: transfer.ReceiverRequestPayload,
+		Payload: transfer.Payload{
+			Offset: offset,
+		},
+	}); err != nil {
+		return 0, err
+	}
+	return receivePayload(ctx, tc, dst, checksum, offset, msgs...)
+}
+
 // receivePayload receives the payload over the provided connection and writes it into the desired location.
-func receivePayload(ctx context.Context, tc conn.Transfer, dst io.Writer, msgs ...chan interface{}) error {
-	writtenBytes := 0
+// The offset specifies how many bytes of the payload that has been received previously. Received bytes are
+// written to the provided checksum, which is verified against the checksum announced by the sender.
+// The payload is received at the rate limited by the context. Returns the amount of bytes received.
+func receivePayload(ctx context.Context, tc conn.Transfer, dst io.Writer, checksum hash.Hash, offset int64, msgs ...chan interface{}) (int64, error) {
+	var writtenBytes int64
 	for {
 		b, err := tc.ReadRaw(ctx)
 		if err != nil {
-			return err
+			return writtenBytes, err
 		}
 		msg := transfer.Msg{}
 		err = json.Unmarshal(b, &msg)
 		if err != nil {
+			if err := throttle.Wait(ctx, len(b)); err != nil {
+				return writtenBytes, err
+			}
 			n, err := dst.Write(b)
+			writtenBytes += int64(n)
+			checksum.Write(b[:n])
 			if err != nil {
-				return err
+				return writtenBytes, err
 			}
-			writtenBytes += n
 			if len(msgs) > 0 {
-				msgs[0] <- writtenBytes
+				msgs[0] <- int(offset + writtenBytes)
 			}
 		} else {
 			if msg.Type != transfer.SenderPayloadSent {
-				return transfer.Error{Expected: []transfer.MsgType{transfer.SenderPayloadSent}, Got: msg.Type}
+				return writtenBytes, transfer.Error{Expected: []transfer.MsgType{transfer.SenderPayloadSent}, Got: msg.Type}
+			}
+			// Older senders do not announce a checksum.
+			if len(msg.Payload.Checksum) == 0 {
+				break
+			}
+			if sum := checksum.Sum(nil); !bytes.Equal(sum, msg.Payload.Checksum) {
+				// Let the sender know that the payload was rejected, instead of acknowledging it.
+				_ = tc.WriteMsg(ctx, transfer.Msg{Type: transfer.ReceiverChecksumMismatch})
+				return writtenBytes, transfer.ChecksumError{Expected: msg.Payload.Checksum, Got: sum}
 			}
 			break
 		}
 	}
-	return nil
+	return writtenBytes, nil
 }
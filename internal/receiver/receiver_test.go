@@ -0,0 +1,141 @@
+package receiver
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/SpatiumPortae/portal/internal/conn"
+	"github.com/SpatiumPortae/portal/protocol/transfer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockConn is one end of an in-memory connection.
+type mockConn struct {
+	in  chan []byte
+	out chan []byte
+}
+
+func (m mockConn) Write(ctx context.Context, b []byte) error {
+	m.out <- b
+	return nil
+}
+
+func (m mockConn) Read(ctx context.Context) ([]byte, error) {
+	return <-m.in, nil
+}
+
+// transferPipe returns both ends of an in-memory transfer connection.
+func transferPipe(t *testing.T) (conn.Transfer, conn.Transfer) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	a, b := make(chan []byte, 100), make(chan []byte, 100)
+	return conn.TransferFromKey(mockConn{in: a, out: b}, key), conn.TransferFromKey(mockConn{in: b, out: a}, key)
+}
+
+func TestReceivePayload(t *testing.T) {
+	payload := make([]byte, 10000)
+	_, err := rand.Read(payload)
+	require.NoError(t, err)
+	sum := sha256.Sum256(payload)
+	corrupted := sha256.Sum256(append([]byte{0}, payload...))
+
+	tests := []struct {
+		name     string
+		offset   int
+		checksum []byte
+		mismatch bool
+	}{
+		{name: "matching checksum", checksum: sum[:]},
+		{name: "matching checksum from offset", offset: 4000, checksum: sum[:]},
+		{name: "mismatching checksum", checksum: corrupted[:], mismatch: true},
+		{name: "sender without checksum", checksum: nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			senderTc, receiverTc := transferPipe(t)
+
+			// The checksum covers the part of the payload received before resuming.
+			checksum := transfer.NewChecksum()
+			checksum.Write(payload[:tc.offset])
+
+			require.NoError(t, senderTc.WriteRaw(ctx, payload[tc.offset:]))
+			require.NoError(t, senderTc.WriteMsg(ctx, transfer.Msg{
+				Type:    transfer.SenderPayloadSent,
+				Payload: transfer.Payload{Checksum: tc.checksum},
+			}))
+
+			dst := &bytes.Buffer{}
+			n, err := receivePayload(ctx, receiverTc, dst, checksum, int64(tc.offset))
+			assert.Equal(t, int64(len(payload)-tc.offset), n)
+			assert.True(t, bytes.Equal(payload[tc.offset:], dst.Bytes()), "received payload differs")
+			if !tc.mismatch {
+				assert.NoError(t, err)
+				return
+			}
+			var checksumErr transfer.ChecksumError
+			require.ErrorAs(t, err, &checksumErr)
+			assert.Equal(t, tc.checksum, checksumErr.Expected)
+
+			// The sender is told that the payload was rejected.
+			msg, err := senderTc.ReadMsg(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, transfer.ReceiverChecksumMismatch, msg.Type)
+		})
+	}
+}
+
+func TestReceiveArchiveDestination(t *testing.T) {
+	ctx := context.Background()
+	senderTc, receiverTc := transferPipe(t)
+	require.NoError(t, senderTc.WriteMsg(ctx, transfer.Msg{
+		Type:    transfer.SenderHandshake,
+		Payload: transfer.Payload{PayloadSize: 4, PayloadType: transfer.TextPayload},
+	}))
+
+	// Payloads that are not archives are rejected before they are received.
+	dst := &bytes.Buffer{}
+	err := Receive(ctx, receiverTc, ArchiveDestination{Writer: dst})
+	assert.ErrorIs(t, err, ErrNotArchive)
+	assert.Zero(t, dst.Len())
+}
+
+// sizedWriter is a SizedDestination recording the size of the payload.
+type sizedWriter struct {
+	bytes.Buffer
+	size int64
+}
+
+func (w *sizedWriter) SetPayloadSize(size int64) {
+	w.size = size
+}
+
+func TestArchiveDestinationPayloadSize(t *testing.T) {
+	// The size of the payload is passed on to sized writers, such as the stream of a stream unpacker.
+	w := &sizedWriter{}
+	ArchiveDestination{Writer: w}.SetPayloadSize(42)
+	assert.Equal(t, int64(42), w.size)
+	ArchiveDestination{Writer: &bytes.Buffer{}}.SetPayloadSize(42)
+}
+
+func TestOutput(t *testing.T) {
+	// Text and raw payloads are written as they are.
+	out := &bytes.Buffer{}
+	o := NewOutput(out)
+	require.NoError(t, o.SetPayloadType(transfer.TextPayload, ""))
+	_, err := o.Write([]byte("hello portal"))
+	require.NoError(t, err)
+	require.NoError(t, o.Close())
+	assert.Equal(t, "hello portal", out.String())
+
+	// Archives are decompressed.
+	o = NewOutput(&bytes.Buffer{})
+	require.NoError(t, o.SetPayloadType(transfer.ArchivePayload, "hello.txt"))
+	_, _ = o.Write([]byte("not an archive"))
+	assert.Error(t, o.Close())
+}
@@ -0,0 +1,14 @@
+//go:build !js
+
+package relay
+
+import (
+	"net/http"
+
+	"nhooyr.io/websocket"
+)
+
+// dialOptions returns the options for dialing a websocket using the provided client and headers.
+func dialOptions(client *http.Client, header http.Header) *websocket.DialOptions {
+	return &websocket.DialOptions{HTTPClient: client, HTTPHeader: header}
+}
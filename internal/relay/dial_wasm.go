@@ -0,0 +1,15 @@
+//go:build js
+
+package relay
+
+import (
+	"net/http"
+
+	"nhooyr.io/websocket"
+)
+
+// dialOptions returns the options for dialing a websocket. In the browser, the TLS connection
+// is established by the browser, and neither the provided client nor headers are used.
+func dialOptions(_ *http.Client, _ http.Header) *websocket.DialOptions {
+	return nil
+}
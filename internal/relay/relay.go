@@ -0,0 +1,191 @@
+// Package relay resolves the addresses of relay (rendezvous) servers, and connects to them.
+//
+// A relay address may be prefixed with a scheme, selecting whether the relay is reached over TLS:
+//   - wss:// or https:// always use TLS.
+//   - ws:// or http:// never use TLS.
+//   - addresses without a scheme are auto-detected, TLS is attempted first with a fallback to plaintext
+//     if the relay does not speak TLS. Addresses without a port also fall back to plaintext if the TLS
+//     port can not be reached, as the default ports of TLS and plaintext differ. Use a wss:// address to
+//     rule out plaintext.
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"nhooyr.io/websocket"
+)
+
+// Scheme describes how a relay is reached.
+type Scheme int
+
+const (
+	Auto   Scheme = iota // TLS is attempted first, falling back to plaintext.
+	Secure               // TLS is required.
+	Plain                // TLS is not used.
+)
+
+// Addr is a parsed relay address.
+type Addr struct {
+	Scheme Scheme
+	Host   string // host, port and optional path prefix of the relay.
+}
+
+// ErrUnauthorized is returned when the relay rejects the connection, as the relay requires
+// a token and no valid token was provided.
+var ErrUnauthorized = errors.New("relay requires authentication, the relay token is missing or invalid")
+
+// resolved caches the scheme used to reach auto-detected relays.
+var resolved sync.Map
+
+// errHTTPResponse is the message of the error returned by net/http when a TLS handshake
+// is answered by a plaintext HTTP response.
+const errHTTPResponse = "server gave HTTP response to HTTPS client"
+
+// ParseAddr parses the provided relay address.
+func ParseAddr(addr string) (Addr, error) {
+	scheme, host, found := strings.Cut(addr, "://")
+	if !found {
+		return Addr{Scheme: Auto, Host: strings.TrimSuffix(addr, "/")}, nil
+	}
+	host = strings.TrimSuffix(host, "/")
+	if host == "" {
+		return Addr{}, fmt.Errorf("relay address %q is missing a host", addr)
+	}
+	switch strings.ToLower(scheme) {
+	case "wss", "https":
+		return Addr{Scheme: Secure, Host: host}, nil
+	case "ws", "http":
+		return Addr{Scheme: Plain, Host: host}, nil
+	default:
+		return Addr{}, fmt.Errorf("relay address %q has unsupported scheme %q", addr, scheme)
+	}
+}
+
+// WS returns the websocket URL of the provided path on the relay.
+func (a Addr) WS(path string) string {
+	if a.Scheme == Plain {
+		return fmt.Sprintf("ws://%s%s", a.Host, path)
+	}
+	return fmt.Sprintf("wss://%s%s", a.Host, path)
+}
+
+// HTTP returns the HTTP URL of the provided path on the relay.
+func (a Addr) HTTP(path string) string {
+	if a.Scheme == Plain {
+		return fmt.Sprintf("http://%s%s", a.Host, path)
+	}
+	return fmt.Sprintf("https://%s%s", a.Host, path)
+}
+
+// DialWS dials the websocket endpoint at the provided path on the relay with the provided address.
+func DialWS(ctx context.Context, addr string, path string, opts ...Option) (*websocket.Conn, error) {
+	var ws *websocket.Conn
+	err := try(addr, opts, func(a Addr, client *http.Client, header http.Header) error {
+		var r *http.Response
+		var err error
+		ws, r, err = websocket.Dial(ctx, a.WS(path), dialOptions(client, header))
+		if r != nil && r.StatusCode == http.StatusUnauthorized {
+			return ErrUnauthorized
+		}
+		return err
+	})
+	return ws, err
+}
+
+// Get issues a GET request to the provided path on the relay with the provided address.
+func Get(ctx context.Context, addr string, path string, opts ...Option) (*http.Response, error) {
+	var r *http.Response
+	err := try(addr, opts, func(a Addr, client *http.Client, header http.Header) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.HTTP(path), nil)
+		if err != nil {
+			return err
+		}
+		req.Header = header
+		r, err = client.Do(req)
+		if err == nil && r.StatusCode == http.StatusUnauthorized {
+			r.Body.Close()
+			return ErrUnauthorized
+		}
+		return err
+	})
+	return r, err
+}
+
+// try calls the provided function with the parsed relay address, and a client configured by the provided options.
+// Auto-detected addresses are tried using TLS first, and only fall back to plaintext if the relay is not speaking
+// TLS, or can not be reached on the TLS port when the address has no port, and no TLS options are provided. The scheme that worked is remembered.
+func try(addr string, opts []Option, f func(a Addr, client *http.Client, header http.Header) error) error {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	a, err := ParseAddr(addr)
+	if err != nil {
+		return err
+	}
+	client, err := o.client(a.Host)
+	if err != nil {
+		return err
+	}
+	call := func(a Addr) error {
+		err := f(a, client, o.header())
+		// Report pin mismatches as is, rather than wrapped in dialing errors.
+		var pinErr PinError
+		if errors.As(err, &pinErr) {
+			return pinErr
+		}
+		return err
+	}
+	switch {
+	case a.Scheme == Plain && o.secure():
+		return fmt.Errorf("relay address %q does not use TLS, which is required by the relay CA, certificate pin and token", addr)
+	case a.Scheme == Auto && o.secure():
+		return call(Addr{Scheme: Secure, Host: a.Host})
+	case a.Scheme != Auto:
+		return call(a)
+	}
+	if scheme, ok := resolved.Load(a.Host); ok {
+		return call(Addr{Scheme: scheme.(Scheme), Host: a.Host})
+	}
+	secureErr := call(Addr{Scheme: Secure, Host: a.Host})
+	if secureErr == nil {
+		resolved.Store(a.Host, Secure)
+		return nil
+	}
+	if !isNotTLS(secureErr) && !(isDialErr(secureErr) && !hasPort(a.Host)) {
+		return secureErr
+	}
+	log.Printf("relay %s does not support TLS, falling back to an unencrypted connection", a.Host)
+	if err := call(Addr{Scheme: Plain, Host: a.Host}); err != nil {
+		return fmt.Errorf("%w (using TLS: %v)", err, secureErr)
+	}
+	resolved.Store(a.Host, Plain)
+	return nil
+}
+
+// isDialErr reports whether the provided error is caused by failing to connect to the relay.
+func isDialErr(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// hasPort reports whether the host of the provided relay address includes a port.
+func hasPort(host string) bool {
+	host, _, _ = strings.Cut(host, "/")
+	_, _, err := net.SplitHostPort(host)
+	return err == nil
+}
+
+// isNotTLS reports whether the provided error is caused by the relay answering a TLS handshake without TLS.
+func isNotTLS(err error) bool {
+	var recordErr tls.RecordHeaderError
+	return errors.As(err, &recordErr) || strings.Contains(err.Error(), errHTTPResponse)
+}
@@ -0,0 +1,155 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+)
+
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected Addr
+		err      bool
+	}{
+		{addr: "myrelay.io:1234", expected: Addr{Scheme: Auto, Host: "myrelay.io:1234"}},
+		{addr: ":8080", expected: Addr{Scheme: Auto, Host: ":8080"}},
+		{addr: "wss://myrelay.io/", expected: Addr{Scheme: Secure, Host: "myrelay.io"}},
+		{addr: "https://myrelay.io/portal", expected: Addr{Scheme: Secure, Host: "myrelay.io/portal"}},
+		{addr: "ws://myrelay.io", expected: Addr{Scheme: Plain, Host: "myrelay.io"}},
+		{addr: "HTTP://myrelay.io:80", expected: Addr{Scheme: Plain, Host: "myrelay.io:80"}},
+		{addr: "ftp://myrelay.io", err: true},
+		{addr: "wss://", err: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.addr, func(t *testing.T) {
+			a, err := ParseAddr(tc.addr)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, a)
+		})
+	}
+}
+
+// newRelay starts a relay accepting websocket connections, returning its host.
+func newRelay(t *testing.T, secure bool) string {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		ws.Close(websocket.StatusNormalClosure, "")
+	})
+	var ts *httptest.Server
+	if secure {
+		ts = httptest.NewTLSServer(handler)
+		// Trust the certificate of the test server.
+		transport := http.DefaultClient.Transport
+		http.DefaultClient.Transport = ts.Client().Transport
+		t.Cleanup(func() { http.DefaultClient.Transport = transport })
+	} else {
+		ts = httptest.NewServer(handler)
+	}
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	return u.Host
+}
+
+func TestDialWS(t *testing.T) {
+	tests := []struct {
+		name     string
+		secure   bool
+		scheme   string
+		resolved Scheme
+		err      bool
+	}{
+		{name: "auto-detected TLS relay", secure: true, resolved: Secure},
+		{name: "auto-detected plain relay", secure: false, resolved: Plain},
+		{name: "wss against TLS relay", secure: true, scheme: "wss://"},
+		{name: "ws against plain relay", secure: false, scheme: "ws://"},
+		{name: "wss against plain relay", secure: false, scheme: "wss://", err: true},
+		{name: "ws against TLS relay", secure: true, scheme: "ws://", err: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			host := newRelay(t, tc.secure)
+			ws, err := DialWS(context.Background(), tc.scheme+host, "/")
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			ws.Close(websocket.StatusNormalClosure, "")
+			if tc.scheme == "" {
+				scheme, ok := resolved.Load(host)
+				require.True(t, ok)
+				assert.Equal(t, tc.resolved, scheme)
+			}
+		})
+	}
+}
+
+func TestTryDoesNotDowngradeOnOtherErrors(t *testing.T) {
+	// A TLS relay with a certificate that is not trusted must not be reached using plaintext.
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	var schemes []Scheme
+	err = try(u.Host, nil, func(a Addr, client *http.Client, _ http.Header) error {
+		schemes = append(schemes, a.Scheme)
+		_, _, err := websocket.Dial(context.Background(), a.WS("/"), &websocket.DialOptions{HTTPClient: client})
+		return err
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []Scheme{Secure}, schemes)
+	_, ok := resolved.Load(u.Host)
+	assert.False(t, ok)
+}
+
+func TestTryFallsBackWithoutPort(t *testing.T) {
+	// The relay only listens on the plaintext port, connecting to the TLS port is refused.
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	tests := []struct {
+		host    string
+		schemes []Scheme
+		err     bool
+	}{
+		{host: "plain-only.relay.test", schemes: []Scheme{Secure, Plain}},
+		{host: "plain-only.relay.test/portal", schemes: []Scheme{Secure, Plain}},
+		{host: "plain-only.relay.test:1234", schemes: []Scheme{Secure}, err: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.host, func(t *testing.T) {
+			var schemes []Scheme
+			err := try(tc.host, nil, func(a Addr, _ *http.Client, _ http.Header) error {
+				schemes = append(schemes, a.Scheme)
+				if a.Scheme == Secure {
+					return fmt.Errorf("failed to WebSocket dial: %w", &url.Error{Op: "Get", URL: a.WS("/"), Err: refused})
+				}
+				return nil
+			})
+			assert.Equal(t, tc.schemes, schemes)
+			if tc.err {
+				assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+				return
+			}
+			require.NoError(t, err)
+			resolved.Delete(tc.host)
+		})
+	}
+}
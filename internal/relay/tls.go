@@ -0,0 +1,138 @@
+package relay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Option configures the connections to a relay.
+type Option func(o *options)
+
+type options struct {
+	caFile string
+	pin    string
+	token  string
+	extra  http.Header
+}
+
+// WithCA makes the certificate of the relay be verified using the certificate authorities in the
+// provided PEM file, in addition to the system roots.
+func WithCA(file string) Option {
+	return func(o *options) {
+		o.caFile = file
+	}
+}
+
+// WithPin requires the certificate of the relay to have the provided hex encoded SHA-256 fingerprint,
+// as printed by "openssl x509 -noout -fingerprint -sha256". Unless a CA is provided as well, the pinned
+// certificate is trusted without verifying its chain, so that self-signed certificates can be pinned.
+func WithPin(fingerprint string) Option {
+	return func(o *options) {
+		o.pin = fingerprint
+	}
+}
+
+// WithToken authenticates to the relay using the provided bearer token.
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// WithHeader sends the provided header with every request to the relay.
+func WithHeader(key string, value string) Option {
+	return func(o *options) {
+		if o.extra == nil {
+			o.extra = http.Header{}
+		}
+		o.extra.Set(key, value)
+	}
+}
+
+// header returns the headers sent with every request to the relay.
+func (o options) header() http.Header {
+	header := o.extra.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if o.token != "" {
+		header.Set("Authorization", "Bearer "+o.token)
+	}
+	return header
+}
+
+// PinError is returned when the certificate of a relay does not match the pinned fingerprint.
+type PinError struct {
+	Host     string
+	Expected []byte
+	Got      []byte
+}
+
+func (e PinError) Error() string {
+	return fmt.Sprintf("certificate of relay %s does not match the pinned fingerprint, expected: (%x), got: (%x)", e.Host, e.Expected, e.Got)
+}
+
+// secure reports whether the options require the relay to be reached over TLS. Tokens require TLS
+// as well, so that they are never sent in plaintext.
+func (o options) secure() bool {
+	return o.caFile != "" || o.pin != "" || o.token != ""
+}
+
+// client returns the HTTP client used to reach the relay with the provided host using the options.
+func (o options) client(host string) (*http.Client, error) {
+	if o.caFile == "" && o.pin == "" {
+		return http.DefaultClient, nil
+	}
+	config := &tls.Config{}
+	if o.caFile != "" {
+		pem, err := os.ReadFile(o.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading relay CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in relay CA file %s", o.caFile)
+		}
+		config.RootCAs = pool
+	}
+	if o.pin != "" {
+		pin, err := parsePin(o.pin)
+		if err != nil {
+			return nil, err
+		}
+		// The chain is verified by the standard verification when a CA is provided.
+		config.InsecureSkipVerify = o.caFile == ""
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return PinError{Host: host, Expected: pin}
+			}
+			got := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			if !bytes.Equal(pin, got[:]) {
+				return PinError{Host: host, Expected: pin, Got: got[:]}
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return &http.Client{Transport: transport}, nil
+}
+
+// parsePin parses a hex encoded SHA-256 fingerprint, optionally separated by colons.
+func parsePin(fingerprint string) ([]byte, error) {
+	pin, err := hex.DecodeString(strings.ReplaceAll(fingerprint, ":", ""))
+	if err != nil || len(pin) != sha256.Size {
+		return nil, fmt.Errorf("invalid relay certificate pin %q, expected a hex encoded SHA-256 fingerprint", fingerprint)
+	}
+	return pin, nil
+}
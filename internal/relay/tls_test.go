@@ -0,0 +1,108 @@
+package relay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTLSRelay starts a relay with a self-signed certificate, returning its host and certificate fingerprint.
+func newTLSRelay(t *testing.T) (*httptest.Server, string, [sha256.Size]byte) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("pong"))
+	}))
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	return ts, u.Host, sha256.Sum256(ts.Certificate().Raw)
+}
+
+func TestPin(t *testing.T) {
+	_, host, fingerprint := newTLSRelay(t)
+
+	// Colon separated fingerprints, as printed by openssl, are accepted.
+	var colons []string
+	for _, b := range fingerprint {
+		colons = append(colons, strings.ToUpper(hex.EncodeToString([]byte{b})))
+	}
+	for _, pin := range []string{hex.EncodeToString(fingerprint[:]), strings.Join(colons, ":")} {
+		r, err := Get(context.Background(), host, "/ping", WithPin(pin))
+		require.NoError(t, err)
+		r.Body.Close()
+	}
+
+	wrong := sha256.Sum256([]byte("another certificate"))
+	_, err := Get(context.Background(), host, "/ping", WithPin(hex.EncodeToString(wrong[:])))
+	var pinErr PinError
+	require.ErrorAs(t, err, &pinErr)
+	assert.Equal(t, wrong[:], pinErr.Expected)
+	assert.Equal(t, fingerprint[:], pinErr.Got)
+
+	_, err = Get(context.Background(), host, "/ping", WithPin("not a fingerprint"))
+	assert.Error(t, err)
+}
+
+func TestCA(t *testing.T) {
+	ts, host, _ := newTLSRelay(t)
+
+	// The self-signed certificate of the relay is not trusted by default.
+	_, err := Get(context.Background(), "wss://"+host, "/ping")
+	assert.Error(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0644))
+	r, err := Get(context.Background(), host, "/ping", WithCA(caFile))
+	require.NoError(t, err)
+	r.Body.Close()
+
+	_, err = Get(context.Background(), host, "/ping", WithCA(filepath.Join(t.TempDir(), "missing.pem")))
+	assert.Error(t, err)
+}
+
+func TestTLSOptionsRequireTLS(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	pin := hex.EncodeToString(make([]byte, sha256.Size))
+
+	// With TLS options, a relay that does not speak TLS is not reached using plaintext.
+	_, err = Get(context.Background(), u.Host, "/", WithPin(pin))
+	assert.Error(t, err)
+	_, ok := resolved.Load(u.Host)
+	assert.False(t, ok)
+
+	_, err = Get(context.Background(), "ws://"+u.Host, "/", WithPin(pin))
+	assert.Error(t, err)
+}
+
+func TestTokenRequiresTLS(t *testing.T) {
+	var authorized bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorized = authorized || r.Header.Get("Authorization") != ""
+	}))
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	// The token is not sent to a relay that does not speak TLS, even if the relay was reached using plaintext before.
+	r, err := Get(context.Background(), u.Host, "/")
+	require.NoError(t, err)
+	r.Body.Close()
+	_, err = Get(context.Background(), u.Host, "/", WithToken("secret"))
+	assert.Error(t, err)
+	_, err = Get(context.Background(), "ws://"+u.Host, "/", WithToken("secret"))
+	assert.Error(t, err)
+	assert.False(t, authorized, "token sent in plaintext")
+}
@@ -0,0 +1,129 @@
+// admin.go specifies the admin API that operators use to inspect and manage the rendezvous server.
+package rendezvous
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/SpatiumPortae/portal/internal/logger"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+var ErrTerminated = errors.New("the transfer was terminated by the operator of the relay")
+
+// Session describes the communication through a mailbox of the server.
+type Session struct {
+	ID           int       `json:"id"`
+	Created      time.Time `json:"created"`
+	AgeSeconds   float64   `json:"age_seconds"`
+	Stage        string    `json:"stage"`
+	RelayedBytes int64     `json:"relayed_bytes"`
+	SenderIP     string    `json:"sender_ip,omitempty"`
+	ReceiverIP   string    `json:"receiver_ip,omitempty"`
+}
+
+// Status describes the configuration and state of the server.
+type Status struct {
+	Version        string    `json:"version"`
+	Started        time.Time `json:"started"`
+	UptimeSeconds  float64   `json:"uptime_seconds"`
+	TLS            bool      `json:"tls"`
+	Authentication bool      `json:"authentication"`
+	Limits         Limits    `json:"limits"`
+	Mailboxes      int       `json:"mailboxes"`
+	IDs            int       `json:"ids"`
+	Draining       bool      `json:"draining"`
+}
+
+// sessions returns the sessions of the mailboxes established by the connections with bound ids, ordered by id.
+func (s *Server) sessions() []Session {
+	sessions := []Session{}
+	now := time.Now()
+	s.ids.Range(func(key, _ any) bool {
+		id := key.(int)
+		for _, mailbox := range s.mailboxesOf(id) {
+			sess := mailbox.session
+			sess.mu.Lock()
+			sessions = append(sessions, Session{
+				ID:           id,
+				Created:      sess.created,
+				AgeSeconds:   now.Sub(sess.created).Seconds(),
+				Stage:        sess.stage,
+				RelayedBytes: sess.relayed.Load(),
+				SenderIP:     sess.sender.ip,
+				ReceiverIP:   sess.receiver.ip,
+			})
+			sess.mu.Unlock()
+		}
+		return true
+	})
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
+
+// mailboxesOf returns the mailboxes established by the connection with the provided id.
+func (s *Server) mailboxesOf(id int) []*Mailbox {
+	p, ok := s.ids.Password(id)
+	if !ok {
+		return nil
+	}
+	return s.mailboxes.Group(p)
+}
+
+//nolint:errcheck
+func (s *Server) handleAdminStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Status{
+			Version:        s.version.String(),
+			Started:        s.started,
+			UptimeSeconds:  time.Since(s.started).Seconds(),
+			TLS:            s.tlsCert != "",
+			Authentication: len(s.tokens) > 0,
+			Limits:         s.limiter.limits,
+			Mailboxes:      s.mailboxes.Count(),
+			IDs:            s.ids.Count(),
+			Draining:       s.draining.Load(),
+		})
+	}
+}
+
+//nolint:errcheck
+func (s *Server) handleAdminSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.sessions())
+	}
+}
+
+// handleAdminTerminate returns a handler that terminates the sessions of the mailboxes established by the
+// connection with the requested id.
+func (s *Server) handleAdminTerminate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger, err := logger.FromContext(ctx)
+		if err != nil {
+			return
+		}
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "invalid session id", http.StatusBadRequest)
+			return
+		}
+		mailboxes := s.mailboxesOf(id)
+		if len(mailboxes) == 0 {
+			http.Error(w, "no session with the provided id", http.StatusNotFound)
+			return
+		}
+		for _, mailbox := range mailboxes {
+			s.terminate(ctx, mailbox.session, ErrTerminated, logger)
+		}
+		logger.Info("terminated session", zap.Int("id", id), zap.Int("mailboxes", len(mailboxes)))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
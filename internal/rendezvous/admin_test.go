@@ -0,0 +1,115 @@
+package rendezvous
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SpatiumPortae/portal/internal/portal"
+	"github.com/SpatiumPortae/portal/internal/semver"
+	"github.com/SpatiumPortae/portal/protocol/rendezvous"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// adminRequest makes a request to the admin API of the server with the provided relay address.
+func adminRequest(t *testing.T, addr string, method string, path string, token string) *http.Response {
+	req, err := http.NewRequest(method, "http://"+strings.TrimPrefix(addr, "ws://")+path, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	r, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Body.Close() })
+	return r
+}
+
+func TestAdminAuthentication(t *testing.T) {
+	_, addr := newTestServer(t)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, addr, http.MethodGet, "/admin/status", "").StatusCode, "admin API without admin token")
+
+	_, addr = newTestServer(t, WithAdminToken("admin"), WithTokens("client"))
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(t, addr, http.MethodGet, "/admin/status", "").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(t, addr, http.MethodGet, "/admin/status", "client").StatusCode)
+
+	r := adminRequest(t, addr, http.MethodGet, "/admin/status", "admin")
+	require.Equal(t, http.StatusOK, r.StatusCode)
+	var status Status
+	require.NoError(t, json.NewDecoder(r.Body).Decode(&status))
+	assert.Equal(t, semver.Version{}.String(), status.Version)
+	assert.True(t, status.Authentication)
+	assert.False(t, status.TLS)
+}
+
+func TestAdminStatusDraining(t *testing.T) {
+	ctx := context.Background()
+	s, addr := newTestServer(t, WithAdminToken("admin"), WithDrainTimeout(500*time.Millisecond))
+	status := func() Status {
+		r := adminRequest(t, addr, http.MethodGet, "/admin/status", "admin")
+		require.Equal(t, http.StatusOK, r.StatusCode)
+		var status Status
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&status))
+		return status
+	}
+	assert.False(t, status().Draining)
+
+	// A sender waiting for its receiver keeps the server draining until the drain timeout.
+	_, err, _ := portal.Send(ctx, &bytes.Buffer{}, 0, &portal.Config{RendezvousAddr: addr})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(s.sessions()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		s.drain()
+		close(done)
+	}()
+	require.Eventually(t, s.draining.Load, 5*time.Second, 10*time.Millisecond)
+	current := status()
+	assert.True(t, current.Draining)
+	assert.Equal(t, 1, current.Mailboxes)
+	<-done
+}
+
+func TestAdminSessions(t *testing.T) {
+	ctx := context.Background()
+	_, addr := newTestServer(t, WithAdminToken("admin"))
+	sessions := func() []Session {
+		r := adminRequest(t, addr, http.MethodGet, "/admin/sessions", "admin")
+		require.Equal(t, http.StatusOK, r.StatusCode)
+		var sessions []Session
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&sessions))
+		return sessions
+	}
+	assert.Empty(t, sessions())
+
+	_, err, errC := portal.Send(ctx, bytes.NewReader([]byte("payload")), 7, &portal.Config{RendezvousAddr: addr})
+	require.NoError(t, err)
+	var listed []Session
+	require.Eventually(t, func() bool {
+		listed = sessions()
+		return len(listed) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, sessionWaiting, listed[0].Stage)
+	assert.Equal(t, "127.0.0.1", listed[0].SenderIP)
+	assert.Empty(t, listed[0].ReceiverIP)
+
+	id := strconv.Itoa(listed[0].ID)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, addr, http.MethodDelete, "/admin/sessions/"+id+"0", "admin").StatusCode)
+	assert.Equal(t, http.StatusNoContent, adminRequest(t, addr, http.MethodDelete, "/admin/sessions/"+id, "admin").StatusCode)
+
+	// The sender is notified, and the session is gone.
+	select {
+	case err := <-errC:
+		assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrTerminated.Error()})
+	case <-time.After(5 * time.Second):
+		t.Fatal("terminated sender was not disconnected")
+	}
+	assert.Eventually(t, func() bool {
+		return len(sessions()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
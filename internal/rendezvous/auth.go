@@ -0,0 +1,79 @@
+package rendezvous
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/SpatiumPortae/portal/internal/logger"
+)
+
+// LoadTokens loads the tokens accepted by the server from the provided file, containing one token
+// per line, and from the TOKENS_ENV environment variable, containing comma separated tokens.
+// Empty lines and lines starting with '#' in the file are ignored. The file is optional.
+func LoadTokens(file string) ([]string, error) {
+	var tokens []string
+	for _, token := range strings.Split(os.Getenv(TOKENS_ENV), ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	if file == "" {
+		return tokens, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("opening token file: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		token := strings.TrimSpace(scanner.Text())
+		if token == "" || strings.HasPrefix(token, "#") {
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading token file: %w", err)
+	}
+	return tokens, nil
+}
+
+// authenticate returns a middleware that only lets requests carrying one of the provided bearer tokens through.
+// Unauthenticated requests are rejected before being upgraded to websocket connections. Without tokens, every
+// request is let through.
+func authenticate(tokens []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(tokens) == 0 || validToken(r, tokens) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if logger, err := logger.FromContext(r.Context()); err == nil {
+				logger.Warn("rejected unauthenticated request")
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="portal"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		})
+	}
+}
+
+// validToken reports whether the request carries one of the provided bearer tokens.
+func validToken(r *http.Request, tokens []string) bool {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	valid := false
+	for _, accepted := range tokens {
+		// Compare every token in constant time, not to leak which tokens are accepted.
+		if subtle.ConstantTimeCompare([]byte(token), []byte(accepted)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
@@ -0,0 +1,59 @@
+package rendezvous
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SpatiumPortae/portal/internal/relay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+)
+
+func TestLoadTokens(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(file, []byte("# team tokens\nfirst\n\n  second  \n"), 0600))
+	t.Setenv(TOKENS_ENV, "third, fourth,")
+
+	tokens, err := LoadTokens(file)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"third", "fourth", "first", "second"}, tokens)
+
+	_, err = LoadTokens(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestAuthenticate(t *testing.T) {
+	// Tokens are only sent to relays using TLS.
+	_, addr, ca := newTLSTestServer(t, WithTokens("secret", "other"))
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		opts []relay.Option
+		err  error
+	}{
+		{name: "without token", err: relay.ErrUnauthorized},
+		{name: "with wrong token", opts: []relay.Option{relay.WithToken("guess")}, err: relay.ErrUnauthorized},
+		{name: "with token", opts: []relay.Option{relay.WithToken("secret")}},
+		{name: "with another token", opts: []relay.Option{relay.WithToken("other")}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ws, err := relay.DialWS(ctx, addr, "/establish-receiver", append(tc.opts, ca)...)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			ws.Close(websocket.StatusNormalClosure, "")
+		})
+	}
+
+	// The version can be checked without a token.
+	r, err := relay.Get(ctx, addr, "/version", ca)
+	require.NoError(t, err)
+	r.Body.Close()
+}
@@ -0,0 +1,52 @@
+// backend.go specifies the interfaces of the stores keeping track of the mailboxes and connection ids of the server.
+package rendezvous
+
+import "errors"
+
+// ErrUnavailable is returned to clients when the stores of the server fail.
+var ErrUnavailable = errors.New("the relay is temporarily unavailable, try again shortly")
+
+// MailboxStore stores the mailboxes linking senders and receivers, see Mailboxes for the in-process store.
+type MailboxStore interface {
+	// Allocate allocates a group of mailboxes for the provided password with room for the provided amount of
+	// receivers, and returns the first mailbox in the group.
+	Allocate(p string, receivers int) (*Mailbox, error)
+	// Listen allocates a mailbox for the provided password on behalf of a listening receiver.
+	Listen(p string) (*Mailbox, error)
+	// Unlisten deallocates the mailbox of a listening receiver, unless a sender has joined it.
+	Unlisten(p string, m *Mailbox) bool
+	// Join adds a mailbox for an additional sender connection to the group with the provided password.
+	Join(p string) (*Mailbox, error)
+	// Claim reserves a mailbox with the provided password for a receiver.
+	Claim(p string) (*Mailbox, error)
+	// Release deallocates the provided mailbox.
+	Release(p string, m *Mailbox)
+	// Invalidate deallocates the group of mailboxes with the provided password.
+	Invalidate(p string)
+	// Group returns the mailboxes with the provided password.
+	Group(p string) []*Mailbox
+	// Count returns the amount of allocated mailboxes.
+	Count() int
+	// Locate returns the address of the server holding the mailboxes with the provided password, or an
+	// empty address if the mailboxes are held by this server, or do not exist.
+	Locate(p string) (string, error)
+}
+
+// IDStore stores the ids bound to connections, see IDs for the in-process store.
+type IDStore interface {
+	// Bind binds an id to a connection.
+	Bind() (int, error)
+	// Free frees the provided id.
+	Free(id int)
+	// Attach associates the provided id with the password of the mailbox established by its connection.
+	Attach(id int, p string)
+	// Password returns the password of the mailbox established by the connection with the provided id.
+	Password(id int) (string, bool)
+	// Count returns the amount of bound ids.
+	Count() int
+	// Locate returns the address of the server that bound the provided id, or an empty address if the id is
+	// bound by this server, or not bound.
+	Locate(id int) (string, error)
+	// Range calls f for every bound id, until f returns false.
+	Range(f func(key, value any) bool)
+}
@@ -0,0 +1,87 @@
+// clientip.go specifies how the IP addresses of clients are determined, which the limits and the
+// protection against password guessing are keyed on.
+package rendezvous
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// WithTrustedProxies makes the server trust the forwarding headers, X-Forwarded-For and X-Real-Ip, of requests
+// from the provided networks, such as a load balancer in front of the server. Without trusted proxies, the
+// forwarding headers are ignored, as they can be set by anyone.
+func WithTrustedProxies(proxies ...netip.Prefix) Option {
+	return func(s *Server) {
+		s.trustedProxies = proxies
+	}
+}
+
+// ParseTrustedProxies parses a comma separated list of IP addresses and networks in CIDR notation.
+func ParseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, proxy := range strings.Split(list, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, expected an IP address or a network in CIDR notation", proxy)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// clientIP returns the IP address of the client making the request. The address of the connection is used, unless
+// it is a trusted proxy. The proxies append the address that they received the request from to X-Forwarded-For,
+// so the client is the last address that is not a trusted proxy, any addresses before it may be forged.
+func (s *Server) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !s.trustedProxy(ip) {
+		return ip
+	}
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	if len(hops) == 0 {
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-Ip")); realIP != "" {
+			return realIP
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip = hops[i]
+		if !s.trustedProxy(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// trustedProxy reports whether the provided IP address belongs to a trusted proxy.
+func (s *Server) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, proxy := range s.trustedProxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
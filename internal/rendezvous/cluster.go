@@ -0,0 +1,286 @@
+// cluster.go specifies how several rendezvous servers share their mailboxes and connection ids, so that they can be
+// run behind a load balancer.
+package rendezvous
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SpatiumPortae/portal/internal/conn"
+	"github.com/SpatiumPortae/portal/internal/relay"
+	"github.com/SpatiumPortae/portal/protocol/rendezvous"
+	"go.uber.org/zap"
+	"nhooyr.io/websocket"
+)
+
+// STORE_TIMEOUT is the maximum duration of the requests to the store shared by the servers of a cluster.
+const STORE_TIMEOUT = 5 * time.Second
+
+// STORE_TTL is how long the keys of a store backed by an external server, such as RedisStore, are kept. Transfers
+// lasting longer might have their password or id taken by another transfer, which fails to connect to them.
+const STORE_TTL = 24 * time.Hour
+
+// Store is a key-value store shared by the servers of a cluster, such as Redis.
+type Store interface {
+	// SetNX stores the provided value with the provided key, unless the key exists. Returns whether the value was stored.
+	SetNX(ctx context.Context, key string, value string) (bool, error)
+	// Get returns the value with the provided key, and whether the key exists.
+	Get(ctx context.Context, key string) (string, bool, error)
+	// CompareAndDelete deletes the provided key if it holds the provided value.
+	CompareAndDelete(ctx context.Context, key string, value string) error
+}
+
+// MemoryStore is an in-memory Store, which can only be shared by servers running in the same process.
+type MemoryStore struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: map[string]string{}}
+}
+
+func (m *MemoryStore) SetNX(ctx context.Context, key string, value string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.values[key]; ok {
+		return false, nil
+	}
+	m.values[key] = value
+	return true, nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.values[key]
+	return value, ok, nil
+}
+
+func (m *MemoryStore) CompareAndDelete(ctx context.Context, key string, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.values[key] == value {
+		delete(m.values, key)
+	}
+	return nil
+}
+
+// cluster is the store shared by the servers of a cluster, the address of this server in the cluster, and the
+// options for connecting to the other servers.
+type cluster struct {
+	store Store
+	addr  string
+	opts  []relay.Option
+}
+
+// WithCluster makes the server share its mailboxes and connection ids with the other servers using the provided
+// store. The provided address is the relay address that the other servers reach this server on, such as
+// "wss://10.0.0.1:8080". Clients connecting to mailboxes held by another server are forwarded to it, connecting
+// using the provided relay options. When the server requires tokens, its first token is used unless the options
+// provide one. The servers must trust each other as proxies, see WithTrustedProxies, as the forwarded connections
+// carry the address of the client.
+func WithCluster(store Store, addr string, opts ...relay.Option) Option {
+	return func(s *Server) {
+		s.cluster = &cluster{store: store, addr: addr, opts: opts}
+	}
+}
+
+func mailboxKey(p string) string {
+	return "portal/mailbox/" + p
+}
+
+func idKey(id int) string {
+	return fmt.Sprintf("portal/id/%d", id)
+}
+
+// clusterMailboxes holds the mailboxes of this server, and registers the passwords of the mailboxes in the shared
+// store, so that the other servers can locate them.
+type clusterMailboxes struct {
+	*Mailboxes
+	*cluster
+}
+
+func (m *clusterMailboxes) Allocate(p string, receivers int) (*Mailbox, error) {
+	if err := m.register(p); err != nil {
+		return nil, err
+	}
+	mailbox, err := m.Mailboxes.Allocate(p, receivers)
+	if err != nil {
+		m.unregister(p)
+		return nil, err
+	}
+	return mailbox, nil
+}
+
+func (m *clusterMailboxes) Listen(p string) (*Mailbox, error) {
+	if err := m.register(p); err != nil {
+		return nil, err
+	}
+	mailbox, err := m.Mailboxes.Listen(p)
+	if err != nil {
+		m.unregister(p)
+		return nil, err
+	}
+	return mailbox, nil
+}
+
+func (m *clusterMailboxes) Unlisten(p string, mailbox *Mailbox) bool {
+	defer m.unregister(p)
+	return m.Mailboxes.Unlisten(p, mailbox)
+}
+
+func (m *clusterMailboxes) Release(p string, mailbox *Mailbox) {
+	m.Mailboxes.Release(p, mailbox)
+	m.unregister(p)
+}
+
+func (m *clusterMailboxes) Invalidate(p string) {
+	m.Mailboxes.Invalidate(p)
+	m.unregister(p)
+}
+
+func (m *clusterMailboxes) Locate(p string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), STORE_TIMEOUT)
+	defer cancel()
+	addr, ok, err := m.store.Get(ctx, mailboxKey(p))
+	if err != nil {
+		return "", fmt.Errorf("locating mailbox: %w", err)
+	}
+	if !ok || addr == m.addr {
+		return "", nil
+	}
+	return addr, nil
+}
+
+// register registers the password as held by this server, unless it is held by any server.
+func (m *clusterMailboxes) register(p string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), STORE_TIMEOUT)
+	defer cancel()
+	ok, err := m.store.SetNX(ctx, mailboxKey(p), m.addr)
+	if err != nil {
+		return fmt.Errorf("registering mailbox: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("mailbox with password '%s' already exists", p)
+	}
+	return nil
+}
+
+// unregister unregisters the password once this server no longer holds any mailboxes with it.
+func (m *clusterMailboxes) unregister(p string) {
+	if len(m.Mailboxes.Group(p)) > 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), STORE_TIMEOUT)
+	defer cancel()
+	// A password failing to unregister can not be used again, which only affects the sender it was generated for.
+	_ = m.store.CompareAndDelete(ctx, mailboxKey(p), m.addr)
+}
+
+// clusterIDs binds the ids of the connections to this server, which are unique across all servers sharing the store.
+type clusterIDs struct {
+	*IDs
+	*cluster
+}
+
+// Bind binds a random id that is not bound by any server. As the unbound ids are not known, random ids are tried
+// until an unbound one is found, which takes a constant amount of attempts unless most ids of the range are bound.
+func (ids *clusterIDs) Bind() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), STORE_TIMEOUT)
+	defer cancel()
+	for attempt := 0; attempt < MAX_BIND_ATTEMPTS; attempt++ {
+		id, err := ids.random()
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := ids.Load(id); ok {
+			continue
+		}
+		ok, err := ids.store.SetNX(ctx, idKey(id), ids.addr)
+		if err != nil {
+			return 0, fmt.Errorf("binding id %d: %w", id, err)
+		}
+		if ok {
+			ids.Store(id, member)
+			return id, nil
+		}
+	}
+	return 0, ErrNoFreeIDs
+}
+
+func (ids *clusterIDs) Free(id int) {
+	ids.Delete(id)
+	ctx, cancel := context.WithTimeout(context.Background(), STORE_TIMEOUT)
+	defer cancel()
+	// An id failing to be freed is skipped when binding ids, which only leaves a gap in the ids.
+	_ = ids.store.CompareAndDelete(ctx, idKey(id), ids.addr)
+}
+
+func (ids *clusterIDs) Locate(id int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), STORE_TIMEOUT)
+	defer cancel()
+	addr, ok, err := ids.store.Get(ctx, idKey(id))
+	if err != nil {
+		return "", fmt.Errorf("locating id: %w", err)
+	}
+	if !ok || addr == ids.addr {
+		return "", nil
+	}
+	return addr, nil
+}
+
+// proxy forwards the connection of a client to the server with the provided address, which holds the mailboxes that
+// the client connects to. The provided message, already read from the client, is forwarded first.
+func (s *Server) proxy(ctx context.Context, r *http.Request, rc conn.Rendezvous, addr string, msg rendezvous.Msg, logger *zap.Logger) {
+	logger = logger.With(zap.String("upstream", addr))
+	// Any forwarding headers of the client are replaced, as the client might have forged them.
+	opts := []relay.Option{relay.WithHeader("X-Forwarded-For", s.clientIP(r))}
+	if len(s.tokens) > 0 {
+		opts = append(opts, relay.WithToken(s.tokens[0]))
+	}
+	opts = append(opts, s.cluster.opts...)
+	ws, err := relay.DialWS(ctx, addr, r.URL.Path, opts...)
+	if err != nil {
+		logger.Error("connecting to the server holding the mailbox", zap.Error(err))
+		s.reject(ctx, rc, ErrUnavailable, logger)
+		return
+	}
+	defer ws.Close(websocket.StatusNormalClosure, "")
+	upstream := conn.Rendezvous{Conn: &conn.WS{Conn: ws}}
+	if err := upstream.WriteMsg(ctx, msg); err != nil {
+		logger.Error("forwarding message to the server holding the mailbox", zap.Error(err))
+		s.reject(ctx, rc, ErrUnavailable, logger)
+		return
+	}
+	logger.Info("forwarding connection to the server holding the mailbox")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go pipe(ctx, &wg, cancel, rc, upstream)
+	go pipe(ctx, &wg, cancel, upstream, rc)
+	wg.Wait()
+	logger.Info("closing forwarded connection")
+}
+
+// pipe writes the messages read from the source connection to the destination connection, until either fails.
+// The provided cancel function is called once done, stopping the pipe in the other direction.
+func pipe(ctx context.Context, wg *sync.WaitGroup, cancel context.CancelFunc, src conn.Rendezvous, dst conn.Rendezvous) {
+	defer wg.Done()
+	defer cancel()
+	for {
+		b, err := src.ReadRaw(ctx)
+		if err != nil {
+			return
+		}
+		if err := dst.WriteRaw(ctx, b); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package rendezvous
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pw "github.com/SpatiumPortae/portal/internal/password"
+	"github.com/SpatiumPortae/portal/internal/portal"
+	"github.com/SpatiumPortae/portal/internal/relay"
+	"github.com/SpatiumPortae/portal/internal/semver"
+	"github.com/SpatiumPortae/portal/protocol/rendezvous"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newClusterServer starts a rendezvous server sharing the provided store, connecting to the other servers using
+// the provided relay options. Returns its relay address.
+func newClusterServer(t *testing.T, store Store, opts ...relay.Option) (*Server, string) {
+	var s *Server
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.router.ServeHTTP(w, r)
+	}))
+	addr := "ws://" + ts.Listener.Addr().String()
+	s = NewServer(0, semver.Version{}, WithCluster(store, addr, opts...))
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return s, addr
+}
+
+// newTLSClusterServer starts a rendezvous server using TLS sharing the provided store, returning its relay address
+// and the file of the certificate authority of its certificate.
+func newTLSClusterServer(t *testing.T, store Store, opts ...Option) (*Server, string, string) {
+	var s *Server
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.router.ServeHTTP(w, r)
+	}))
+	addr := "wss://" + ts.Listener.Addr().String()
+	s = NewServer(0, semver.Version{}, append(opts, WithCluster(store, addr))...)
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0644))
+	return s, addr, caFile
+}
+
+// testStore tests the semantics of the provided empty store.
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	ok, err := store.SetNX(ctx, "key", "first")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = store.SetNX(ctx, "key", "second")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	value, ok, err := store.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "first", value)
+	_, ok, err = store.Get(ctx, "missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Only the holder of the value deletes the key.
+	require.NoError(t, store.CompareAndDelete(ctx, "key", "second"))
+	_, ok, _ = store.Get(ctx, "key")
+	assert.True(t, ok)
+	require.NoError(t, store.CompareAndDelete(ctx, "key", "first"))
+	_, ok, _ = store.Get(ctx, "key")
+	assert.False(t, ok)
+	require.NoError(t, store.CompareAndDelete(ctx, "missing", "first"))
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestRedisStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store, err := NewRedisStore("redis://" + mr.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	testStore(t, store)
+
+	// Keys expire, so that the keys of servers that stopped are released.
+	_, err = store.SetNX(context.Background(), "key", "value")
+	require.NoError(t, err)
+	mr.FastForward(STORE_TTL)
+	_, ok, err := store.Get(context.Background(), "key")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = NewRedisStore("redis://" + mr.Addr() + "/not-a-db")
+	assert.Error(t, err)
+	addr := mr.Addr()
+	mr.Close()
+	_, err = NewRedisStore("redis://" + addr)
+	assert.Error(t, err)
+}
+
+func TestClusterIDs(t *testing.T) {
+	store := NewMemoryStore()
+	first := &clusterIDs{IDs: NewIDs(1, 2), cluster: &cluster{store: store, addr: "ws://first"}}
+	second := &clusterIDs{IDs: NewIDs(1, 2), cluster: &cluster{store: store, addr: "ws://second"}}
+
+	id, err := first.Bind()
+	require.NoError(t, err)
+	other, err := second.Bind()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int{1, 2}, []int{id, other}, "ids are unique across the servers")
+	_, err = second.Bind()
+	assert.ErrorIs(t, err, ErrNoFreeIDs)
+
+	addr, err := first.Locate(other)
+	require.NoError(t, err)
+	assert.Equal(t, "ws://second", addr, "ids bound by other servers are located")
+	addr, err = first.Locate(id)
+	require.NoError(t, err)
+	assert.Empty(t, addr, "ids bound by the server itself are not located")
+
+	first.Free(id)
+	freed, err := second.Bind()
+	require.NoError(t, err)
+	assert.Equal(t, id, freed)
+}
+
+func TestClusterMailboxes(t *testing.T) {
+	store := NewMemoryStore()
+	first := &clusterMailboxes{Mailboxes: newMailboxes(), cluster: &cluster{store: store, addr: "ws://first"}}
+	second := &clusterMailboxes{Mailboxes: newMailboxes(), cluster: &cluster{store: store, addr: "ws://second"}}
+
+	mailbox, err := first.Allocate("pass", 1)
+	require.NoError(t, err)
+	_, err = second.Allocate("pass", 1)
+	assert.Error(t, err, "passwords are unique across the servers")
+
+	addr, err := first.Locate("pass")
+	require.NoError(t, err)
+	assert.Empty(t, addr, "mailboxes held by the server itself")
+	addr, err = second.Locate("pass")
+	require.NoError(t, err)
+	assert.Equal(t, "ws://first", addr)
+
+	first.Release("pass", mailbox)
+	addr, err = second.Locate("pass")
+	require.NoError(t, err)
+	assert.Empty(t, addr, "released mailboxes are unregistered")
+	_, err = second.Allocate("pass", 1)
+	assert.NoError(t, err)
+}
+
+func TestClusterTransfer(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	first, firstAddr := newClusterServer(t, store)
+	second, secondAddr := newClusterServer(t, store)
+
+	payload := make([]byte, 1<<20)
+	_, err := rand.Read(payload)
+	require.NoError(t, err)
+
+	t.Run("receiver on other server", func(t *testing.T) {
+		password, err, errC := portal.Send(ctx, bytes.NewReader(payload), int64(len(payload)), &portal.Config{RendezvousAddr: firstAddr})
+		require.NoError(t, err)
+		received := &bytes.Buffer{}
+		require.NoError(t, portal.Receive(ctx, received, password, &portal.Config{RendezvousAddr: secondAddr}))
+		assert.NoError(t, <-errC)
+		assert.True(t, bytes.Equal(payload, received.Bytes()), "received payload differs")
+
+		assert.Eventually(t, func() bool {
+			_, ok, _ := store.Get(ctx, mailboxKey(pw.Hashed(password)))
+			return !ok && first.mailboxes.Count() == 0 && second.mailboxes.Count() == 0
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("sender to listening receiver on other server", func(t *testing.T) {
+		password, receive, err := portal.Listen(ctx, &portal.Config{RendezvousAddr: secondAddr})
+		require.NoError(t, err)
+		_, err, errC := portal.Send(ctx, bytes.NewReader(payload), int64(len(payload)), &portal.Config{
+			RendezvousAddr: firstAddr,
+			Password:       password,
+		})
+		require.NoError(t, err)
+		received := &bytes.Buffer{}
+		require.NoError(t, receive(ctx, received))
+		assert.NoError(t, <-errC)
+		assert.True(t, bytes.Equal(payload, received.Bytes()), "received payload differs")
+	})
+}
+
+func TestClusterProxy(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	proxies, err := ParseTrustedProxies("127.0.0.1")
+	require.NoError(t, err)
+	owner, ownerAddr, caFile := newTLSClusterServer(t, store, WithTokens("secret"), WithTrustedProxies(proxies...))
+	_, proxyAddr := newClusterServer(t, store, relay.WithCA(caFile), relay.WithToken("secret"))
+
+	password, err, errC := portal.Send(ctx, bytes.NewReader([]byte("payload")), 7, &portal.Config{
+		RendezvousAddr: ownerAddr,
+		RelayCAFile:    caFile,
+		RelayToken:     "secret",
+	})
+	require.NoError(t, err)
+	id, err := pw.ID(password)
+	require.NoError(t, err)
+
+	// The forwarded connections carry the address of the client, rather than the forwarding headers of the client.
+	err = establish(t, proxyAddr, "203.0.113.1", id, pw.Hashed(wrongPassword(t, password)))
+	assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrInvalidPassword.Error()})
+	owner.lockout.mu.Lock()
+	assert.Contains(t, owner.lockout.perIP, "127.0.0.1")
+	assert.NotContains(t, owner.lockout.perIP, "203.0.113.1")
+	owner.lockout.mu.Unlock()
+
+	// The server holding the mailbox is reached using TLS and the token of the cluster.
+	received := &bytes.Buffer{}
+	require.NoError(t, portal.Receive(ctx, received, password, &portal.Config{RendezvousAddr: proxyAddr}))
+	assert.NoError(t, <-errC)
+	assert.Equal(t, "payload", received.String())
+}
@@ -3,3 +3,39 @@ package rendezvous
 import "time"
 
 const RECEIVER_CONNECT_TIMEOUT time.Duration = 5 * time.Minute
+const SENDER_CONNECT_TIMEOUT time.Duration = 5 * time.Minute
+
+// TOKENS_ENV is the environment variable containing the comma separated tokens accepted by the server.
+const TOKENS_ENV = "PORTAL_RELAY_TOKENS"
+
+// ADMIN_TOKEN_ENV is the environment variable containing the token that enables the admin API of the server.
+const ADMIN_TOKEN_ENV = "PORTAL_RELAY_ADMIN_TOKEN"
+
+// MAX_FAILED_ATTEMPTS is the amount of failed receiver attempts after which the password of a sender is invalidated.
+const MAX_FAILED_ATTEMPTS = 3
+
+// MAX_FAILED_ATTEMPTS_PER_IP is the amount of failed receiver attempts after which an IP is locked out,
+// until FAILED_ATTEMPTS_LOCKOUT has passed since its first failed attempt.
+const MAX_FAILED_ATTEMPTS_PER_IP = 10
+const FAILED_ATTEMPTS_LOCKOUT time.Duration = 15 * time.Minute
+
+// DRAIN_TIMEOUT is the default duration that the server waits for transfers in progress to finish when shutting down.
+const DRAIN_TIMEOUT time.Duration = 10 * time.Minute
+
+// TERMINATE_GRACE_PERIOD is how long the connections of a terminated session are kept open after notifying the peers.
+const TERMINATE_GRACE_PERIOD time.Duration = time.Second
+
+// MIN_ID and MAX_ID are the default range of the ids bound to connections, which prefix the passwords.
+const MIN_ID = 1
+const MAX_ID = 9999
+
+// MAX_DIRECT_RELAYED_MESSAGES is the amount of messages relayed from the sender to the receiver of a direct transfer
+// at most, the transfer handshake of the sender and its acknowledgement of the direct connection.
+const MAX_DIRECT_RELAYED_MESSAGES = 2
+
+// MAX_BIND_ATTEMPTS is the amount of random ids tried when binding an id of a large range, or an id shared by the
+// servers of a cluster.
+const MAX_BIND_ATTEMPTS = 32
+
+// MAX_LISTED_IDS is the size of the largest range of ids whose unbound ids are listed, see IDs.Bind.
+const MAX_LISTED_IDS = 1 << 16
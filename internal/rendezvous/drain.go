@@ -0,0 +1,99 @@
+// drain.go specifies how the rendezvous server drains the transfers in progress before shutting down.
+package rendezvous
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+var ErrDraining = errors.New("the relay is shutting down, try again shortly")
+
+// DRAIN_REPORT_INTERVAL is the interval at which the remaining connections are logged while draining.
+const DRAIN_REPORT_INTERVAL = 10 * time.Second
+
+// DRAIN_POLL_INTERVAL is the interval at which the remaining connections are checked while draining.
+const DRAIN_POLL_INTERVAL = 100 * time.Millisecond
+
+// track returns a middleware that counts the connections being handled, which are waited for when draining.
+func (s *Server) track() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.active.Add(1)
+			defer s.active.Add(-1)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isDraining is a route matcher matching requests while the server is draining.
+func (s *Server) isDraining(r *http.Request, rm *mux.RouteMatch) bool {
+	return s.draining.Load()
+}
+
+// handleDraining returns a handler refusing new transfers while the server is draining.
+func (s *Server) handleDraining() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, ErrDraining.Error(), http.StatusServiceUnavailable)
+	}
+}
+
+// drain stops the server from accepting new transfers, and waits for the connections in progress to finish,
+// until the drain timeout has passed. The sessions still in progress are then logged and terminated.
+func (s *Server) drain() {
+	s.draining.Store(true)
+	logger := s.logger.With(zap.String("component", "drain"))
+	logger.Info("draining rendezvous server",
+		zap.Int64("connections", s.active.Load()),
+		zap.Duration("timeout", s.drainTimeout))
+
+	deadline := time.NewTimer(s.drainTimeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(DRAIN_POLL_INTERVAL)
+	defer poll.Stop()
+	report := time.NewTicker(DRAIN_REPORT_INTERVAL)
+	defer report.Stop()
+	for s.active.Load() > 0 {
+		select {
+		case <-poll.C:
+		case <-report.C:
+			logger.Info("waiting for connections to finish",
+				zap.Int64("connections", s.active.Load()),
+				zap.Int("sessions", len(s.sessions())))
+		case <-deadline.C:
+			s.terminateAll(logger)
+			return
+		}
+	}
+	logger.Info("drained rendezvous server")
+}
+
+// terminateAll logs and terminates all sessions in progress.
+func (s *Server) terminateAll(logger *zap.Logger) {
+	sessions := s.sessions()
+	logger.Warn("drain timeout passed, terminating remaining sessions",
+		zap.Int64("connections", s.active.Load()),
+		zap.Int("sessions", len(sessions)))
+	for _, session := range sessions {
+		logger.Warn("terminating session",
+			zap.Int("id", session.ID),
+			zap.String("stage", session.Stage),
+			zap.Float64("age_seconds", session.AgeSeconds),
+			zap.Int64("relayed_bytes", session.RelayedBytes),
+			zap.String("sender_ip", session.SenderIP),
+			zap.String("receiver_ip", session.ReceiverIP))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.ids.Range(func(key, _ any) bool {
+		for _, mailbox := range s.mailboxesOf(key.(int)) {
+			s.terminate(ctx, mailbox.session, ErrDraining, logger)
+		}
+		return true
+	})
+}
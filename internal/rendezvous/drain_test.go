@@ -0,0 +1,72 @@
+package rendezvous
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SpatiumPortae/portal/internal/portal"
+	"github.com/SpatiumPortae/portal/protocol/rendezvous"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainWithoutConnections(t *testing.T) {
+	s, _ := newTestServer(t, WithDrainTimeout(time.Minute))
+	done := make(chan struct{})
+	go func() {
+		s.drain()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("draining a server without connections did not finish")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	ctx := context.Background()
+	s, addr := newTestServer(t, WithDrainTimeout(500*time.Millisecond))
+	ping := func() int {
+		r, err := http.Get("http://" + strings.TrimPrefix(addr, "ws://") + "/ping")
+		require.NoError(t, err)
+		r.Body.Close()
+		return r.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, ping())
+
+	// A sender waiting for its receiver when the server starts draining.
+	_, err, errC := portal.Send(ctx, &bytes.Buffer{}, 0, &portal.Config{RendezvousAddr: addr})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(s.sessions()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		s.drain()
+		close(done)
+	}()
+	require.Eventually(t, s.draining.Load, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, http.StatusServiceUnavailable, ping())
+	_, err, _ = portal.Send(ctx, &bytes.Buffer{}, 0, &portal.Config{RendezvousAddr: addr})
+	assert.Error(t, err, "new senders are refused while draining")
+	_, _, err = portal.Listen(ctx, &portal.Config{RendezvousAddr: addr})
+	assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrDraining.Error()}, "new listening receivers are refused while draining")
+
+	// The waiting sender is terminated once the drain timeout has passed.
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("draining did not finish after the drain timeout")
+	}
+	select {
+	case err := <-errC:
+		assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrDraining.Error()})
+	case <-time.After(5 * time.Second):
+		t.Fatal("the waiting sender was not terminated")
+	}
+}
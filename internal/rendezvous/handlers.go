@@ -5,14 +5,19 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"html/template"
 	"io"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/SpatiumPortae/portal/internal/conn"
+	"github.com/SpatiumPortae/portal/internal/link"
 	"github.com/SpatiumPortae/portal/internal/logger"
+	"github.com/SpatiumPortae/portal/internal/password"
 	"github.com/SpatiumPortae/portal/protocol/rendezvous"
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"nhooyr.io/websocket"
 )
@@ -35,11 +40,29 @@ func (s *Server) handleEstablishSender() http.HandlerFunc {
 		rc := conn.Rendezvous{Conn: c}
 		logger.Info("sender connected")
 
-		id := s.ids.Bind()
+		release, err := s.limiter.acquire(s.clientIP(r))
+		if err != nil {
+			s.reject(ctx, rc, err, logger)
+			return
+		}
+		defer release()
+
+		id, err := s.ids.Bind()
+		if err != nil {
+			logger.Error("binding id", zap.Error(err))
+			s.metrics.handshakeFailures.WithLabelValues(stageBind).Inc()
+			reason := ErrUnavailable
+			if errors.Is(err, ErrNoFreeIDs) {
+				reason = ErrNoFreeIDs
+			}
+			s.reject(ctx, rc, reason, logger)
+			return
+		}
 		logger = logger.With(zap.Int("id", id))
 		logger.Info("bound id")
 		defer func() {
-			s.ids.Delete(id)
+			s.ids.Free(id)
+			s.lockout.forget(id)
 			logger.Info("freed id")
 		}()
 
@@ -51,95 +74,176 @@ func (s *Server) handleEstablishSender() http.HandlerFunc {
 		})
 		if err != nil {
 			logger.Error("binding communcation ID", zap.Error(err))
+			s.metrics.handshakeFailures.WithLabelValues(stageBind).Inc()
 			return
 		}
 
 		msg, err := rc.ReadMsg(ctx, rendezvous.SenderToRendezvousEstablish)
 		if err != nil {
 			logger.Error("establishing sender", zap.Error(err))
+			s.metrics.handshakeFailures.WithLabelValues(stageEstablish).Inc()
 			return
 		}
+		password := msg.Payload.Password
 
-		// Allocate a mailbox for this communication.
-		mailbox := &Mailbox{
-			Sender:   make(chan []byte),
-			Receiver: make(chan []byte),
+		// Allocate a group of mailboxes for this communication, with room for every receiver.
+		receivers := msg.Payload.Receivers
+		if receivers == 0 {
+			receivers = 1
 		}
-		s.mailboxes.StoreMailbox(msg.Payload.Password, mailbox)
-		password := msg.Payload.Password
+		mailbox, err := s.mailboxes.Allocate(password, receivers)
+		if err != nil {
+			logger.Error("allocating mailbox", zap.Error(err))
+			return
+		}
+		s.ids.Attach(id, password)
+		s.serveSender(ctx, w, rc, password, mailbox, s.clientIP(r), logger)
+	}
+}
 
-		// wait for receiver to connect or connection timeout
-		timeout := time.NewTimer(RECEIVER_CONNECT_TIMEOUT)
-		select {
-		case <-ctx.Done():
-			if ctx.Err() != nil {
-				logger.Error("context error while waiting for receiver", zap.Error(ctx.Err()))
-			}
-			logger.Info("closing handler")
+// handleJoinSender returns a websocket handler that communicates with a sender that joins an
+// established password, in order to send to another receiver, or to a listening receiver.
+func (s *Server) handleJoinSender() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger, err := logger.FromContext(ctx)
+		if err != nil {
 			return
-		case <-timeout.C:
-			logger.Warn("waiting for receiver timed out")
+		}
+		c, err := conn.FromContext(ctx)
+		if err != nil {
+			logger.Error("getting Conn from request context", zap.Error(err))
 			return
-		case <-mailbox.Sender:
-			break
 		}
+		rc := conn.Rendezvous{Conn: c}
+		logger.Info("sender connected")
 
-		err = rc.WriteMsg(ctx, rendezvous.Msg{
-			Type: rendezvous.RendezvousToSenderReady,
-		})
-
+		msg, err := rc.ReadMsg(ctx, rendezvous.SenderToRendezvousJoin)
 		if err != nil {
-			logger.Error("sending ready message to sender", zap.Error(err))
+			logger.Error("joining sender", zap.Error(err))
 			return
 		}
-
-		msg, err = rc.ReadMsg(ctx, rendezvous.SenderToRendezvousPAKE)
+		password := msg.Payload.Password
+		if addr, err := s.mailboxes.Locate(password); err != nil {
+			logger.Error("locating mailbox", zap.Error(err))
+			s.reject(ctx, rc, ErrUnavailable, logger)
+			return
+		} else if addr != "" {
+			s.proxy(ctx, r, rc, addr, msg, logger)
+			return
+		}
+		ip := s.clientIP(r)
+		release, err := s.limiter.acquire(ip)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			logger.Error("performing PAKE exchange", zap.Error(err))
+			s.reject(ctx, rc, err, logger)
 			return
 		}
-		// send PAKE bytes to receiver
-		mailbox.Receiver <- msg.Payload.Bytes
-		// respond with receiver PAKE bytes
-		err = rc.WriteMsg(ctx, rendezvous.Msg{
-			Type: rendezvous.RendezvousToSenderPAKE,
-			Payload: rendezvous.Payload{
-				Bytes: <-mailbox.Sender,
-			},
-		})
+		defer release()
+		mailbox, err := s.mailboxes.Join(password)
 		if err != nil {
-			logger.Error("sending PAKE bytes to sender", zap.Error(err))
+			logger.Warn("failed to join mailbox", zap.Error(err))
 			return
 		}
+		s.serveSender(ctx, w, rc, password, mailbox, ip, logger)
+	}
+}
 
-		msg, err = rc.ReadMsg(ctx, rendezvous.SenderToRendezvousSalt)
+// serveSender waits for a receiver to connect to the provided mailbox of the sender with the provided IP, and
+// relays the communication between them. The mailbox is released once the communication has ended.
+func (s *Server) serveSender(ctx context.Context, w http.ResponseWriter, rc conn.Rendezvous, password string, mailbox *Mailbox, ip string, logger *zap.Logger) {
+	defer func() {
+		logger.Info("deallocating mailbox")
+		s.mailboxes.Release(password, mailbox)
+	}()
+	ctx, terminate := context.WithCancel(ctx)
+	defer terminate()
+	mailbox.session.attachSender(peer{ip: ip, rc: rc, cancel: terminate})
+
+	// wait for receiver to connect or connection timeout
+	timeout := time.NewTimer(RECEIVER_CONNECT_TIMEOUT)
+	select {
+	case <-ctx.Done():
+		if ctx.Err() != nil {
+			logger.Error("context error while waiting for receiver", zap.Error(ctx.Err()))
+		}
+		logger.Info("closing handler")
+		return
+	case <-timeout.C:
+		logger.Warn("waiting for receiver timed out")
+		return
+	case <-mailbox.Abandoned:
+		logger.Warn("listening receiver left before the sender was handed the mailbox")
+		return
+	case <-mailbox.Invalidated:
+		logger.Warn("password invalidated before a receiver connected")
+		err := rc.WriteMsg(ctx, rendezvous.Msg{
+			Type: rendezvous.RendezvousToSenderInvalidated,
+		})
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			logger.Error("performing salt exchange", zap.Error(err))
-			return
+			logger.Error("notifying sender of invalidated password", zap.Error(err))
 		}
+		return
+	case <-mailbox.Sender:
+		break
+	}
+	mailbox.session.setStage(sessionHandshake)
 
-		// Send the salt to the receiver.
-		mailbox.Receiver <- msg.Payload.Salt
-		// Start forwarder and relay
-		forward := make(chan []byte)
-		wg := sync.WaitGroup{}
-		relayCtx, cancel := context.WithCancel(ctx)
+	err := rc.WriteMsg(ctx, rendezvous.Msg{
+		Type: rendezvous.RendezvousToSenderReady,
+	})
 
-		wg.Add(2)
-		go s.forwarder(relayCtx, &wg, rc, forward, logger)
-		s.relay(relayCtx, &wg, rc, forward, mailbox.Sender, mailbox.Receiver, logger)
+	if err != nil {
+		logger.Error("sending ready message to sender", zap.Error(err))
+		return
+	}
 
-		// We want to make sure that the both forwarder and relay have terminated
-		cancel()
-		wg.Wait()
+	msg, err := rc.ReadMsg(ctx, rendezvous.SenderToRendezvousPAKE)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logger.Error("performing PAKE exchange", zap.Error(err))
+		s.metrics.handshakeFailures.WithLabelValues(stagePAKE).Inc()
+		return
+	}
+	// send PAKE bytes to receiver
+	mailbox.Receiver <- msg.Payload.Bytes
+	// respond with receiver PAKE bytes
+	err = rc.WriteMsg(ctx, rendezvous.Msg{
+		Type: rendezvous.RendezvousToSenderPAKE,
+		Payload: rendezvous.Payload{
+			Bytes: <-mailbox.Sender,
+		},
+	})
+	if err != nil {
+		logger.Error("sending PAKE bytes to sender", zap.Error(err))
+		s.metrics.handshakeFailures.WithLabelValues(stagePAKE).Inc()
+		return
+	}
 
-		// Deallocate mailbox
-		logger.Info("deallocating mailbox")
-		s.mailboxes.Delete(password)
-		logger.Info("sender closing")
+	msg, err = rc.ReadMsg(ctx, rendezvous.SenderToRendezvousSalt)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		logger.Error("performing salt exchange", zap.Error(err))
+		s.metrics.handshakeFailures.WithLabelValues(stageSalt).Inc()
+		return
 	}
+
+	// Send the salt to the receiver.
+	mailbox.Receiver <- msg.Payload.Salt
+	mailbox.session.setStage(sessionRelaying)
+	// Start forwarder and relay
+	forward := make(chan []byte)
+	wg := sync.WaitGroup{}
+	relayCtx, cancel := context.WithCancel(ctx)
+
+	wg.Add(2)
+	go s.forwarder(relayCtx, &wg, rc, forward, mailbox.session, logger)
+	s.relay(relayCtx, &wg, rc, forward, mailbox.Sender, mailbox.Receiver, directionToSender, mailbox.session, logger)
+
+	// We want to make sure that the both forwarder and relay have terminated
+	cancel()
+	wg.Wait()
+
+	logger.Info("sender closing")
 }
 
 // handleEstablishReceiver returns a websocket handler that communicates with the sender.
@@ -159,31 +263,96 @@ func (s *Server) handleEstablishReceiver() http.HandlerFunc {
 		rc := conn.Rendezvous{Conn: c}
 		logger.Info("receiver connected")
 
-		// Establish receiver.
-		msg, err := rc.ReadMsg(ctx, rendezvous.ReceiverToRendezvousEstablish)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			logger.Error("establishing receiver", zap.Error(err))
+		ip := s.clientIP(r)
+		if s.lockout.locked(ip, time.Now()) {
+			s.reject(ctx, rc, ErrLockedOut, logger)
 			return
 		}
+		ctx, terminate := context.WithCancel(ctx)
+		defer terminate()
+		receiver := peer{ip: ip, rc: rc, cancel: terminate}
 
-		mailbox, err := s.mailboxes.GetMailbox(msg.Payload.Password)
+		// Establish receiver, either the receiver listens for a sender, or connects to a waiting sender.
+		msg, err := rc.ReadMsg(ctx, rendezvous.ReceiverToRendezvousEstablish, rendezvous.ReceiverToRendezvousListen)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			logger.Error("failed to get mailbox", zap.Error(err))
-			return
-		}
-		if mailbox.hasReceiver {
 			w.WriteHeader(http.StatusBadRequest)
-			logger.Warn("mailbox already have a receiver")
+			logger.Error("establishing receiver", zap.Error(err))
+			s.metrics.handshakeFailures.WithLabelValues(stageEstablish).Inc()
 			return
 		}
-		// this receiver was first, reserve this mailbox for it to receive
-		mailbox.hasReceiver = true
-		s.mailboxes.StoreMailbox(msg.Payload.Password, mailbox)
 
-		// notify sender we are connected
-		mailbox.Sender <- []byte{}
+		// The id of the sender connection that established the password, used to count failed attempts against it.
+		senderID := msg.Payload.ID
+		var mailbox *Mailbox
+		if msg.Type == rendezvous.ReceiverToRendezvousListen {
+			if s.draining.Load() {
+				s.reject(ctx, rc, ErrDraining, logger)
+				return
+			}
+			release, err := s.limiter.acquire(ip)
+			if err != nil {
+				s.reject(ctx, rc, err, logger)
+				return
+			}
+			defer release()
+			id, err := s.ids.Bind()
+			if err != nil {
+				logger.Error("binding id", zap.Error(err))
+				s.metrics.handshakeFailures.WithLabelValues(stageBind).Inc()
+				reason := ErrUnavailable
+				if errors.Is(err, ErrNoFreeIDs) {
+					reason = ErrNoFreeIDs
+				}
+				s.reject(ctx, rc, reason, logger)
+				return
+			}
+			logger = logger.With(zap.Int("id", id))
+			logger.Info("bound id")
+			defer func() {
+				s.ids.Free(id)
+				logger.Info("freed id")
+			}()
+			mailbox, err = s.listen(ctx, rc, id, receiver, logger)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				logger.Error("listening for sender", zap.Error(err))
+				s.metrics.handshakeFailures.WithLabelValues(stageBind).Inc()
+				return
+			}
+		} else {
+			// The id might be bound by another server sharing the ids of this server, which holds its mailbox and
+			// counts the failed attempts against it.
+			if addr, err := s.ids.Locate(senderID); err != nil {
+				logger.Error("locating id", zap.Error(err))
+				s.reject(ctx, rc, ErrUnavailable, logger)
+				return
+			} else if addr != "" {
+				s.proxy(ctx, r, rc, addr, msg, logger)
+				return
+			}
+			// Only the password of the mailbox established by the id is accepted, so that every guess counts
+			// against the mailbox it targets.
+			if p, ok := s.ids.Password(senderID); !ok || p != msg.Payload.Password {
+				logger.Warn("password does not match the id", zap.Int("target_id", senderID))
+				s.metrics.handshakeFailures.WithLabelValues(stageEstablish).Inc()
+				s.fail(ip, senderID, logger)
+				s.reject(ctx, rc, ErrInvalidPassword, logger)
+				return
+			}
+			// reserve a mailbox for this receiver
+			mailbox, err = s.mailboxes.Claim(msg.Payload.Password)
+			if err != nil {
+				logger.Warn("failed to claim mailbox", zap.Error(err))
+				s.metrics.handshakeFailures.WithLabelValues(stageEstablish).Inc()
+				s.fail(ip, senderID, logger)
+				s.reject(ctx, rc, ErrInvalidPassword, logger)
+				return
+			}
+			mailbox.session.attachReceiver(receiver)
+			// notify sender we are connected
+			mailbox.Sender <- []byte{}
+		}
+
 		// send back received sender PAKE bytes
 		err = rc.WriteMsg(ctx, rendezvous.Msg{
 			Type: rendezvous.RendezvousToReceiverPAKE,
@@ -193,6 +362,7 @@ func (s *Server) handleEstablishReceiver() http.HandlerFunc {
 		})
 		if err != nil {
 			logger.Error("sending PAKE bytes to receiver", zap.Error(err))
+			s.metrics.handshakeFailures.WithLabelValues(stagePAKE).Inc()
 			return
 		}
 
@@ -200,6 +370,8 @@ func (s *Server) handleEstablishReceiver() http.HandlerFunc {
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			logger.Error("performing PAKE exchange", zap.Error(err))
+			s.metrics.handshakeFailures.WithLabelValues(stagePAKE).Inc()
+			s.fail(ip, senderID, logger)
 			return
 		}
 
@@ -213,6 +385,7 @@ func (s *Server) handleEstablishReceiver() http.HandlerFunc {
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			logger.Error("exchanging salt", zap.Error(err))
+			s.metrics.handshakeFailures.WithLabelValues(stageSalt).Inc()
 			return
 		}
 
@@ -220,13 +393,15 @@ func (s *Server) handleEstablishReceiver() http.HandlerFunc {
 		forward := make(chan []byte)
 		wg := sync.WaitGroup{}
 		subCtx, cancel := context.WithCancel(ctx)
+		start := time.Now()
 
 		wg.Add(2)
-		go s.forwarder(subCtx, &wg, rc, forward, logger)
-		s.relay(subCtx, &wg, rc, forward, mailbox.Receiver, mailbox.Sender, logger)
+		go s.forwarder(subCtx, &wg, rc, forward, mailbox.session, logger)
+		s.relay(subCtx, &wg, rc, forward, mailbox.Receiver, mailbox.Sender, directionToReceiver, mailbox.session, logger)
 		cancel()
 
 		wg.Wait()
+		s.metrics.transferDuration.Observe(time.Since(start).Seconds())
 
 		logger.Info("receiver closing")
 	}
@@ -252,31 +427,81 @@ func (s *Server) handleVersionCheck() http.HandlerFunc {
 	}
 }
 
+// landingPage is the data of the landing page template. The password is set when the page is the receive page of
+// a web link.
+type landingPage struct {
+	Version  string
+	Password string
+	Command  string       // the command receiving with the password
+	Link     template.URL // the portal link of the password
+}
+
 func (s *Server) handleLandingPage() http.HandlerFunc {
-	templatePath := "relay/landing.html"
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		logger, err := logger.FromContext(ctx)
-		if err != nil {
+		s.renderLandingPage(w, r, landingPage{Version: s.version.String()})
+	}
+}
+
+// handleReceivePage serves the receive page of the web links of passwords, https://<relay>/r/<password>.
+func (s *Server) handleReceivePage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pass := mux.Vars(r)["password"]
+		if !password.IsValid(pass) {
+			http.NotFound(w, r)
 			return
 		}
-		w.Header().Set("Content-Type", "text/html")
-		tmpl, ok := s.templates[templatePath]
-		if !ok {
-			logger.Sugar().Errorf("failed to find template at path '%s'", templatePath)
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		relayAddr := fmt.Sprintf("%s://%s", scheme, r.Host)
+		webURL, err := link.WebURL(relayAddr, pass)
+		if err != nil {
+			http.NotFound(w, r)
 			return
 		}
-		err = tmpl.Execute(w, struct{ Version string }{s.version.String()})
+		uri, err := link.URI(relayAddr, pass)
 		if err != nil {
-			logger.Error("failed to execute relay landing page template", zap.Error(err))
+			http.NotFound(w, r)
 			return
 		}
+		s.renderLandingPage(w, r, landingPage{
+			Version:  s.version.String(),
+			Password: pass,
+			Command:  "portal receive " + webURL,
+			// The link is built from a valid password, and can not change the scheme of the URL.
+			Link: template.URL(uri),
+		})
+	}
+}
+
+func (s *Server) renderLandingPage(w http.ResponseWriter, r *http.Request, page landingPage) {
+	templatePath := "relay/landing.html"
+	logger, err := logger.FromContext(r.Context())
+	if err != nil {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	tmpl, ok := s.templates[templatePath]
+	if !ok {
+		logger.Sugar().Errorf("failed to find template at path '%s'", templatePath)
+		return
+	}
+	err = tmpl.Execute(w, page)
+	if err != nil {
+		logger.Error("failed to execute relay landing page template", zap.Error(err))
+		return
 	}
 }
 
 //nolint:errcheck
 func (s *Server) ping() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Report unhealthy while draining, so that load balancers stop routing to the server.
+		if s.draining.Load() {
+			http.Error(w, "draining", http.StatusServiceUnavailable)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("pong"))
 	}
@@ -284,9 +509,75 @@ func (s *Server) ping() http.HandlerFunc {
 
 // ------------------------------------------------------ Helpers ------------------------------------------------------
 
+// listen binds the provided ID for a listening receiver, and allocates a mailbox for the password the receiver
+// establishes. Returns the mailbox once a sender has joined it.
+func (s *Server) listen(ctx context.Context, rc conn.Rendezvous, id int, receiver peer, logger *zap.Logger) (*Mailbox, error) {
+	err := rc.WriteMsg(ctx, rendezvous.Msg{
+		Type: rendezvous.RendezvousToReceiverBind,
+		Payload: rendezvous.Payload{
+			ID: id,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("binding communication ID: %w", err)
+	}
+
+	msg, err := rc.ReadMsg(ctx, rendezvous.ReceiverToRendezvousEstablish)
+	if err != nil {
+		return nil, err
+	}
+	password := msg.Payload.Password
+	mailbox, err := s.mailboxes.Listen(password)
+	if err != nil {
+		return nil, err
+	}
+	mailbox.session.attachReceiver(receiver)
+	s.ids.Attach(id, password)
+	logger.Info("listening for sender")
+
+	// wait for sender to join or connection timeout, the mailbox is released by the sender once joined.
+	timeout := time.NewTimer(SENDER_CONNECT_TIMEOUT)
+	defer timeout.Stop()
+	select {
+	case mailbox.Sender <- []byte{}:
+		return mailbox, nil
+	case <-timeout.C:
+		err = errors.New("waiting for sender timed out")
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if s.mailboxes.Unlisten(password, mailbox) {
+		return nil, err
+	}
+
+	// The sender joined as the waiting ended, hand over the mailbox unless the receiver has left.
+	select {
+	case mailbox.Sender <- []byte{}:
+		return mailbox, nil
+	case <-ctx.Done():
+		close(mailbox.Abandoned)
+		return nil, ctx.Err()
+	}
+}
+
+// terminate terminates the handlers of the peers of the provided session, notifying them of the provided reason.
+// The handlers are terminated after TERMINATE_GRACE_PERIOD, so that a peer which is only writing, such as the sender
+// of a relayed transfer, reads the reason before its connection is torn down.
+func (s *Server) terminate(ctx context.Context, session *session, reason error, logger *zap.Logger) {
+	peers := session.terminate()
+	for _, p := range peers {
+		s.reject(ctx, p.rc, reason, logger)
+	}
+	time.AfterFunc(TERMINATE_GRACE_PERIOD, func() {
+		for _, p := range peers {
+			p.cancel()
+		}
+	})
+}
+
 // forwarder reads from the connection and forwards the message to the provided channel.
 // Transient errors are logged on the provided logger.
-func (s *Server) forwarder(ctx context.Context, wg *sync.WaitGroup, rc conn.Rendezvous, forward chan<- []byte, logger *zap.Logger) {
+func (s *Server) forwarder(ctx context.Context, wg *sync.WaitGroup, rc conn.Rendezvous, forward chan<- []byte, session *session, logger *zap.Logger) {
 	forwardLogger := logger.With(zap.String("component", "forwarder"))
 	forwardLogger.Info("starting forwarder")
 	defer wg.Done()
@@ -315,6 +606,9 @@ func (s *Server) forwarder(ctx context.Context, wg *sync.WaitGroup, rc conn.Rend
 
 		var msg rendezvous.Msg
 		if err := json.Unmarshal(payload, &msg); err == nil {
+			if msg.Type == rendezvous.ReceiverToRendezvousClose {
+				s.metrics.outcomes.WithLabelValues(session.outcome()).Inc()
+			}
 			logger.Info("received unencrypted message, closing forwarder")
 			return
 		}
@@ -322,7 +616,7 @@ func (s *Server) forwarder(ctx context.Context, wg *sync.WaitGroup, rc conn.Rend
 	}
 }
 
-func (s *Server) relay(ctx context.Context, wg *sync.WaitGroup, rc conn.Rendezvous, forward, relayIn <-chan []byte, relayOut chan<- []byte, logger *zap.Logger) {
+func (s *Server) relay(ctx context.Context, wg *sync.WaitGroup, rc conn.Rendezvous, forward, relayIn <-chan []byte, relayOut chan<- []byte, direction string, session *session, logger *zap.Logger) {
 	relayLogger := logger.With(zap.String("component", "relay"))
 	relayLogger.Info("starting")
 	defer wg.Done()
@@ -337,16 +631,29 @@ func (s *Server) relay(ctx context.Context, wg *sync.WaitGroup, rc conn.Rendezvo
 				relayLogger.Info("forwarding channel closed, closing relay")
 				return
 			}
+			if max := s.limiter.limits.MaxRelayedBytes; max > 0 && session.relayed.Add(int64(len(forwarded))) > max {
+				relayLogger.Warn("terminating session exceeding the maximum relayed bytes")
+				s.terminate(ctx, session, ErrRelayedTooMuch, logger)
+				return
+			}
+			if err := s.limiter.throttle(ctx, session, len(forwarded)); err != nil {
+				relayLogger.Info("context done while throttling, closing relay")
+				return
+			}
 			relayOut <- forwarded
 		case relayed, more := <-relayIn:
 			if !more {
 				relayLogger.Info("relay channel closed, closing relay")
 				return
 			}
+			if direction == directionToReceiver {
+				session.toReceiver.Add(1)
+			}
 			if err := rc.WriteRaw(ctx, relayed); err != nil {
 				relayLogger.Error("writing relayed message to connection")
 				return
 			}
+			s.metrics.relayedBytes.WithLabelValues(direction).Add(float64(len(relayed)))
 		}
 	}
 }
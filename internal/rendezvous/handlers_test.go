@@ -0,0 +1,175 @@
+package rendezvous
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pw "github.com/SpatiumPortae/portal/internal/password"
+	"github.com/SpatiumPortae/portal/internal/portal"
+	"github.com/SpatiumPortae/portal/internal/receiver"
+	"github.com/SpatiumPortae/portal/internal/relay"
+	"github.com/SpatiumPortae/portal/internal/semver"
+	"github.com/SpatiumPortae/portal/internal/sender"
+	"github.com/SpatiumPortae/portal/protocol/transfer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer starts a rendezvous server with the provided options, returning its relay address.
+func newTestServer(t *testing.T, opts ...Option) (*Server, string) {
+	s := NewServer(0, semver.Version{}, opts...)
+	ts := httptest.NewServer(s.router)
+	t.Cleanup(ts.Close)
+	return s, "ws://" + strings.TrimPrefix(ts.URL, "http://")
+}
+
+// newTLSTestServer starts a rendezvous server with the provided options using TLS, returning its relay address
+// along with the relay option trusting its certificate.
+func newTLSTestServer(t *testing.T, opts ...Option) (*Server, string, relay.Option) {
+	s := NewServer(0, semver.Version{}, opts...)
+	ts := httptest.NewTLSServer(s.router)
+	t.Cleanup(ts.Close)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0644))
+	return s, "wss://" + strings.TrimPrefix(ts.URL, "https://"), relay.WithCA(caFile)
+}
+
+func TestSendToMultipleReceivers(t *testing.T) {
+	ctx := context.Background()
+	s, addr := newTestServer(t)
+	payload := make([]byte, 100000)
+	_, err := rand.Read(payload)
+	require.NoError(t, err)
+
+	const receivers = 3
+	password, err, errC := portal.Send(ctx, bytes.NewReader(payload), int64(len(payload)), &portal.Config{
+		RendezvousAddr: addr,
+		Receivers:      receivers,
+	})
+	require.NoError(t, err)
+
+	// Only the connection establishing the password is bound an ID, the joining connections are not.
+	require.Eventually(t, func() bool {
+		return len(s.mailboxes.Group(pw.Hashed(password))) == receivers
+	}, 5*time.Second, 10*time.Millisecond)
+	ids := 0
+	s.ids.Range(func(_, _ any) bool { ids++; return true })
+	assert.Equal(t, 1, ids)
+
+	var wg sync.WaitGroup
+	received := make([]*bytes.Buffer, receivers)
+	for i := range received {
+		received[i] = &bytes.Buffer{}
+		wg.Add(1)
+		go func(dst *bytes.Buffer) {
+			defer wg.Done()
+			assert.NoError(t, portal.Receive(ctx, dst, password, &portal.Config{RendezvousAddr: addr}))
+		}(received[i])
+	}
+	wg.Wait()
+	for err := range errC {
+		assert.NoError(t, err)
+	}
+	for _, dst := range received {
+		assert.True(t, bytes.Equal(payload, dst.Bytes()), "received payload differs")
+	}
+
+	// Every mailbox is released once the transfers are done.
+	assert.Eventually(t, func() bool {
+		return len(s.mailboxes.Group(pw.Hashed(password))) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSendToListeningReceiver(t *testing.T) {
+	ctx := context.Background()
+	s, addr := newTestServer(t)
+	payload := make([]byte, 100000)
+	_, err := rand.Read(payload)
+	require.NoError(t, err)
+
+	// The receiver connects first, and generates the password for the sender.
+	password, receive, err := portal.Listen(ctx, &portal.Config{RendezvousAddr: addr})
+	require.NoError(t, err)
+
+	_, err, errC := portal.Send(ctx, bytes.NewReader(payload), int64(len(payload)), &portal.Config{
+		RendezvousAddr: addr,
+		Password:       password,
+	})
+	require.NoError(t, err)
+
+	received := &bytes.Buffer{}
+	require.NoError(t, receive(ctx, received))
+	for err := range errC {
+		assert.NoError(t, err)
+	}
+	assert.True(t, bytes.Equal(payload, received.Bytes()), "received payload differs")
+
+	assert.Eventually(t, func() bool {
+		return len(s.mailboxes.Group(pw.Hashed(password))) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSendTypedPayload(t *testing.T) {
+	ctx := context.Background()
+	_, addr := newTestServer(t)
+	text := "A frog walks into a bank..."
+
+	const receivers = 2
+	payload := sender.NewTypedPayload(strings.NewReader(text), int64(len(text)), transfer.RawPayload, "frog.txt")
+	password, err, errC := portal.Send(ctx, payload, int64(len(text)), &portal.Config{
+		RendezvousAddr: addr,
+		Receivers:      receivers,
+	})
+	require.NoError(t, err)
+
+	// Every receiver is told the type and name of the payload.
+	var wg sync.WaitGroup
+	received := make([]*receiver.Destination, receivers)
+	for i := range received {
+		received[i] = &receiver.Destination{Writer: &bytes.Buffer{}}
+		wg.Add(1)
+		go func(dst *receiver.Destination) {
+			defer wg.Done()
+			assert.NoError(t, portal.Receive(ctx, dst, password, &portal.Config{RendezvousAddr: addr}))
+		}(received[i])
+	}
+	wg.Wait()
+	for err := range errC {
+		assert.NoError(t, err)
+	}
+	for _, dst := range received {
+		assert.Equal(t, transfer.RawPayload, dst.Type)
+		assert.Equal(t, "frog.txt", dst.Name)
+		assert.Equal(t, text, dst.Writer.(*bytes.Buffer).String())
+	}
+}
+
+func TestReceivePage(t *testing.T) {
+	_, addr := newTestServer(t)
+	base := "http://" + strings.TrimPrefix(addr, "ws://")
+
+	r, err := http.Get(base + "/r/1-solar-storm-moon")
+	require.NoError(t, err)
+	defer r.Body.Close()
+	require.Equal(t, http.StatusOK, r.StatusCode)
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "portal receive "+base+"/r/1-solar-storm-moon")
+	assert.Contains(t, string(body), `href="portal://`+strings.TrimPrefix(base, "http://")+`/1-solar-storm-moon"`)
+
+	r, err = http.Get(base + "/r/not-a-password")
+	require.NoError(t, err)
+	r.Body.Close()
+	assert.Equal(t, http.StatusNotFound, r.StatusCode)
+}
@@ -2,25 +2,133 @@
 package rendezvous
 
 import (
+	"crypto/rand"
+	"errors"
+	"math/big"
 	"sync"
 )
 
-// IDs is a threadsafe set of numbers.
-type IDs struct{ *sync.Map }
+var ErrNoFreeIDs = errors.New("all connection ids are in use")
+
+// IDs is a threadsafe set of the ids bound to connections. The ids are drawn at random from a range of ids,
+// so that the ids of other connections can not be guessed from the id of a connection.
+type IDs struct {
+	*sync.Map
+	min, max int
+
+	mu   sync.Mutex
+	free []int // the unbound ids of a small range, nil until the first id is bound
+}
 
 type void struct{} // empty struct complies to 0 bytes
 var member void
 
-// Bind binds an id to connection.
-func (ids *IDs) Bind() int {
-	id := 1
-	for {
-		val, _ := ids.Load(id)
-		if val == nil {
-			break
+// NewIDs creates a set of ids drawn from the range between the provided min and max id, inclusive.
+// The min id is at least 1, and the max id at least the min id.
+func NewIDs(min, max int) *IDs {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	return &IDs{Map: &sync.Map{}, min: min, max: max}
+}
+
+// Bind binds a random unbound id to a connection. The unbound ids of ranges of at most MAX_LISTED_IDS ids are
+// kept in a list that ids are drawn from. For larger ranges, which the bound ids only occupy a fraction of,
+// random ids are tried until an unbound one is found, so that the memory used does not grow with the range.
+func (ids *IDs) Bind() (int, error) {
+	if ids.max-ids.min >= MAX_LISTED_IDS {
+		for attempt := 0; attempt < MAX_BIND_ATTEMPTS; attempt++ {
+			id, err := ids.random()
+			if err != nil {
+				return 0, err
+			}
+			if _, bound := ids.LoadOrStore(id, member); !bound {
+				return id, nil
+			}
 		}
-		id++
+		return 0, ErrNoFreeIDs
 	}
+
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	if ids.free == nil {
+		ids.free = make([]int, 0, ids.max-ids.min+1)
+		for id := ids.min; id <= ids.max; id++ {
+			ids.free = append(ids.free, id)
+		}
+	}
+	if len(ids.free) == 0 {
+		return 0, ErrNoFreeIDs
+	}
+	i, err := random(len(ids.free))
+	if err != nil {
+		return 0, err
+	}
+	// Swap the drawn id with the last unbound id, so that it can be removed in constant time.
+	last := len(ids.free) - 1
+	id := ids.free[i]
+	ids.free[i] = ids.free[last]
+	ids.free = ids.free[:last]
 	ids.Store(id, member)
-	return id
+	return id, nil
+}
+
+// Free frees the provided id, so that it can be bound again.
+func (ids *IDs) Free(id int) {
+	if _, ok := ids.LoadAndDelete(id); !ok {
+		return
+	}
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	if ids.free != nil && id >= ids.min && id <= ids.max {
+		ids.free = append(ids.free, id)
+	}
+}
+
+// Attach associates the provided id with the password of the mailbox established by its connection.
+func (ids *IDs) Attach(id int, p string) {
+	ids.Store(id, p)
+}
+
+// Password returns the password of the mailbox established by the connection with the provided id.
+func (ids *IDs) Password(id int) (string, bool) {
+	val, _ := ids.Load(id)
+	p, ok := val.(string)
+	return p, ok
+}
+
+// Count returns the amount of bound ids.
+func (ids *IDs) Count() int {
+	count := 0
+	ids.Range(func(_, _ any) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// Locate returns an empty address, as the ids are only bound by this server.
+func (ids *IDs) Locate(id int) (string, error) {
+	return "", nil
+}
+
+// random returns a random id of the range, bound or not.
+func (ids *IDs) random() (int, error) {
+	i, err := random(ids.max - ids.min + 1)
+	if err != nil {
+		return 0, err
+	}
+	return ids.min + i, nil
+}
+
+// random returns a cryptographically secure random number in [0, n).
+func random(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
 }
@@ -0,0 +1,83 @@
+package rendezvous
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBind(t *testing.T) {
+	ids := NewIDs(10, 19)
+	bound := map[int]bool{}
+	for i := 0; i < 10; i++ {
+		id, err := ids.Bind()
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, id, 10)
+		assert.LessOrEqual(t, id, 19)
+		assert.False(t, bound[id], "binding a bound id")
+		bound[id] = true
+	}
+	assert.Equal(t, 10, ids.Count())
+
+	_, err := ids.Bind()
+	assert.ErrorIs(t, err, ErrNoFreeIDs)
+
+	ids.Free(15)
+	id, err := ids.Bind()
+	require.NoError(t, err)
+	assert.Equal(t, 15, id, "binding a freed id")
+}
+
+func TestBindRandom(t *testing.T) {
+	ids := NewIDs(1, 1000)
+	sequential := true
+	for i := 1; i <= 10; i++ {
+		id, err := ids.Bind()
+		require.NoError(t, err)
+		sequential = sequential && id == i
+	}
+	assert.False(t, sequential, "binding ids in sequence")
+}
+
+func TestBindLargeRange(t *testing.T) {
+	ids := NewIDs(1, math.MaxInt)
+	bound := map[int]bool{}
+	for i := 0; i < 100; i++ {
+		id, err := ids.Bind()
+		require.NoError(t, err)
+		assert.False(t, bound[id], "binding a bound id")
+		bound[id] = true
+	}
+	assert.Nil(t, ids.free, "listing the unbound ids of a large range")
+	assert.Equal(t, 100, ids.Count())
+
+	for id := range bound {
+		ids.Free(id)
+	}
+	assert.Zero(t, ids.Count())
+	assert.Nil(t, ids.free)
+
+	// Binding fails once the attempts only find bound ids.
+	ids = NewIDs(1, MAX_LISTED_IDS+1)
+	for id := 1; id <= MAX_LISTED_IDS+1; id++ {
+		ids.Store(id, member)
+	}
+	_, err := ids.Bind()
+	assert.ErrorIs(t, err, ErrNoFreeIDs)
+}
+
+func TestFree(t *testing.T) {
+	ids := NewIDs(1, 1)
+	id, err := ids.Bind()
+	require.NoError(t, err)
+	ids.Free(id)
+	ids.Free(id)
+	ids.Free(2)
+
+	_, err = ids.Bind()
+	require.NoError(t, err)
+	_, err = ids.Bind()
+	assert.ErrorIs(t, err, ErrNoFreeIDs, "freeing ids more than once")
+}
@@ -0,0 +1,166 @@
+// limits.go specifies the limits on the resources that clients can hold on the rendezvous server.
+package rendezvous
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SpatiumPortae/portal/internal/conn"
+	"github.com/SpatiumPortae/portal/internal/logger"
+	"github.com/SpatiumPortae/portal/internal/throttle"
+	"github.com/SpatiumPortae/portal/protocol/rendezvous"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+var (
+	ErrTooManyMailboxes       = errors.New("too many concurrent transfers on the relay, try again later")
+	ErrTooManyMailboxesFromIP = errors.New("too many concurrent transfers from your address, try again later")
+	ErrTooManyAttempts        = errors.New("too many connection attempts from your address, try again in a minute")
+	ErrRelayedTooMuch         = errors.New("the transfer exceeds the maximum size of relayed transfers, try again with a direct connection")
+)
+
+// Limits specifies the limits on the resources that clients can hold. A limit of 0 means no limit.
+type Limits struct {
+	MaxMailboxes         int `json:"max_mailboxes"`           // maximum amount of concurrent mailboxes
+	MaxMailboxesPerIP    int `json:"max_mailboxes_per_ip"`    // maximum amount of concurrent mailboxes per source IP
+	MaxAttemptsPerMinute int `json:"max_attempts_per_minute"` // maximum amount of connection attempts per minute per source IP
+
+	MaxRelayRate        int64 `json:"max_relay_rate"`         // maximum amount of bytes per second relayed across all sessions
+	MaxSessionRelayRate int64 `json:"max_session_relay_rate"` // maximum amount of bytes per second relayed per session
+	MaxRelayedBytes     int64 `json:"max_relayed_bytes"`      // maximum amount of bytes relayed per session
+}
+
+// limiter keeps track of the resources held by each source IP, and enforces the limits.
+type limiter struct {
+	limits    Limits
+	relayRate *rate.Limiter // nil without a limit
+
+	mu        sync.Mutex
+	mailboxes int
+	perIP     map[string]int
+	attempts  map[string]*window
+	swept     time.Time
+}
+
+// window counts the connection attempts of a source IP in the minute since it started.
+type window struct {
+	start time.Time
+	count int
+}
+
+func newLimiter(limits Limits) *limiter {
+	return &limiter{
+		limits:    limits,
+		relayRate: throttle.New(limits.MaxRelayRate),
+		perIP:     map[string]int{},
+		attempts:  map[string]*window{},
+	}
+}
+
+// attempt records a connection attempt from the provided IP, and returns an error if the IP has exceeded
+// the amount of attempts per minute.
+func (l *limiter) attempt(ip string, now time.Time) error {
+	if l.limits.MaxAttemptsPerMinute <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget the windows that have ended, at most once a minute, so that the map does not grow unbounded.
+	if now.Sub(l.swept) >= time.Minute {
+		for key, w := range l.attempts {
+			if now.Sub(w.start) >= time.Minute {
+				delete(l.attempts, key)
+			}
+		}
+		l.swept = now
+	}
+
+	w, ok := l.attempts[ip]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		w = &window{start: now}
+		l.attempts[ip] = w
+	}
+	if w.count >= l.limits.MaxAttemptsPerMinute {
+		return ErrTooManyAttempts
+	}
+	w.count++
+	return nil
+}
+
+// acquire reserves a mailbox for the provided IP, returning a function that releases the reservation.
+// An error is returned if the reservation would exceed the limits.
+func (l *limiter) acquire(ip string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits.MaxMailboxes > 0 && l.mailboxes >= l.limits.MaxMailboxes {
+		return nil, ErrTooManyMailboxes
+	}
+	if l.limits.MaxMailboxesPerIP > 0 && l.perIP[ip] >= l.limits.MaxMailboxesPerIP {
+		return nil, ErrTooManyMailboxesFromIP
+	}
+	l.mailboxes++
+	l.perIP[ip]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.mailboxes--
+			if l.perIP[ip]--; l.perIP[ip] == 0 {
+				delete(l.perIP, ip)
+			}
+		})
+	}, nil
+}
+
+// throttle waits until the global and session rate limits allow relaying the provided amount of bytes.
+func (l *limiter) throttle(ctx context.Context, session *session, n int) error {
+	if err := throttle.WaitN(ctx, l.relayRate, n); err != nil {
+		return err
+	}
+	return throttle.WaitN(ctx, session.rateLimiter(l.limits.MaxSessionRelayRate), n)
+}
+
+// limit returns a middleware that rejects the connections of source IPs exceeding the amount of
+// connection attempts per minute.
+func (s *Server) limit() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := s.limiter.attempt(s.clientIP(r), time.Now()); err != nil {
+				ctx := r.Context()
+				logger, lerr := logger.FromContext(ctx)
+				if lerr != nil {
+					return
+				}
+				c, cerr := conn.FromContext(ctx)
+				if cerr != nil {
+					logger.Error("getting Conn from request context", zap.Error(cerr))
+					return
+				}
+				s.reject(ctx, conn.Rendezvous{Conn: c}, err, logger)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// reject notifies the client that its connection is rejected for the provided reason.
+func (s *Server) reject(ctx context.Context, rc conn.Rendezvous, reason error, logger *zap.Logger) {
+	logger.Warn("rejecting connection", zap.Error(reason))
+	err := rc.WriteMsg(ctx, rendezvous.Msg{
+		Type: rendezvous.RendezvousToClientError,
+		Payload: rendezvous.Payload{
+			Error: reason.Error(),
+		},
+	})
+	if err != nil {
+		logger.Error("sending rejection to client", zap.Error(err))
+	}
+}
@@ -0,0 +1,185 @@
+package rendezvous
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SpatiumPortae/portal/internal/conn"
+	"github.com/SpatiumPortae/portal/internal/portal"
+	"github.com/SpatiumPortae/portal/internal/semver"
+	"github.com/SpatiumPortae/portal/protocol/rendezvous"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+)
+
+func TestAttempt(t *testing.T) {
+	l := newLimiter(Limits{MaxAttemptsPerMinute: 2})
+	now := time.Now()
+
+	assert.NoError(t, l.attempt("10.0.0.1", now))
+	assert.NoError(t, l.attempt("10.0.0.1", now.Add(time.Second)))
+	assert.ErrorIs(t, l.attempt("10.0.0.1", now.Add(2*time.Second)), ErrTooManyAttempts)
+	// Other addresses are limited separately.
+	assert.NoError(t, l.attempt("10.0.0.2", now.Add(2*time.Second)))
+
+	// The attempts are allowed again once the minute has passed, and the ended windows are forgotten.
+	assert.NoError(t, l.attempt("10.0.0.1", now.Add(time.Minute+2*time.Second)))
+	assert.Len(t, l.attempts, 1)
+}
+
+func TestAcquire(t *testing.T) {
+	l := newLimiter(Limits{MaxMailboxes: 3, MaxMailboxesPerIP: 2})
+
+	first, err := l.acquire("10.0.0.1")
+	require.NoError(t, err)
+	_, err = l.acquire("10.0.0.1")
+	require.NoError(t, err)
+	_, err = l.acquire("10.0.0.1")
+	assert.ErrorIs(t, err, ErrTooManyMailboxesFromIP)
+
+	_, err = l.acquire("10.0.0.2")
+	require.NoError(t, err)
+	_, err = l.acquire("10.0.0.3")
+	assert.ErrorIs(t, err, ErrTooManyMailboxes)
+
+	// Releasing more than once only frees the reservation once.
+	first()
+	first()
+	_, err = l.acquire("10.0.0.3")
+	require.NoError(t, err)
+	_, err = l.acquire("10.0.0.3")
+	assert.ErrorIs(t, err, ErrTooManyMailboxes)
+}
+
+func TestRejectOverLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("mailboxes", func(t *testing.T) {
+		_, addr := newTestServer(t, WithLimits(Limits{MaxMailboxesPerIP: 1}))
+		_, err, _ := portal.Send(ctx, &bytes.Buffer{}, 0, &portal.Config{RendezvousAddr: addr})
+		require.NoError(t, err)
+
+		_, err, _ = portal.Send(ctx, &bytes.Buffer{}, 0, &portal.Config{RendezvousAddr: addr})
+		assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrTooManyMailboxesFromIP.Error()})
+	})
+
+	t.Run("attempts", func(t *testing.T) {
+		_, addr := newTestServer(t, WithLimits(Limits{MaxAttemptsPerMinute: 1}))
+		_, err, _ := portal.Send(ctx, &bytes.Buffer{}, 0, &portal.Config{RendezvousAddr: addr})
+		require.NoError(t, err)
+
+		_, err, _ = portal.Send(ctx, &bytes.Buffer{}, 0, &portal.Config{RendezvousAddr: addr})
+		assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrTooManyAttempts.Error()})
+	})
+}
+
+// dialSpoofed connects to the sender endpoint of the relay claiming the provided forwarded address, and reads
+// the first message of the relay.
+func dialSpoofed(t *testing.T, addr string, forwarded string) error {
+	ctx := context.Background()
+	header := http.Header{}
+	header.Set("X-Forwarded-For", forwarded)
+	header.Set("X-Real-Ip", forwarded)
+	ws, _, err := websocket.Dial(ctx, addr+"/establish-sender", &websocket.DialOptions{HTTPHeader: header})
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.CloseNow() })
+	rc := conn.Rendezvous{Conn: &conn.WS{Conn: ws}}
+	_, err = rc.ReadMsg(ctx, rendezvous.RendezvousToSenderBind)
+	return err
+}
+
+func TestSpoofedForwardedFor(t *testing.T) {
+	_, addr := newTestServer(t, WithLimits(Limits{MaxAttemptsPerMinute: 1}))
+	require.NoError(t, dialSpoofed(t, addr, "203.0.113.1"))
+
+	// Forwarding headers of untrusted clients are ignored, the limit applies to the address of the connection.
+	err := dialSpoofed(t, addr, "203.0.113.2")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ErrTooManyAttempts.Error())
+
+	// Behind a trusted proxy, the forwarded address is limited instead.
+	proxies, err := ParseTrustedProxies("127.0.0.1")
+	require.NoError(t, err)
+	_, addr = newTestServer(t, WithLimits(Limits{MaxAttemptsPerMinute: 1}), WithTrustedProxies(proxies...))
+	require.NoError(t, dialSpoofed(t, addr, "203.0.113.1"))
+	require.NoError(t, dialSpoofed(t, addr, "203.0.113.2"))
+	assert.Error(t, dialSpoofed(t, addr, "203.0.113.1"))
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	require.NoError(t, err)
+	_, err = ParseTrustedProxies("10.0.0.0/33")
+	assert.Error(t, err)
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		realIP    string
+		expected  string
+	}{
+		{name: "untrusted client", remote: "203.0.113.1:1234", forwarded: []string{"198.51.100.1"}, realIP: "198.51.100.1", expected: "203.0.113.1"},
+		{name: "trusted proxy", remote: "10.0.0.1:1234", forwarded: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "forged hops before the proxy", remote: "10.0.0.1:1234", forwarded: []string{"198.51.100.1, 203.0.113.1"}, expected: "203.0.113.1"},
+		{name: "chain of trusted proxies", remote: "10.0.0.1:1234", forwarded: []string{"203.0.113.1, 192.0.2.1", "10.0.0.2"}, expected: "203.0.113.1"},
+		{name: "real ip of trusted proxy", remote: "[::ffff:192.0.2.1]:1234", realIP: "198.51.100.1", expected: "198.51.100.1"},
+		{name: "trusted proxy without headers", remote: "10.0.0.1:1234", expected: "10.0.0.1"},
+	}
+	s := NewServer(0, semver.Version{}, WithTrustedProxies(proxies...))
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remote
+			for _, forwarded := range tc.forwarded {
+				r.Header.Add("X-Forwarded-For", forwarded)
+			}
+			if tc.realIP != "" {
+				r.Header.Set("X-Real-Ip", tc.realIP)
+			}
+			assert.Equal(t, tc.expected, s.clientIP(r))
+		})
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	ctx := context.Background()
+	l := newLimiter(Limits{MaxSessionRelayRate: 1e6})
+	sess := newSession()
+	assert.Same(t, sess.rateLimiter(1e6), sess.rateLimiter(1e6), "the sender and receiver share the rate limit of the session")
+
+	// The burst is relayed at once, and the remainder at the limited rate, in chunks of the burst.
+	start := time.Now()
+	require.NoError(t, l.throttle(ctx, sess, 1e6))
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+	require.NoError(t, l.throttle(ctx, sess, 5e5))
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	// Throttling stops once the context is done.
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, l.throttle(ctx, sess, 1e6))
+
+	// Without limits, nothing is throttled.
+	require.NoError(t, newLimiter(Limits{}).throttle(ctx, newSession(), 1e9))
+}
+
+func TestMaxRelayedBytes(t *testing.T) {
+	ctx := context.Background()
+	_, addr := newTestServer(t, WithLimits(Limits{MaxRelayedBytes: 1}))
+
+	// The handshake between the sender and receiver is relayed, exceeding the limit.
+	password, err, errC := portal.Send(ctx, bytes.NewReader([]byte("payload")), 7, &portal.Config{RendezvousAddr: addr})
+	require.NoError(t, err)
+	err = portal.Receive(ctx, &bytes.Buffer{}, password, &portal.Config{RendezvousAddr: addr})
+	assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrRelayedTooMuch.Error()})
+	for err := range errC {
+		assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrRelayedTooMuch.Error()})
+	}
+}
@@ -0,0 +1,95 @@
+// lockout.go specifies the protection against receivers guessing passwords.
+package rendezvous
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrLockedOut       = errors.New("too many failed attempts from your address, try again later")
+	ErrInvalidPassword = errors.New("no transfer is waiting for a receiver with the provided password")
+)
+
+// lockout keeps track of the failed receiver attempts per mailbox, identified by the id of the sender
+// connection that established it, and per source IP.
+type lockout struct {
+	mu    sync.Mutex
+	perID map[int]int
+	perIP map[string]*window
+	swept time.Time
+}
+
+func newLockout() *lockout {
+	return &lockout{
+		perID: map[int]int{},
+		perIP: map[string]*window{},
+	}
+}
+
+// locked reports whether the provided IP is locked out after too many failed attempts.
+func (l *lockout) locked(ip string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w, ok := l.perIP[ip]
+	return ok && now.Sub(w.start) < FAILED_ATTEMPTS_LOCKOUT && w.count >= MAX_FAILED_ATTEMPTS_PER_IP
+}
+
+// fail records a failed attempt from the provided IP against the mailbox established by the connection with the
+// provided id, where an id of 0 records the attempt only against the IP. Reports whether the mailbox is to be
+// invalidated.
+func (l *lockout) fail(ip string, id int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget the IPs that are no longer locked out, so that the map does not grow unbounded.
+	if now.Sub(l.swept) >= FAILED_ATTEMPTS_LOCKOUT {
+		for key, w := range l.perIP {
+			if now.Sub(w.start) >= FAILED_ATTEMPTS_LOCKOUT {
+				delete(l.perIP, key)
+			}
+		}
+		l.swept = now
+	}
+	w, ok := l.perIP[ip]
+	if !ok || now.Sub(w.start) >= FAILED_ATTEMPTS_LOCKOUT {
+		w = &window{start: now}
+		l.perIP[ip] = w
+	}
+	w.count++
+
+	if id == 0 {
+		return false
+	}
+	l.perID[id]++
+	if l.perID[id] < MAX_FAILED_ATTEMPTS {
+		return false
+	}
+	delete(l.perID, id)
+	return true
+}
+
+// forget forgets the failed attempts against the mailbox established by the connection with the provided id,
+// as the id is freed.
+func (l *lockout) forget(id int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.perID, id)
+}
+
+// fail records a failed receiver attempt from the provided IP, against the mailbox established by the connection
+// with the provided id. The password of the mailbox is invalidated after MAX_FAILED_ATTEMPTS failed attempts.
+func (s *Server) fail(ip string, id int, logger *zap.Logger) {
+	p, ok := s.ids.Password(id)
+	if !ok {
+		// Attempts are only recorded against ids with an established mailbox.
+		id = 0
+	}
+	if s.lockout.fail(ip, id, time.Now()) {
+		logger.Warn("invalidating password after too many failed attempts", zap.Int("target_id", id))
+		s.mailboxes.Invalidate(p)
+	}
+}
@@ -0,0 +1,161 @@
+package rendezvous
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SpatiumPortae/portal/internal/conn"
+	pw "github.com/SpatiumPortae/portal/internal/password"
+	"github.com/SpatiumPortae/portal/internal/portal"
+	"github.com/SpatiumPortae/portal/internal/sender"
+	"github.com/SpatiumPortae/portal/protocol/rendezvous"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+)
+
+func TestLockoutFail(t *testing.T) {
+	l := newLockout()
+	now := time.Now()
+
+	for i := 1; i < MAX_FAILED_ATTEMPTS; i++ {
+		assert.False(t, l.fail("10.0.0.1", 1, now))
+	}
+	assert.True(t, l.fail("10.0.0.2", 1, now), "attempts against a mailbox are counted across IPs")
+	assert.False(t, l.fail("10.0.0.1", 1, now), "failed attempts are reset once the mailbox is invalidated")
+
+	// Attempts without an id are only counted against the IP.
+	for i := 0; i < 2*MAX_FAILED_ATTEMPTS; i++ {
+		assert.False(t, l.fail("10.0.0.3", 0, now))
+	}
+
+	l.fail("10.0.0.1", 2, now)
+	l.forget(2)
+	for i := 1; i < MAX_FAILED_ATTEMPTS; i++ {
+		assert.False(t, l.fail("10.0.0.4", 2, now), "failed attempts are forgotten once the id is freed")
+	}
+}
+
+func TestLockoutLocked(t *testing.T) {
+	l := newLockout()
+	now := time.Now()
+
+	for i := 0; i < MAX_FAILED_ATTEMPTS_PER_IP; i++ {
+		assert.False(t, l.locked("10.0.0.1", now))
+		l.fail("10.0.0.1", 0, now)
+	}
+	assert.True(t, l.locked("10.0.0.1", now))
+	assert.False(t, l.locked("10.0.0.2", now))
+	assert.False(t, l.locked("10.0.0.1", now.Add(FAILED_ATTEMPTS_LOCKOUT)))
+
+	// The IPs are forgotten once their lockout has passed.
+	l.fail("10.0.0.2", 0, now.Add(FAILED_ATTEMPTS_LOCKOUT))
+	assert.Len(t, l.perIP, 1)
+}
+
+// wrongPassword returns a password with the same id as the provided password, but other words.
+func wrongPassword(t *testing.T, password string) string {
+	id, err := pw.ID(password)
+	require.NoError(t, err)
+	for {
+		guess, err := pw.Generate(id)
+		require.NoError(t, err)
+		if guess != password {
+			return guess
+		}
+	}
+}
+
+func TestInvalidatePassword(t *testing.T) {
+	ctx := context.Background()
+	s, addr := newTestServer(t)
+	password, err, errC := portal.Send(ctx, bytes.NewReader([]byte("payload")), 7, &portal.Config{RendezvousAddr: addr})
+	require.NoError(t, err)
+
+	for i := 0; i < MAX_FAILED_ATTEMPTS; i++ {
+		err := portal.Receive(ctx, &bytes.Buffer{}, wrongPassword(t, password), &portal.Config{RendezvousAddr: addr})
+		assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrInvalidPassword.Error()})
+	}
+
+	// The sender is notified, and the password can no longer be used.
+	select {
+	case err := <-errC:
+		assert.ErrorIs(t, err, sender.ErrPasswordInvalidated)
+	case <-time.After(5 * time.Second):
+		t.Fatal("sender was not notified of the invalidated password")
+	}
+	err = portal.Receive(ctx, &bytes.Buffer{}, password, &portal.Config{RendezvousAddr: addr})
+	assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrInvalidPassword.Error()})
+	assert.Eventually(t, func() bool {
+		return len(s.mailboxes.Group(pw.Hashed(password))) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestLockedOut(t *testing.T) {
+	ctx := context.Background()
+	_, addr := newTestServer(t)
+
+	// Guesses for ids without a mailbox only count against the IP.
+	for i := 0; i < MAX_FAILED_ATTEMPTS_PER_IP; i++ {
+		err := portal.Receive(ctx, &bytes.Buffer{}, fmt.Sprintf("%d-guess-the-words", 100+i), &portal.Config{RendezvousAddr: addr})
+		assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrInvalidPassword.Error()})
+	}
+	err := portal.Receive(ctx, &bytes.Buffer{}, "1-guess-the-words", &portal.Config{RendezvousAddr: addr})
+	assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrLockedOut.Error()})
+}
+
+// establish establishes the provided hashed password for the provided id as a receiver, claiming the provided
+// forwarded address. Returns the error of the relay, if any.
+func establish(t *testing.T, addr string, forwarded string, id int, password string) error {
+	ctx := context.Background()
+	header := http.Header{}
+	header.Set("X-Forwarded-For", forwarded)
+	ws, _, err := websocket.Dial(ctx, addr+"/establish-receiver", &websocket.DialOptions{HTTPHeader: header})
+	require.NoError(t, err)
+	defer ws.CloseNow()
+	rc := conn.Rendezvous{Conn: &conn.WS{Conn: ws}}
+	require.NoError(t, rc.WriteMsg(ctx, rendezvous.Msg{
+		Type:    rendezvous.ReceiverToRendezvousEstablish,
+		Payload: rendezvous.Payload{ID: id, Password: password},
+	}))
+	_, err = rc.ReadMsg(ctx, rendezvous.RendezvousToReceiverPAKE)
+	return err
+}
+
+func TestGuessWithoutID(t *testing.T) {
+	ctx := context.Background()
+	_, addr := newTestServer(t)
+	password, err, _ := portal.Send(ctx, bytes.NewReader([]byte("payload")), 7, &portal.Config{RendezvousAddr: addr})
+	require.NoError(t, err)
+	id, err := pw.ID(password)
+	require.NoError(t, err)
+
+	// Passwords are only accepted with the id of the mailbox they were established by, so that guesses can not
+	// avoid counting against the mailbox they target.
+	for _, guess := range []int{0, id + 1, -1} {
+		err := establish(t, addr, "", guess, pw.Hashed(password))
+		assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrInvalidPassword.Error()}, "id %d", guess)
+	}
+	for i := 0; i < MAX_FAILED_ATTEMPTS; i++ {
+		err := establish(t, addr, "", id, pw.Hashed(wrongPassword(t, password)))
+		assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrInvalidPassword.Error()})
+	}
+	err = portal.Receive(ctx, &bytes.Buffer{}, password, &portal.Config{RendezvousAddr: addr})
+	assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrInvalidPassword.Error()}, "the password is invalidated")
+}
+
+func TestLockedOutSpoofedForwardedFor(t *testing.T) {
+	_, addr := newTestServer(t)
+
+	// Forwarding headers of untrusted clients are ignored, the lockout applies to the address of the connection.
+	for i := 0; i < MAX_FAILED_ATTEMPTS_PER_IP; i++ {
+		err := establish(t, addr, fmt.Sprintf("203.0.113.%d", i), 100+i, "guess")
+		assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrInvalidPassword.Error()})
+	}
+	err := establish(t, addr, "203.0.113.255", 1, "guess")
+	assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: ErrLockedOut.Error()})
+}
@@ -4,33 +4,213 @@ package rendezvous
 import (
 	"fmt"
 	"sync"
+
+	"github.com/SpatiumPortae/portal/protocol/rendezvous"
 )
 
 // Mailbox is a data structure that links together a sender and a receiver client.
 type Mailbox struct {
-	hasReceiver bool
+	hasReceiver    bool
+	awaitingSender bool // a listening receiver is waiting for the sender to join
 
 	Receiver chan []byte // messages to Receiver
 	Sender   chan []byte // messages to Sender
+
+	Abandoned   chan struct{} // closed if a listening receiver leaves after the sender has joined
+	Invalidated chan struct{} // closed if the password is invalidated before a receiver has claimed the mailbox
+
+	session *session
+}
+
+// newMailbox creates a mailbox with unbuffered channels.
+func newMailbox() *Mailbox {
+	return &Mailbox{
+		Sender:      make(chan []byte),
+		Receiver:    make(chan []byte),
+		Abandoned:   make(chan struct{}),
+		Invalidated: make(chan struct{}),
+		session:     newSession(),
+	}
+}
+
+// mailboxGroup is a set of mailboxes sharing the same password. A sender sending to
+// multiple receivers uses one mailbox, and one sender connection, per receiver.
+type mailboxGroup struct {
+	mu        sync.Mutex
+	capacity  int // capacity defines the maximum amount of mailboxes in the group
+	mailboxes []*Mailbox
 }
 
 type Mailboxes struct{ *sync.Map }
 
-// StoreMailbox allocates a mailbox.
-func (mailboxes *Mailboxes) StoreMailbox(p string, m *Mailbox) {
-	mailboxes.Store(p, m)
+// Allocate allocates a group of mailboxes for the provided password with room for the
+// provided amount of receivers, and returns the first mailbox in the group.
+func (mailboxes *Mailboxes) Allocate(p string, receivers int) (*Mailbox, error) {
+	if receivers < 1 || receivers > rendezvous.MAX_RECEIVERS {
+		return nil, fmt.Errorf("invalid amount of receivers %d, must be between 1 and %d", receivers, rendezvous.MAX_RECEIVERS)
+	}
+	mailbox := newMailbox()
+	group := &mailboxGroup{capacity: receivers, mailboxes: []*Mailbox{mailbox}}
+	if _, loaded := mailboxes.LoadOrStore(p, group); loaded {
+		return nil, fmt.Errorf("mailbox with password '%s' already exists", p)
+	}
+	return mailbox, nil
 }
 
-// GetMailbox returns the desired mailbox.
-func (mailboxes *Mailboxes) GetMailbox(p string) (*Mailbox, error) {
-	mailbox, ok := mailboxes.Load(p)
-	if !ok {
-		return nil, fmt.Errorf("no mailbox with password '%s'", p)
+// Listen allocates a mailbox for the provided password on behalf of a listening receiver.
+// The mailbox is reserved for the receiver and awaits a sender to join it.
+func (mailboxes *Mailboxes) Listen(p string) (*Mailbox, error) {
+	mailbox := newMailbox()
+	mailbox.hasReceiver = true
+	mailbox.awaitingSender = true
+	group := &mailboxGroup{capacity: 1, mailboxes: []*Mailbox{mailbox}}
+	if _, loaded := mailboxes.LoadOrStore(p, group); loaded {
+		return nil, fmt.Errorf("mailbox with password '%s' already exists", p)
 	}
-	return mailbox.(*Mailbox), nil
+	return mailbox, nil
 }
 
-// DeleteMailbox deallocates a mailbox.
-func (mailboxes *Mailboxes) DeleteMailbox(p string) {
-	mailboxes.Delete(p)
+// Unlisten deallocates the mailbox of a listening receiver that stops waiting for a sender.
+// If a sender has already joined the mailbox, the mailbox is kept for the sender to release,
+// and false is returned.
+func (mailboxes *Mailboxes) Unlisten(p string, m *Mailbox) bool {
+	group, err := mailboxes.group(p)
+	if err != nil {
+		return true
+	}
+	group.mu.Lock()
+	if !m.awaitingSender {
+		group.mu.Unlock()
+		return false
+	}
+	m.awaitingSender = false
+	group.mu.Unlock()
+	mailboxes.Release(p, m)
+	return true
+}
+
+// Join adds a mailbox for an additional sender connection to the group of mailboxes with the
+// provided password. If a listening receiver awaits a sender, its mailbox is joined instead.
+func (mailboxes *Mailboxes) Join(p string) (*Mailbox, error) {
+	group, err := mailboxes.group(p)
+	if err != nil {
+		return nil, err
+	}
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	for _, mailbox := range group.mailboxes {
+		if mailbox.awaitingSender {
+			mailbox.awaitingSender = false
+			return mailbox, nil
+		}
+	}
+	if len(group.mailboxes) >= group.capacity {
+		return nil, fmt.Errorf("mailbox with password '%s' is full", p)
+	}
+	mailbox := newMailbox()
+	group.mailboxes = append(group.mailboxes, mailbox)
+	return mailbox, nil
+}
+
+// Claim reserves a mailbox with the provided password for a receiver.
+func (mailboxes *Mailboxes) Claim(p string) (*Mailbox, error) {
+	group, err := mailboxes.group(p)
+	if err != nil {
+		return nil, err
+	}
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	for _, mailbox := range group.mailboxes {
+		if !mailbox.hasReceiver {
+			mailbox.hasReceiver = true
+			return mailbox, nil
+		}
+	}
+	return nil, fmt.Errorf("all mailboxes with password '%s' already have a receiver", p)
+}
+
+// Release deallocates the provided mailbox. The group of mailboxes is deallocated once
+// all of its mailboxes have been released.
+func (mailboxes *Mailboxes) Release(p string, m *Mailbox) {
+	group, err := mailboxes.group(p)
+	if err != nil {
+		return
+	}
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	for i, mailbox := range group.mailboxes {
+		if mailbox == m {
+			group.mailboxes = append(group.mailboxes[:i], group.mailboxes[i+1:]...)
+			break
+		}
+	}
+	if len(group.mailboxes) == 0 {
+		// No more mailboxes can join a deallocated group.
+		group.capacity = 0
+		mailboxes.CompareAndDelete(p, group)
+	}
+}
+
+// Invalidate deallocates the group of mailboxes with the provided password, after too many failed attempts to
+// claim a mailbox of the group. The mailboxes that have not been claimed by a receiver are closed as invalidated,
+// the group is kept if every mailbox has been claimed.
+func (mailboxes *Mailboxes) Invalidate(p string) {
+	group, err := mailboxes.group(p)
+	if err != nil {
+		return
+	}
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	invalidated := false
+	for _, mailbox := range group.mailboxes {
+		if !mailbox.hasReceiver {
+			mailbox.hasReceiver = true
+			close(mailbox.Invalidated)
+			invalidated = true
+		}
+	}
+	// Groups without mailboxes awaiting a receiver, such as those of listening receivers, are kept.
+	if !invalidated {
+		return
+	}
+	group.capacity = 0
+	mailboxes.CompareAndDelete(p, group)
+}
+
+// Count returns the amount of allocated mailboxes.
+func (mailboxes *Mailboxes) Count() int {
+	count := 0
+	mailboxes.Range(func(_, val any) bool {
+		group := val.(*mailboxGroup)
+		group.mu.Lock()
+		count += len(group.mailboxes)
+		group.mu.Unlock()
+		return true
+	})
+	return count
+}
+
+// Group returns the mailboxes with the provided password.
+func (mailboxes *Mailboxes) Group(p string) []*Mailbox {
+	group, err := mailboxes.group(p)
+	if err != nil {
+		return nil
+	}
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	return append([]*Mailbox{}, group.mailboxes...)
+}
+
+// Locate returns an empty address, as the mailboxes are only held by this server.
+func (mailboxes *Mailboxes) Locate(p string) (string, error) {
+	return "", nil
+}
+
+// group returns the group of mailboxes with the provided password.
+func (mailboxes *Mailboxes) group(p string) (*mailboxGroup, error) {
+	group, ok := mailboxes.Load(p)
+	if !ok {
+		return nil, fmt.Errorf("no mailbox with password '%s'", p)
+	}
+	return group.(*mailboxGroup), nil
 }
@@ -0,0 +1,158 @@
+package rendezvous
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/SpatiumPortae/portal/protocol/rendezvous"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMailboxes() *Mailboxes {
+	return &Mailboxes{&sync.Map{}}
+}
+
+func TestAllocate(t *testing.T) {
+	mailboxes := newMailboxes()
+	_, err := mailboxes.Allocate("pass", 1)
+	require.NoError(t, err)
+
+	_, err = mailboxes.Allocate("pass", 1)
+	assert.Error(t, err, "allocating an existing password")
+	_, err = mailboxes.Allocate("other", 0)
+	assert.Error(t, err, "allocating without receivers")
+	_, err = mailboxes.Allocate("other", rendezvous.MAX_RECEIVERS+1)
+	assert.Error(t, err, "allocating too many receivers")
+}
+
+func TestJoinAndClaim(t *testing.T) {
+	mailboxes := newMailboxes()
+	first, err := mailboxes.Allocate("pass", 2)
+	require.NoError(t, err)
+	second, err := mailboxes.Join("pass")
+	require.NoError(t, err)
+	assert.NotSame(t, first, second)
+
+	_, err = mailboxes.Join("pass")
+	assert.Error(t, err, "joining a full group")
+	_, err = mailboxes.Join("unknown")
+	assert.Error(t, err, "joining an unknown password")
+
+	// Every mailbox in the group is claimed by a single receiver.
+	claimed := []*Mailbox{}
+	for i := 0; i < 2; i++ {
+		mailbox, err := mailboxes.Claim("pass")
+		require.NoError(t, err)
+		claimed = append(claimed, mailbox)
+	}
+	assert.ElementsMatch(t, []*Mailbox{first, second}, claimed)
+	_, err = mailboxes.Claim("pass")
+	assert.Error(t, err, "claiming a group where every mailbox has a receiver")
+	_, err = mailboxes.Claim("unknown")
+	assert.Error(t, err, "claiming an unknown password")
+}
+
+func TestRelease(t *testing.T) {
+	mailboxes := newMailboxes()
+	first, err := mailboxes.Allocate("pass", 3)
+	require.NoError(t, err)
+	second, err := mailboxes.Join("pass")
+	require.NoError(t, err)
+
+	// The group is kept while any of its mailboxes are in use.
+	mailboxes.Release("pass", first)
+	_, err = mailboxes.Claim("pass")
+	require.NoError(t, err)
+
+	mailboxes.Release("pass", second)
+	_, ok := mailboxes.Load("pass")
+	assert.False(t, ok, "group is deallocated once every mailbox is released")
+
+	// Releasing twice does not affect a new group with the same password.
+	_, err = mailboxes.Allocate("pass", 1)
+	require.NoError(t, err)
+	mailboxes.Release("pass", second)
+	_, ok = mailboxes.Load("pass")
+	assert.True(t, ok)
+}
+
+func TestReleaseDeallocatedGroup(t *testing.T) {
+	mailboxes := newMailboxes()
+	mailbox, err := mailboxes.Allocate("pass", 2)
+	require.NoError(t, err)
+	group, err := mailboxes.group("pass")
+	require.NoError(t, err)
+	mailboxes.Release("pass", mailbox)
+
+	// A join racing with the deallocation can not add to the deallocated group.
+	mailboxes.Store("pass", group)
+	_, err = mailboxes.Join("pass")
+	assert.Error(t, err)
+}
+
+func TestListen(t *testing.T) {
+	mailboxes := newMailboxes()
+	listening, err := mailboxes.Listen("pass")
+	require.NoError(t, err)
+	_, err = mailboxes.Listen("pass")
+	assert.Error(t, err, "listening on an existing password")
+
+	// The sender joins the mailbox of the listening receiver, which is not claimable by other receivers.
+	_, err = mailboxes.Claim("pass")
+	assert.Error(t, err)
+	joined, err := mailboxes.Join("pass")
+	require.NoError(t, err)
+	assert.Same(t, listening, joined)
+	_, err = mailboxes.Join("pass")
+	assert.Error(t, err, "joining a listening receiver that already has a sender")
+}
+
+func TestUnlisten(t *testing.T) {
+	mailboxes := newMailboxes()
+	listening, err := mailboxes.Listen("pass")
+	require.NoError(t, err)
+	assert.True(t, mailboxes.Unlisten("pass", listening))
+	_, err = mailboxes.Join("pass")
+	assert.Error(t, err, "joining a receiver that stopped listening")
+	_, ok := mailboxes.Load("pass")
+	assert.False(t, ok)
+
+	// A receiver that stops listening after the sender has joined keeps the mailbox for the sender.
+	listening, err = mailboxes.Listen("pass")
+	require.NoError(t, err)
+	_, err = mailboxes.Join("pass")
+	require.NoError(t, err)
+	assert.False(t, mailboxes.Unlisten("pass", listening))
+	_, ok = mailboxes.Load("pass")
+	assert.True(t, ok)
+}
+
+func TestInvalidate(t *testing.T) {
+	mailboxes := newMailboxes()
+	first, err := mailboxes.Allocate("pass", 2)
+	require.NoError(t, err)
+	second, err := mailboxes.Join("pass")
+	require.NoError(t, err)
+	claimed, err := mailboxes.Claim("pass")
+	require.NoError(t, err)
+	require.Equal(t, first, claimed)
+
+	mailboxes.Invalidate("pass")
+	// Only the mailbox without a receiver is invalidated, the claimed mailbox is kept until released.
+	select {
+	case <-second.Invalidated:
+	default:
+		t.Fatal("mailbox without a receiver was not invalidated")
+	}
+	select {
+	case <-first.Invalidated:
+		t.Fatal("claimed mailbox was invalidated")
+	default:
+	}
+	_, err = mailboxes.Claim("pass")
+	assert.Error(t, err, "claiming an invalidated password")
+	_, err = mailboxes.Join("pass")
+	assert.Error(t, err, "joining an invalidated password")
+	mailboxes.Release("pass", first)
+}
@@ -0,0 +1,91 @@
+// metrics.go specifies the prometheus metrics exposed by the rendezvous server.
+package rendezvous
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Directions of the relayed bytes.
+const (
+	directionToReceiver = "sender_to_receiver"
+	directionToSender   = "receiver_to_sender"
+)
+
+// Stages of the handshake between sender and receiver.
+const (
+	stageBind      = "bind"
+	stageEstablish = "establish"
+	stagePAKE      = "pake"
+	stageSalt      = "salt"
+)
+
+// Outcomes of a transfer, as observed by the server when the receiver closes its connection, see session.outcome.
+const (
+	outcomeDirect = "direct"
+	outcomeRelay  = "relay"
+)
+
+// metrics holds the metrics of a server, registered on its own registry.
+type metrics struct {
+	registry          *prometheus.Registry
+	relayedBytes      *prometheus.CounterVec
+	transferDuration  prometheus.Histogram
+	handshakeFailures *prometheus.CounterVec
+	outcomes          *prometheus.CounterVec
+}
+
+// newMetrics creates the metrics of the provided server.
+func newMetrics(s *Server) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		relayedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "portal",
+			Name:      "relayed_bytes_total",
+			Help:      "Bytes relayed between senders and receivers, by direction.",
+		}, []string{"direction"}),
+		transferDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "portal",
+			Name:      "transfer_duration_seconds",
+			Help:      "Duration of the connections between senders and receivers, from the completed handshake until closed.",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 4, 10),
+		}),
+		handshakeFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "portal",
+			Name:      "handshake_failures_total",
+			Help:      "Failed handshakes between senders and receivers, by stage.",
+		}, []string{"stage"}),
+		outcomes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "portal",
+			Name:      "transfer_outcomes_total",
+			Help:      "Transfers by whether the receiver connected directly to the sender, or relayed the transfer.",
+		}, []string{"outcome"}),
+	}
+	m.registry.MustRegister(
+		m.relayedBytes,
+		m.transferDuration,
+		m.handshakeFailures,
+		m.outcomes,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "portal",
+			Name:      "active_mailboxes",
+			Help:      "Mailboxes currently allocated, one per receiver of every transfer.",
+		}, func() float64 { return float64(s.mailboxes.Count()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "portal",
+			Name:      "bound_ids",
+			Help:      "Connection IDs currently bound.",
+		}, func() float64 { return float64(s.ids.Count()) }),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// handleMetrics returns a handler exposing the metrics in the prometheus format.
+func (s *Server) handleMetrics() http.Handler {
+	return promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{})
+}
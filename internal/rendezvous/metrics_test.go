@@ -0,0 +1,76 @@
+package rendezvous
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SpatiumPortae/portal/internal/portal"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	s, addr := newTestServer(t, WithAdminToken("admin"))
+	payload := make([]byte, 100000)
+	_, err := rand.Read(payload)
+	require.NoError(t, err)
+
+	password, err, errC := portal.Send(ctx, bytes.NewReader(payload), int64(len(payload)), &portal.Config{RendezvousAddr: addr})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return s.mailboxes.Count() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Error(t, portal.Receive(ctx, &bytes.Buffer{}, wrongPassword(t, password), &portal.Config{RendezvousAddr: addr}))
+	require.NoError(t, portal.Receive(ctx, &bytes.Buffer{}, password, &portal.Config{RendezvousAddr: addr}))
+	for err := range errC {
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.handshakeFailures.WithLabelValues(stageEstablish)))
+	// The handshake between sender and receiver is relayed, whether the transfer is direct or not.
+	assert.Greater(t, testutil.ToFloat64(s.metrics.relayedBytes.WithLabelValues(directionToReceiver)), 0.0)
+	assert.Greater(t, testutil.ToFloat64(s.metrics.relayedBytes.WithLabelValues(directionToSender)), 0.0)
+	// The receiver connects directly to the sender on the same host.
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(s.metrics.outcomes.WithLabelValues(outcomeDirect)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, testutil.ToFloat64(s.metrics.outcomes.WithLabelValues(outcomeRelay)))
+
+	assert.Eventually(t, func() bool {
+		r := adminRequest(t, addr, http.MethodGet, "/metrics", "admin")
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		return bytes.Contains(b, []byte("portal_active_mailboxes 0")) &&
+			bytes.Contains(b, []byte("portal_bound_ids 0")) &&
+			bytes.Contains(b, []byte("portal_transfer_duration_seconds_count 1"))
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestMetricsAuthentication(t *testing.T) {
+	_, addr := newTestServer(t)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, addr, http.MethodGet, "/metrics", "").StatusCode, "metrics without admin token")
+
+	_, addr = newTestServer(t, WithAdminToken("admin"), WithTokens("client"))
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(t, addr, http.MethodGet, "/metrics", "").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(t, addr, http.MethodGet, "/metrics", "client").StatusCode)
+	assert.Equal(t, http.StatusOK, adminRequest(t, addr, http.MethodGet, "/metrics", "admin").StatusCode)
+
+	_, addr = newTestServer(t, WithAdminToken("admin"), WithPublicMetrics())
+	assert.Equal(t, http.StatusOK, adminRequest(t, addr, http.MethodGet, "/metrics", "").StatusCode)
+}
+
+func TestSessionOutcome(t *testing.T) {
+	// The outcome is observed from the messages relayed to the receiver, whatever the receiver claims.
+	s := newSession()
+	s.toReceiver.Add(MAX_DIRECT_RELAYED_MESSAGES)
+	assert.Equal(t, outcomeDirect, s.outcome())
+	s.toReceiver.Add(1)
+	assert.Equal(t, outcomeRelay, s.outcome())
+}
@@ -0,0 +1,66 @@
+// redis.go specifies the Store shared by the servers of a cluster running on different hosts.
+package rendezvous
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// compareAndDelete deletes a key if it holds the provided value, atomically.
+var compareAndDelete = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisStore is a Store backed by Redis, which can be shared by servers running on different hosts.
+// The keys expire after STORE_TTL, so that the keys of a server that stopped without deleting them are
+// eventually released.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore connects to the Redis server with the provided URL, such as "redis://:password@10.0.0.2:6379/0",
+// or "rediss://" for Redis served using TLS.
+func NewRedisStore(url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redis url: %w", err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), STORE_TIMEOUT)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to redis: %w", err)
+	}
+	return &RedisStore{client: client}, nil
+}
+
+func (r *RedisStore) SetNX(ctx context.Context, key string, value string) (bool, error) {
+	return r.client.SetNX(ctx, key, value, STORE_TTL).Result()
+}
+
+func (r *RedisStore) Get(ctx context.Context, key string) (string, bool, error) {
+	value, err := r.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (r *RedisStore) CompareAndDelete(ctx context.Context, key string, value string) error {
+	return compareAndDelete.Run(ctx, r.client, []string{key}, value).Err()
+}
+
+// Close closes the connections to the Redis server.
+func (r *RedisStore) Close() error {
+	return r.client.Close()
+}
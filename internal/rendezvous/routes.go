@@ -1,18 +1,40 @@
 package rendezvous
 
 import (
+	"net/http"
+
 	"github.com/SpatiumPortae/portal/internal/conn"
+	"github.com/SpatiumPortae/portal/internal/link"
 	"github.com/SpatiumPortae/portal/internal/logger"
 )
 
 func (s *Server) routes() {
-	s.router.Use(logger.Middleware(s.logger))
+	s.router.Use(logger.Middleware(s.logger, s.clientIP))
 	s.router.HandleFunc("/", s.handleLandingPage())
+	s.router.HandleFunc(link.WEB_PATH+"{password}", s.handleReceivePage()).Methods(http.MethodGet)
 	s.router.HandleFunc("/ping", s.ping())
 	s.router.HandleFunc("/version", s.handleVersionCheck())
+	if s.publicMetrics {
+		s.router.Handle("/metrics", s.handleMetrics())
+	}
+
+	if s.adminToken != "" {
+		if !s.publicMetrics {
+			s.router.Handle("/metrics", authenticate([]string{s.adminToken})(s.handleMetrics()))
+		}
+		admin := s.router.PathPrefix("/admin").Subrouter()
+		admin.Use(authenticate([]string{s.adminToken}))
+		admin.HandleFunc("/status", s.handleAdminStatus()).Methods(http.MethodGet)
+		admin.HandleFunc("/sessions", s.handleAdminSessions()).Methods(http.MethodGet)
+		admin.HandleFunc("/sessions/{id:[0-9]+}", s.handleAdminTerminate()).Methods(http.MethodDelete)
+	}
+
+	// New transfers are refused before upgrading to a websocket connection while draining.
+	s.router.Path("/establish-sender").MatcherFunc(s.isDraining).Handler(s.handleDraining())
 
 	portal := s.router.PathPrefix("").Subrouter()
-	portal.Use(conn.Middleware())
+	portal.Use(s.track(), authenticate(s.tokens), conn.Middleware(), s.limit())
 	portal.HandleFunc("/establish-sender", s.handleEstablishSender())
+	portal.HandleFunc("/join-sender", s.handleJoinSender())
 	portal.HandleFunc("/establish-receiver", s.handleEstablishReceiver())
 }
@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/SpatiumPortae/portal/internal/logger"
@@ -20,16 +24,90 @@ import (
 type Server struct {
 	httpServer *http.Server
 	router     *mux.Router
-	mailboxes  *Mailboxes
-	ids        *IDs
+	mailboxes  MailboxStore
+	ids        IDStore
 	signal     chan os.Signal
 	logger     *zap.Logger
 	templates  map[string]*template.Template
 	version    *semver.Version
+	tlsCert    string
+	tlsKey     string
+	tokens     []string
+	limiter    *limiter
+	lockout    *lockout
+	metrics    *metrics
+	adminToken string
+	started    time.Time
+
+	minID, maxID int
+	cluster      *cluster // nil unless sharing the mailboxes and ids with other servers
+
+	trustedProxies []netip.Prefix // proxies whose forwarding headers are trusted, see clientIP
+	publicMetrics  bool           // metrics are exposed without authentication
+
+	drainTimeout time.Duration
+	draining     atomic.Bool  // new transfers are refused while draining
+	active       atomic.Int64 // connections being handled
+}
+
+// Option configures the rendezvous server.
+type Option func(s *Server)
+
+// WithTLS makes the server terminate TLS itself, using the provided certificate and key files.
+func WithTLS(certFile string, keyFile string) Option {
+	return func(s *Server) {
+		s.tlsCert = certFile
+		s.tlsKey = keyFile
+	}
+}
+
+// WithTokens makes the server require portal connections to authenticate using one of the provided bearer tokens.
+func WithTokens(tokens ...string) Option {
+	return func(s *Server) {
+		s.tokens = tokens
+	}
+}
+
+// WithAdminToken enables the admin API, requiring requests to it to authenticate using the provided bearer token.
+func WithAdminToken(token string) Option {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// WithPublicMetrics exposes the metrics without authentication. Otherwise, the metrics are only exposed with the
+// admin API, and requests to them authenticate using the admin token, see WithAdminToken.
+func WithPublicMetrics() Option {
+	return func(s *Server) {
+		s.publicMetrics = true
+	}
+}
+
+// WithIDRange makes the server bind the ids of connections, which prefix the passwords, from the range between the
+// provided min and max id, inclusive.
+func WithIDRange(min, max int) Option {
+	return func(s *Server) {
+		s.minID = min
+		s.maxID = max
+	}
+}
+
+// WithDrainTimeout sets the duration that the server waits for transfers in progress to finish when shutting down.
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.drainTimeout = timeout
+	}
+}
+
+// WithLimits limits the resources that clients can hold on the server.
+func WithLimits(limits Limits) Option {
+	return func(s *Server) {
+		s.limiter = newLimiter(limits)
+	}
 }
 
 // NewServer constructs a new Server struct and setups the routes.
-func NewServer(port int, version semver.Version) *Server {
+func NewServer(port int, version semver.Version, opts ...Option) *Server {
 	router := &mux.Router{}
 	lgr := logger.New()
 	stdLoggerWrapper, err := zap.NewStdLogAt(lgr, zap.ErrorLevel)
@@ -49,19 +127,37 @@ func NewServer(port int, version semver.Version) *Server {
 			ErrorLog:     stdLoggerWrapper,
 		},
 		router:    router,
-		mailboxes: &Mailboxes{&sync.Map{}},
-		ids:       &IDs{&sync.Map{}},
 		logger:    lgr,
 		templates: tmpls,
 		version:   &version,
+		limiter:   newLimiter(Limits{}),
+		lockout:   newLockout(),
+		started:   time.Now(),
+		signal:    make(chan os.Signal, 1),
+
+		minID:        MIN_ID,
+		maxID:        MAX_ID,
+		drainTimeout: DRAIN_TIMEOUT,
+	}
+	s.metrics = newMetrics(s)
+	for _, opt := range opts {
+		opt(s)
+	}
+	mailboxes, ids := &Mailboxes{&sync.Map{}}, NewIDs(s.minID, s.maxID)
+	s.mailboxes, s.ids = mailboxes, ids
+	if s.cluster != nil {
+		s.mailboxes = &clusterMailboxes{Mailboxes: mailboxes, cluster: s.cluster}
+		s.ids = &clusterIDs{IDs: ids, cluster: s.cluster}
 	}
 	s.routes()
 	return s
 }
 
-// Start runs the rendezvous server.
+// Start runs the rendezvous server. When terminated, the server drains the transfers in progress
+// before shutting down.
 func (s *Server) Start() {
 	ctx, cancel := context.WithCancel(context.Background())
+	signal.Notify(s.signal, syscall.SIGTERM)
 
 	go func() {
 		<-s.signal
@@ -77,7 +173,12 @@ func (s *Server) Start() {
 // serve is a helper function providing graceful shutdown of the server.
 func serve(s *Server, ctx context.Context) (err error) {
 	go func() {
-		if err = s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if s.tlsCert != "" {
+			err = s.httpServer.ListenAndServeTLS(s.tlsCert, s.tlsKey)
+		} else {
+			err = s.httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			s.logger.Fatal("serving portal", zap.Error(err), zap.Stack("stack_trace"))
 		}
 	}()
@@ -85,8 +186,12 @@ func serve(s *Server, ctx context.Context) (err error) {
 	s.logger.
 		With(zap.String("version", s.version.String())).
 		With(zap.String("address", s.httpServer.Addr)).
+		With(zap.Bool("tls", s.tlsCert != "")).
+		With(zap.Bool("authentication", len(s.tokens) > 0)).
+		With(zap.Bool("admin", s.adminToken != "")).
 		Info("serving rendezvous server")
 	<-ctx.Done()
+	s.drain()
 
 	ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer func() {
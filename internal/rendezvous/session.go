@@ -0,0 +1,108 @@
+// session.go specifies the metadata kept about the communication through a mailbox.
+package rendezvous
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SpatiumPortae/portal/internal/conn"
+	"github.com/SpatiumPortae/portal/internal/throttle"
+	"golang.org/x/time/rate"
+)
+
+// Stages of a session.
+const (
+	sessionWaiting   = "waiting"
+	sessionHandshake = "handshake"
+	sessionRelaying  = "relaying"
+)
+
+// peer is a client communicating through a mailbox.
+type peer struct {
+	ip     string
+	rc     conn.Rendezvous
+	cancel context.CancelFunc // terminates the handler of the client
+}
+
+// session holds the metadata of the communication through a mailbox.
+type session struct {
+	created    time.Time
+	relayed    atomic.Int64
+	toReceiver atomic.Int64 // the amount of messages relayed from the sender to the receiver, see outcome
+
+	mu         sync.Mutex
+	rate       *rate.Limiter
+	stage      string
+	sender     peer
+	receiver   peer
+	terminated bool
+}
+
+func newSession() *session {
+	return &session{created: time.Now(), stage: sessionWaiting}
+}
+
+// outcome returns whether the transfer of the session was direct or relayed, judging by the messages relayed to
+// the receiver. Only the handshake of the sender is relayed to receivers connecting directly to the sender, while
+// relayed transfers relay the payload and the closing handshake as well.
+func (s *session) outcome() string {
+	if s.toReceiver.Load() > MAX_DIRECT_RELAYED_MESSAGES {
+		return outcomeRelay
+	}
+	return outcomeDirect
+}
+
+// attachSender attaches the sender communicating through the mailbox to the session.
+func (s *session) attachSender(p peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sender = p
+	if s.terminated {
+		p.cancel()
+	}
+}
+
+// attachReceiver attaches the receiver communicating through the mailbox to the session.
+func (s *session) attachReceiver(p peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.receiver = p
+	if s.terminated {
+		p.cancel()
+	}
+}
+
+// rateLimiter returns the token bucket limiting the bytes relayed in the session to the provided amount
+// of bytes per second, or nil without a limit. The bucket is shared by the sender and receiver.
+func (s *session) rateLimiter(bytesPerSecond int64) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rate == nil {
+		s.rate = throttle.New(bytesPerSecond)
+	}
+	return s.rate
+}
+
+// setStage sets the stage of the session.
+func (s *session) setStage(stage string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stage = stage
+}
+
+// terminate marks the session as terminated, and returns the peers attached to it, which are to be notified and
+// terminated by the caller. Peers attached later are terminated when attached.
+func (s *session) terminate() []peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.terminated = true
+	var peers []peer
+	for _, p := range []peer{s.sender, s.receiver} {
+		if p.cancel != nil {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
@@ -5,10 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/SpatiumPortae/portal/internal/relay"
 )
 
 const pattern = `^v(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)$`
@@ -85,8 +86,8 @@ func (sv Version) Compare(oracle Version) Comparison {
 	}
 }
 
-func GetRendezvousVersion(ctx context.Context, addr string) (Version, error) {
-	r, err := http.Get(fmt.Sprintf("http://%s/version", addr))
+func GetRendezvousVersion(ctx context.Context, addr string, opts ...relay.Option) (Version, error) {
+	r, err := relay.Get(ctx, addr, "/version", opts...)
 	if err != nil {
 		return Version{}, fmt.Errorf("fetching the latest version from relay: %w", err)
 	}
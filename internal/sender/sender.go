@@ -4,23 +4,106 @@ import (
 	"bufio"
 	"context"
 	crypto_rand "crypto/rand"
+	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/SpatiumPortae/portal/internal/conn"
 	"github.com/SpatiumPortae/portal/internal/password"
+	"github.com/SpatiumPortae/portal/internal/relay"
+	"github.com/SpatiumPortae/portal/internal/throttle"
 	"github.com/SpatiumPortae/portal/protocol/rendezvous"
 	"github.com/SpatiumPortae/portal/protocol/transfer"
 	"github.com/schollz/pake/v3"
-	"nhooyr.io/websocket"
 )
 
 const MAX_CHUNK_BYTES = 1e6
 const MAX_SEND_CHUNKS = 2e8
 
-// ConnectRendezvous creates a connection with the rendezvous server and acquires a password associated with the connection
-func ConnectRendezvous(ctx context.Context, addr string) (conn.Rendezvous, string, error) {
-	ws, _, err := websocket.Dial(context.Background(), fmt.Sprintf("ws://%s/establish-sender", addr), nil)
+// REJECTION_TIMEOUT is how long a sender that failed to write waits for the reason the connection was terminated.
+const REJECTION_TIMEOUT = time.Second
+
+// ErrPayloadNotSeekable is returned when the receiver requests to resume a transfer
+// of a payload that does not support seeking.
+var ErrPayloadNotSeekable = errors.New("payload does not support resuming transfers")
+
+// ErrChecksumRejected is returned when the receiver rejects the payload, as the checksum of
+// the received payload does not match the checksum announced by the sender.
+var ErrChecksumRejected = errors.New("receiver rejected the payload: checksum mismatch")
+
+// ErrPasswordInvalidated is returned when the rendezvous server invalidates the password,
+// as receivers have failed to connect using it too many times.
+var ErrPasswordInvalidated = errors.New("someone tried to receive using a wrong password too many times, the password is invalidated")
+
+// StreamedPayload is implemented by payloads that are produced while being sent, such as
+// archives that are compressed on the fly. The payload size of a streamed payload is only an
+// estimate, and the progress of the transfer is reported by the payload itself.
+type StreamedPayload interface {
+	io.Reader
+	Progress() int64
+}
+
+// TypedPayload is implemented by payloads that are not archives of files, such as text, and by archives
+// of a single file. The type and name of the payload are announced to the receiver, which handles the
+// payload according to its type.
+type TypedPayload interface {
+	io.Reader
+	PayloadType() transfer.PayloadType
+	PayloadName() string
+}
+
+// payloadInfo implements the methods of TypedPayload.
+type payloadInfo struct {
+	payloadType transfer.PayloadType
+	name        string
+}
+
+func (p payloadInfo) PayloadType() transfer.PayloadType {
+	return p.payloadType
+}
+
+func (p payloadInfo) PayloadName() string {
+	return p.name
+}
+
+// typedPayload is a TypedPayload reading a section of a io.ReaderAt.
+type typedPayload struct {
+	*io.SectionReader
+	payloadInfo
+}
+
+// typedStream is a TypedPayload that is produced while being sent.
+type typedStream struct {
+	StreamedPayload
+	payloadInfo
+}
+
+// NewTypedPayload returns a payload of the provided type and name, which reads size bytes from the provided reader.
+// The payload implements io.Seeker and io.ReaderAt, such that it can be resumed and sent to multiple receivers.
+func NewTypedPayload(r io.ReaderAt, size int64, payloadType transfer.PayloadType, name string) TypedPayload {
+	return &typedPayload{SectionReader: io.NewSectionReader(r, 0, size), payloadInfo: payloadInfo{payloadType, name}}
+}
+
+// NewTypedStream returns a streamed payload of the provided type and name.
+func NewTypedStream(payload StreamedPayload, payloadType transfer.PayloadType, name string) TypedPayload {
+	return &typedStream{StreamedPayload: payload, payloadInfo: payloadInfo{payloadType, name}}
+}
+
+// SectionPayload returns a reader of the payload that is independent of other readers of it, such that the
+// payload can be sent to several receivers concurrently. The type and name of typed payloads are kept.
+func SectionPayload(payload io.ReaderAt, size int64) io.Reader {
+	if typed, ok := payload.(TypedPayload); ok {
+		return NewTypedPayload(payload, size, typed.PayloadType(), typed.PayloadName())
+	}
+	return io.NewSectionReader(payload, 0, size)
+}
+
+// ConnectRendezvous creates a connection with the rendezvous server and acquires a password associated with the connection.
+// The rendezvous server reserves room for the provided amount of receivers, each additional receiver is connected to using JoinRendezvous.
+// The password is generated using the provided generator.
+func ConnectRendezvous(ctx context.Context, addr string, receivers int, gen password.Generator, opts ...relay.Option) (conn.Rendezvous, string, error) {
+	ws, err := relay.DialWS(context.Background(), addr, "/establish-sender", opts...)
 	if err != nil {
 		return conn.Rendezvous{}, "", err
 	}
@@ -31,7 +114,8 @@ func ConnectRendezvous(ctx context.Context, addr string) (conn.Rendezvous, strin
 	if err != nil {
 		return conn.Rendezvous{}, "", err
 	}
-	pass, err := password.Generate(msg.Payload.ID)
+
+	pass, err := gen.Generate(msg.Payload.ID)
 	if err != nil {
 		return conn.Rendezvous{}, "", err
 	}
@@ -39,7 +123,8 @@ func ConnectRendezvous(ctx context.Context, addr string) (conn.Rendezvous, strin
 	if err := rc.WriteMsg(ctx, rendezvous.Msg{
 		Type: rendezvous.SenderToRendezvousEstablish,
 		Payload: rendezvous.Payload{
-			Password: password.Hashed(pass),
+			Password:  password.Hashed(pass),
+			Receivers: receivers,
 		},
 	}); err != nil {
 		return conn.Rendezvous{}, "", err
@@ -47,6 +132,27 @@ func ConnectRendezvous(ctx context.Context, addr string) (conn.Rendezvous, strin
 	return rc, string(pass), nil
 }
 
+// JoinRendezvous creates a connection with the rendezvous server for a password that is already established,
+// either by ConnectRendezvous in order to send to another receiver, or by a listening receiver.
+func JoinRendezvous(ctx context.Context, addr string, pass string, opts ...relay.Option) (conn.Rendezvous, error) {
+	ws, err := relay.DialWS(context.Background(), addr, "/join-sender", opts...)
+	if err != nil {
+		return conn.Rendezvous{}, err
+	}
+
+	rc := conn.Rendezvous{Conn: &conn.WS{Conn: ws}}
+
+	if err := rc.WriteMsg(ctx, rendezvous.Msg{
+		Type: rendezvous.SenderToRendezvousJoin,
+		Payload: rendezvous.Payload{
+			Password: password.Hashed(pass),
+		},
+	}); err != nil {
+		return conn.Rendezvous{}, err
+	}
+	return rc, nil
+}
+
 // SecureConnection does the cryptographic handshake in order to resolve a secure channel to do file transfer over.
 func SecureConnection(ctx context.Context, rc conn.Rendezvous, password string) (conn.Transfer, error) {
 	p, err := pake.InitCurve([]byte(password), 0, "p256")
@@ -55,10 +161,13 @@ func SecureConnection(ctx context.Context, rc conn.Rendezvous, password string)
 	}
 
 	// Wait for for the receiver to be ready.
-	_, err = rc.ReadMsg(ctx, rendezvous.RendezvousToSenderReady)
+	msg, err := rc.ReadMsg(ctx, rendezvous.RendezvousToSenderReady, rendezvous.RendezvousToSenderInvalidated)
 	if err != nil {
 		return conn.Transfer{}, err
 	}
+	if msg.Type == rendezvous.RendezvousToSenderInvalidated {
+		return conn.Transfer{}, ErrPasswordInvalidated
+	}
 
 	// Start the key exchange.
 	err = rc.WriteMsg(ctx, rendezvous.Msg{
@@ -71,7 +180,7 @@ func SecureConnection(ctx context.Context, rc conn.Rendezvous, password string)
 		return conn.Transfer{}, err
 	}
 
-	msg, err := rc.ReadMsg(ctx)
+	msg, err = rc.ReadMsg(ctx)
 	if err != nil {
 		return conn.Transfer{}, err
 	}
@@ -105,32 +214,61 @@ func SecureConnection(ctx context.Context, rc conn.Rendezvous, password string)
 }
 
 // Transfer performs the file transfer, either directly or using the Rendezvous server as a relay.
+// The transfer is throttled to the limit of the context, see throttle.WithLimit.
 func Transfer(ctx context.Context, tc conn.Transfer, payload io.Reader, payloadSize int64, msgs ...chan interface{}) error {
 	return doTransfer(ctx, tc, payload, payloadSize, msgs...)
 }
 
 // transferSequence is a helper method that actually performs the transfer sequence.
 func transferSequence(ctx context.Context, tc conn.Transfer, payload io.Reader, payloadSize int64, msgs ...chan interface{}) error {
-	_, err := tc.ReadMsg(ctx, transfer.ReceiverRequestPayload)
+	msg, err := tc.ReadMsg(ctx, transfer.ReceiverRequestPayload)
 	if err != nil {
 		return err
 	}
 
+	// The receiver might already have parts of the payload from a previous attempt.
+	offset := msg.Payload.Offset
+	checksum := transfer.NewChecksum()
+	if err := seekPayload(payload, offset, payloadSize, checksum); err != nil {
+		return err
+	}
+
 	if len(msgs) > 0 {
 		msgs[0] <- transfer.ReceiverRequestPayload
 	}
 
-	if err := transferPayload(ctx, tc, payload, payloadSize, msgs...); err != nil {
-		return err
+	// The acknowledgement is awaited while the payload is sent, so that the sender learns why the connection
+	// was terminated, such as the rendezvous server rejecting a relayed transfer, instead of only failing to write.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ack := make(chan ackResult, 1)
+	go func() {
+		msg, err := tc.ReadMsg(ctx, transfer.ReceiverPayloadAck, transfer.ReceiverChecksumMismatch)
+		if err != nil {
+			cancel()
+		}
+		ack <- ackResult{msg: msg, err: err}
+	}()
+
+	if err := transferPayload(ctx, tc, payload, checksum, payloadSize, offset, msgs...); err != nil {
+		return rejection(ack, err)
 	}
 
-	if err := tc.WriteMsg(ctx, transfer.Msg{Type: transfer.SenderPayloadSent}); err != nil {
-		return err
+	if err := tc.WriteMsg(ctx, transfer.Msg{
+		Type: transfer.SenderPayloadSent,
+		Payload: transfer.Payload{
+			Checksum: checksum.Sum(nil),
+		},
+	}); err != nil {
+		return rejection(ack, err)
 	}
 
-	_, err = tc.ReadMsg(ctx, transfer.ReceiverPayloadAck)
-	if err != nil {
-		return err
+	result := <-ack
+	if result.err != nil {
+		return result.err
+	}
+	if result.msg.Type == transfer.ReceiverChecksumMismatch {
+		return ErrChecksumRejected
 	}
 
 	if err := tc.WriteMsg(ctx, transfer.Msg{Type: transfer.SenderClosing}); err != nil {
@@ -140,11 +278,33 @@ func transferSequence(ctx context.Context, tc conn.Transfer, payload io.Reader,
 	return nil
 }
 
-// transferPayload sends the files in chunks to the sender.
-func transferPayload(ctx context.Context, tc conn.Transfer, payload io.Reader, payloadSize int64, msgs ...chan interface{}) error {
-	bufReader := bufio.NewReader(payload)
+// ackResult is the outcome of awaiting the acknowledgement of the receiver.
+type ackResult struct {
+	msg transfer.Msg
+	err error
+}
+
+// rejection returns the rejection of the rendezvous server if it terminated the connection,
+// and otherwise the provided error.
+func rejection(ack <-chan ackResult, err error) error {
+	select {
+	case result := <-ack:
+		var rejected rendezvous.RejectedError
+		if errors.As(result.err, &rejected) {
+			return rejected
+		}
+	case <-time.After(REJECTION_TIMEOUT):
+	}
+	return err
+}
+
+// transferPayload sends the files in chunks to the sender, starting from the provided offset.
+// The sent bytes are written to the provided checksum, at the rate limited by the context.
+func transferPayload(ctx context.Context, tc conn.Transfer, payload io.Reader, checksum io.Writer, payloadSize int64, offset int64, msgs ...chan interface{}) error {
+	streamed, isStreamed := payload.(StreamedPayload)
+	bufReader := bufio.NewReader(io.TeeReader(payload, checksum))
 	buffer := make([]byte, chunkSize(payloadSize))
-	bytesSent := 0
+	bytesSent := int(offset)
 	for {
 		n, err := bufReader.Read(buffer)
 		bytesSent += n
@@ -154,19 +314,47 @@ func transferPayload(ctx context.Context, tc conn.Transfer, payload io.Reader, p
 		if err != nil {
 			return err
 		}
+		if err := throttle.Wait(ctx, n); err != nil {
+			return err
+		}
 		err = tc.WriteRaw(ctx, buffer[:n])
 		if err != nil {
 			return err
 		}
 
 		if len(msgs) > 0 {
-			msgs[0] <- bytesSent
+			if isStreamed {
+				msgs[0] <- int(streamed.Progress())
+			} else {
+				msgs[0] <- bytesSent
+			}
 		}
 
 	}
 	return nil
 }
 
+// seekPayload seeks the payload to the provided offset. The skipped part of the payload is
+// written to the provided checksum, so that the checksum covers the entire payload.
+// Payloads that do not implement io.Seeker can only be sent from the start.
+func seekPayload(payload io.Reader, offset int64, payloadSize int64, checksum io.Writer) error {
+	if offset < 0 || offset > payloadSize {
+		return fmt.Errorf("invalid payload offset %d requested, payload size is %d", offset, payloadSize)
+	}
+	seeker, ok := payload.(io.Seeker)
+	if !ok {
+		if offset > 0 {
+			return ErrPayloadNotSeekable
+		}
+		return nil
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.CopyN(checksum, payload, offset)
+	return err
+}
+
 // chunkSize returns an appropriate chunk size for the payload size.
 func chunkSize(payloadSize int64) int64 {
 	// clamp amount of chunks to be at most MAX_SEND_CHUNKS if it exceeds
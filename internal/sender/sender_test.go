@@ -0,0 +1,257 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SpatiumPortae/portal/internal/conn"
+	"github.com/SpatiumPortae/portal/internal/throttle"
+	"github.com/SpatiumPortae/portal/protocol/rendezvous"
+	"github.com/SpatiumPortae/portal/protocol/transfer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+)
+
+// mockConn is one end of an in-memory connection.
+type mockConn struct {
+	in  chan []byte
+	out chan []byte
+}
+
+func (m mockConn) Write(ctx context.Context, b []byte) error {
+	m.out <- b
+	return nil
+}
+
+func (m mockConn) Read(ctx context.Context) ([]byte, error) {
+	return <-m.in, nil
+}
+
+// transferPipe returns both ends of an in-memory transfer connection.
+func transferPipe(t *testing.T) (conn.Transfer, conn.Transfer) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	a, b := make(chan []byte, 100), make(chan []byte, 100)
+	return conn.TransferFromKey(mockConn{in: a, out: b}, key), conn.TransferFromKey(mockConn{in: b, out: a}, key)
+}
+
+// onlyReader hides all methods of the wrapped reader except Read.
+type onlyReader struct{ io.Reader }
+
+func newPayload(t *testing.T, size int) []byte {
+	payload := make([]byte, size)
+	_, err := rand.Read(payload)
+	require.NoError(t, err)
+	return payload
+}
+
+// receive requests the payload from the provided offset and reads it from the connection,
+// returning the received bytes and the announced checksum.
+func receive(t *testing.T, ctx context.Context, tc conn.Transfer, offset int64) ([]byte, []byte) {
+	require.NoError(t, tc.WriteMsg(ctx, transfer.Msg{
+		Type:    transfer.ReceiverRequestPayload,
+		Payload: transfer.Payload{Offset: offset},
+	}))
+	var received []byte
+	for {
+		b, err := tc.ReadRaw(ctx)
+		require.NoError(t, err)
+		var msg transfer.Msg
+		if err := json.Unmarshal(b, &msg); err == nil && msg.Type == transfer.SenderPayloadSent {
+			return received, msg.Payload.Checksum
+		}
+		received = append(received, b...)
+	}
+}
+
+func TestSeekPayload(t *testing.T) {
+	payload := newPayload(t, 1000)
+	tests := []struct {
+		name    string
+		payload io.Reader
+		offset  int64
+		err     bool
+	}{
+		{name: "start of seekable payload", payload: bytes.NewReader(payload), offset: 0},
+		{name: "offset in seekable payload", payload: bytes.NewReader(payload), offset: 400},
+		{name: "end of seekable payload", payload: bytes.NewReader(payload), offset: 1000},
+		{name: "start of non-seekable payload", payload: onlyReader{bytes.NewReader(payload)}, offset: 0},
+		{name: "offset in non-seekable payload", payload: onlyReader{bytes.NewReader(payload)}, offset: 400, err: true},
+		{name: "negative offset", payload: bytes.NewReader(payload), offset: -1, err: true},
+		{name: "offset beyond payload", payload: bytes.NewReader(payload), offset: 1001, err: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			checksum := transfer.NewChecksum()
+			err := seekPayload(tc.payload, tc.offset, int64(len(payload)), checksum)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			rest, err := io.ReadAll(tc.payload)
+			require.NoError(t, err)
+			assert.Equal(t, payload[tc.offset:], rest)
+
+			// The skipped prefix is part of the checksum.
+			prefix := sha256.Sum256(payload[:tc.offset])
+			assert.Equal(t, prefix[:], checksum.Sum(nil))
+		})
+	}
+}
+
+func TestTransferSequence(t *testing.T) {
+	payload := newPayload(t, 3*MAX_CHUNK_BYTES+1234)
+	oracle := sha256.Sum256(payload)
+	for _, offset := range []int64{0, MAX_CHUNK_BYTES + 17, int64(len(payload))} {
+		t.Run(fmt.Sprintf("offset %d", offset), func(t *testing.T) {
+			ctx := context.Background()
+			senderTc, receiverTc := transferPipe(t)
+			errC := make(chan error, 1)
+			go func() {
+				errC <- transferSequence(ctx, senderTc, bytes.NewReader(payload), int64(len(payload)))
+			}()
+
+			received, checksum := receive(t, ctx, receiverTc, offset)
+			assert.True(t, bytes.Equal(payload[offset:], received), "received payload differs")
+			assert.Equal(t, oracle[:], checksum)
+
+			require.NoError(t, receiverTc.WriteMsg(ctx, transfer.Msg{Type: transfer.ReceiverPayloadAck}))
+			_, err := receiverTc.ReadMsg(ctx, transfer.SenderClosing)
+			require.NoError(t, err)
+			assert.NoError(t, <-errC)
+		})
+	}
+}
+
+func TestTransferPayloadThrottled(t *testing.T) {
+	payload := newPayload(t, 2*throttle.MIN_BURST)
+	ctx := throttle.WithLimit(context.Background(), throttle.MIN_BURST)
+	senderTc, receiverTc := transferPipe(t)
+
+	start := time.Now()
+	require.NoError(t, transferPayload(ctx, senderTc, bytes.NewReader(payload), io.Discard, int64(len(payload)), 0))
+	// The first burst is sent at once, the rest after a second.
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+
+	received, err := receiverTc.ReadRaw(ctx)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(payload, received), "received payload differs")
+}
+
+func TestTransferSequenceChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	payload := newPayload(t, 1000)
+	senderTc, receiverTc := transferPipe(t)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- transferSequence(ctx, senderTc, bytes.NewReader(payload), int64(len(payload)))
+	}()
+	receive(t, ctx, receiverTc, 0)
+	require.NoError(t, receiverTc.WriteMsg(ctx, transfer.Msg{Type: transfer.ReceiverChecksumMismatch}))
+	assert.ErrorIs(t, <-errC, ErrChecksumRejected)
+}
+
+func TestTransferSequenceRejected(t *testing.T) {
+	ctx := context.Background()
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	reason := "the transfer exceeds the maximum size of relayed transfers, try again with a direct connection"
+
+	// The relay requests the payload on behalf of the receiver, and terminates the connection after the first chunk,
+	// which is torn down after a grace period as done by the rendezvous server.
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.CloseNow()
+		tc := conn.TransferFromKey(&conn.WS{Conn: ws}, key)
+		if err := tc.WriteMsg(r.Context(), transfer.Msg{Type: transfer.ReceiverRequestPayload}); err != nil {
+			return
+		}
+		if _, err := tc.ReadRaw(r.Context()); err != nil {
+			return
+		}
+		rc := conn.Rendezvous{Conn: &conn.WS{Conn: ws}}
+		_ = rc.WriteMsg(r.Context(), rendezvous.Msg{
+			Type:    rendezvous.RendezvousToClientError,
+			Payload: rendezvous.Payload{Error: reason},
+		})
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer relay.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	ws, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(relay.URL, "http"), nil)
+	require.NoError(t, err)
+	defer ws.CloseNow()
+	tc := conn.TransferFromKey(&conn.WS{Conn: ws}, key)
+
+	// The sender is only writing when the connection is terminated, but still learns why.
+	payload := newPayload(t, 50*MAX_CHUNK_BYTES)
+	err = transferSequence(ctx, tc, bytes.NewReader(payload), int64(len(payload)))
+	assert.ErrorIs(t, err, rendezvous.RejectedError{Reason: reason})
+}
+
+func TestServerResume(t *testing.T) {
+	ctx := context.Background()
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	payload := newPayload(t, 3*MAX_CHUNK_BYTES)
+	oracle := sha256.Sum256(payload)
+
+	port, err := getOpenPort()
+	require.NoError(t, err)
+	s := newServer(port, key, bytes.NewReader(payload), int64(len(payload)))
+	done := make(chan error, 1)
+	go func() { done <- s.Start() }()
+
+	dial := func() conn.Transfer {
+		var ws *websocket.Conn
+		require.Eventually(t, func() bool {
+			ws, _, err = websocket.Dial(ctx, fmt.Sprintf("ws://127.0.0.1:%d/portal", port), nil)
+			return err == nil
+		}, 5*time.Second, 50*time.Millisecond)
+		return conn.TransferFromKey(&conn.WS{Conn: ws}, key)
+	}
+
+	// Receive the first chunk, and then lose the connection.
+	tc := dial()
+	require.NoError(t, tc.WriteMsg(ctx, transfer.Msg{Type: transfer.ReceiverRequestPayload}))
+	first, err := tc.ReadRaw(ctx)
+	require.NoError(t, err)
+	tc.Conn.(*conn.WS).Conn.Close(websocket.StatusGoingAway, "")
+
+	// Reconnect and resume from the received offset.
+	tc = dial()
+	rest, checksum := receive(t, ctx, tc, int64(len(first)))
+	assert.Equal(t, payload, append(first, rest...))
+	assert.Equal(t, oracle[:], checksum)
+	require.NoError(t, tc.WriteMsg(ctx, transfer.Msg{Type: transfer.ReceiverPayloadAck}))
+	_, err = tc.ReadMsg(ctx, transfer.SenderClosing)
+	require.NoError(t, err)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+		assert.NoError(t, s.Err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down after the resumed transfer")
+	}
+}
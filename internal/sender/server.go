@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/SpatiumPortae/portal/internal/conn"
+	"github.com/SpatiumPortae/portal/protocol/transfer"
 	"nhooyr.io/websocket"
 )
 
@@ -24,6 +25,9 @@ type server struct {
 	Err      error
 	shutdown chan os.Signal
 	once     sync.Once
+
+	mu          sync.Mutex
+	resumeTimer *time.Timer
 }
 
 // newServer creates a new server running on the provided port.
@@ -71,22 +75,43 @@ func (s *server) Shutdown() {
 	})
 }
 
+// awaitResume gives the receiver transfer.RESUME_TIMEOUT to reconnect and resume the transfer,
+// after which the server is shutdown.
+func (s *server) awaitResume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resumeTimer = time.AfterFunc(transfer.RESUME_TIMEOUT, s.Shutdown)
+}
+
+// resume stops any pending shutdown scheduled by awaitResume.
+func (s *server) resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resumeTimer != nil {
+		s.resumeTimer.Stop()
+		s.resumeTimer = nil
+	}
+}
+
 // handleTransfer returns a HTTP handler that performs the transfer sequence.
-// Will shutdown the server on termination.
+// Will shutdown the server on successful termination. If the transfer fails, the
+// server keeps running for a while so that the receiver can reconnect and resume.
 func (s *server) handleTransfer(key []byte, payload io.Reader, payloadSize int64, msgs ...chan interface{}) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			s.Shutdown()
-		}()
+		s.resume()
 		ws, err := websocket.Accept(w, r, nil)
 		if err != nil {
 			s.Err = err
+			s.Shutdown()
 			return
 		}
 		tc := conn.TransferFromKey(&conn.WS{Conn: ws}, key)
-		if err != transferSequence(context.Background(), tc, payload, payloadSize, msgs...) {
+		if err := transferSequence(context.Background(), tc, payload, payloadSize, msgs...); err != nil {
 			s.Err = err
+			s.awaitResume()
 			return
 		}
+		s.Err = nil
+		s.Shutdown()
 	}
 }
@@ -19,12 +19,21 @@ func doTransfer(ctx context.Context, tc conn.Transfer, payload io.Reader, payloa
 		return err
 	}
 
+	_, isStreamed := payload.(StreamedPayload)
+	var payloadType transfer.PayloadType
+	var payloadName string
+	if typed, ok := payload.(TypedPayload); ok {
+		payloadType, payloadName = typed.PayloadType(), typed.PayloadName()
+	}
 	if err := tc.WriteMsg(ctx, transfer.Msg{
 		Type: transfer.SenderHandshake,
 		Payload: transfer.Payload{
-			IP:          net.IP{},
-			Port:        80,
-			PayloadSize: payloadSize,
+			IP:                   net.IP{},
+			Port:                 80,
+			PayloadSize:          payloadSize,
+			PayloadSizeEstimated: isStreamed,
+			PayloadType:          payloadType,
+			PayloadName:          payloadName,
 		},
 	}); err != nil {
 		return err
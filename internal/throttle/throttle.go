@@ -0,0 +1,66 @@
+// Package throttle limits the rate at which bytes are transferred.
+package throttle
+
+import (
+	"context"
+	"math"
+
+	"golang.org/x/time/rate"
+)
+
+// MIN_BURST is the minimum amount of bytes that a throttled transfer can transfer at once.
+const MIN_BURST = 64 << 10
+
+// New returns a token bucket limiting the transferred bytes to the provided amount of bytes per second,
+// or nil without a limit.
+func New(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	burst := bytesPerSecond
+	if burst < MIN_BURST {
+		burst = MIN_BURST
+	}
+	if burst > math.MaxInt32 {
+		burst = math.MaxInt32
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(burst))
+}
+
+// WaitN waits until the provided limiter allows transferring the provided amount of bytes, in chunks of its burst.
+// Returns immediately if the limiter is nil.
+func WaitN(ctx context.Context, l *rate.Limiter, n int) error {
+	if l == nil {
+		return nil
+	}
+	for n > 0 {
+		chunk := n
+		if chunk > l.Burst() {
+			chunk = l.Burst()
+		}
+		if err := l.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+type limiterKey struct{}
+
+// WithLimit returns a copy of the provided context that limits the bytes transferred using it to the provided
+// amount of bytes per second. The limit is shared by all transfers using the context.
+func WithLimit(ctx context.Context, bytesPerSecond int64) context.Context {
+	l := New(bytesPerSecond)
+	if l == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, limiterKey{}, l)
+}
+
+// Wait waits until the limit of the provided context allows transferring the provided amount of bytes.
+// Returns immediately if the context has no limit.
+func Wait(ctx context.Context, n int) error {
+	l, _ := ctx.Value(limiterKey{}).(*rate.Limiter)
+	return WaitN(ctx, l, n)
+}
@@ -0,0 +1,34 @@
+package throttle_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SpatiumPortae/portal/internal/throttle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWait(t *testing.T) {
+	t.Run("without limit", func(t *testing.T) {
+		ctx := throttle.WithLimit(context.Background(), 0)
+		start := time.Now()
+		require.NoError(t, throttle.Wait(ctx, 100*throttle.MIN_BURST))
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("with limit", func(t *testing.T) {
+		ctx := throttle.WithLimit(context.Background(), throttle.MIN_BURST)
+		start := time.Now()
+		// The first burst is allowed at once, the second one after a second.
+		require.NoError(t, throttle.Wait(ctx, 2*throttle.MIN_BURST))
+		assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(throttle.WithLimit(context.Background(), throttle.MIN_BURST))
+		cancel()
+		assert.Error(t, throttle.Wait(ctx, 2*throttle.MIN_BURST))
+	})
+}
@@ -5,11 +5,14 @@ import (
 	"strings"
 )
 
+// MAX_RECEIVERS is the maximum amount of receivers that a sender can send to using a single password.
+const MAX_RECEIVERS = 10
+
 type MsgType int
 
 const (
 	RendezvousToSenderBind        MsgType = iota // An ID for this connection is bound and communicated
-	SenderToRendezvousEstablish                  // Sender has generated and hashed password
+	SenderToRendezvousEstablish                  // Sender has generated and hashed password, along with the amount of receivers
 	ReceiverToRendezvousEstablish                // Passsword has been communicated to receiver who has hashed it
 	RendezvousToSenderReady                      // Rendezvous announces to sender that receiver is connected
 	SenderToRendezvousPAKE                       // Sender sends PAKE information to rendezvous
@@ -21,6 +24,15 @@ const (
 	// From this point there is a safe channel established
 	ReceiverToRendezvousClose // Receiver can connect directly to sender, close receiver connection -> close sender connection
 	SenderToRendezvousClose   // Transit sequence is completed, close sender connection -> close receiver connection
+
+	SenderToRendezvousJoin // Sender joins an established password on an additional connection, in order to send to another receiver
+
+	ReceiverToRendezvousListen // Receiver requests an ID in order to generate the password, and listen for a sender
+	RendezvousToReceiverBind   // An ID for the listening receiver is bound and communicated
+
+	RendezvousToClientError // Rendezvous rejects the connection of a client, and communicates the reason
+
+	RendezvousToSenderInvalidated // Rendezvous invalidates the password of the sender after too many failed receiver attempts
 )
 
 type Msg struct {
@@ -29,10 +41,12 @@ type Msg struct {
 }
 
 type Payload struct {
-	ID       int    `json:"id,omitempty"`
-	Password string `json:"password,omitempty"`
-	Bytes    []byte `json:"pake_bytes,omitempty"`
-	Salt     []byte `json:"salt,omitempty"`
+	ID        int    `json:"id,omitempty"`
+	Password  string `json:"password,omitempty"`
+	Receivers int    `json:"receivers,omitempty"`
+	Bytes     []byte `json:"pake_bytes,omitempty"`
+	Salt      []byte `json:"salt,omitempty"`
+	Error     string `json:"error,omitempty"`
 }
 
 type Error struct {
@@ -49,6 +63,15 @@ func (e Error) Error() string {
 	return fmt.Sprintf("wrong message type, expected one of: (%s), got: (%s)", oneOfExpected, e.Got.Name())
 }
 
+// RejectedError is returned when the rendezvous server rejects the connection of a client.
+type RejectedError struct {
+	Reason string
+}
+
+func (e RejectedError) Error() string {
+	return fmt.Sprintf("rejected by relay: %s", e.Reason)
+}
+
 func (t MsgType) Name() string {
 	switch t {
 	case RendezvousToSenderBind:
@@ -75,6 +98,16 @@ func (t MsgType) Name() string {
 		return "ReceiverToRendezvousClose"
 	case SenderToRendezvousClose:
 		return "SenderToRendezvousClose"
+	case SenderToRendezvousJoin:
+		return "SenderToRendezvousJoin"
+	case ReceiverToRendezvousListen:
+		return "ReceiverToRendezvousListen"
+	case RendezvousToReceiverBind:
+		return "RendezvousToReceiverBind"
+	case RendezvousToClientError:
+		return "RendezvousToClientError"
+	case RendezvousToSenderInvalidated:
+		return "RendezvousToSenderInvalidated"
 	default:
 		return ""
 	}
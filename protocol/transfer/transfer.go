@@ -2,11 +2,18 @@
 package transfer
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"hash"
 	"net"
 	"strings"
+	"time"
 )
 
+// RESUME_TIMEOUT is the duration within which a receiver can reconnect to the sender
+// and resume a failed direct transfer.
+const RESUME_TIMEOUT = 30 * time.Second
+
 // MsgType specifies the message type for the messages in the transfer protocol.
 type MsgType int
 
@@ -18,11 +25,12 @@ const (
 	SenderDirectAck            // Sender ACKs the request for direct communication
 	ReceiverRelayCommunication // Receiver has tried to probe the sender but cannot find it on the subnet, relay communication will be used
 	SenderRelayAck             // Sender ACKs the request for relay communication
-	ReceiverRequestPayload     // Receiver request the payload from the sender
-	SenderPayloadSent          // Sender announces that the entire file has been transferred
+	ReceiverRequestPayload     // Receiver request the payload from the sender, optionally from an offset to resume a transfer
+	SenderPayloadSent          // Sender announces that the entire file has been transferred, along with the payload checksum
 	ReceiverPayloadAck         // Receiver ACKs that is has received the payload
 	SenderClosing              // Sender announces that it is closing the connection
 	ReceiverClosingAck         // Receiver ACKs the closing of the connection
+	ReceiverChecksumMismatch   // Receiver rejects the payload, as its checksum does not match the checksum announced by the sender
 )
 
 type Type int
@@ -33,6 +41,15 @@ const (
 	Relay
 )
 
+// PayloadType specifies how the receiver handles the payload.
+type PayloadType int
+
+const (
+	ArchivePayload PayloadType = iota // Compressed tar archive of files, unpacked by the receiver
+	TextPayload                       // Text, printed by the receiver
+	RawPayload                        // Raw bytes, such as data read from stdin, written to the named file or stdout by the receiver
+)
+
 // Msg specifies a message in the transfer protocol.
 type Msg struct {
 	Type    MsgType `json:"type"`
@@ -40,9 +57,19 @@ type Msg struct {
 }
 
 type Payload struct {
-	IP          net.IP `json:"ip,omitempty"`
-	Port        int    `json:"port,omitempty"`
-	PayloadSize int64  `json:"payload_size,omitempty"`
+	IP                   net.IP      `json:"ip,omitempty"`
+	Port                 int         `json:"port,omitempty"`
+	PayloadSize          int64       `json:"payload_size,omitempty"`
+	PayloadSizeEstimated bool        `json:"payload_size_estimated,omitempty"` // The payload is produced while being sent, its size is an estimate
+	PayloadType          PayloadType `json:"payload_type,omitempty"`
+	PayloadName          string      `json:"payload_name,omitempty"` // The file name that raw payloads are written to, or of the single file in an archive
+	Offset               int64       `json:"offset,omitempty"`
+	Checksum             []byte      `json:"checksum,omitempty"`
+}
+
+// NewChecksum returns the hash used to compute the checksum of the payload.
+func NewChecksum() hash.Hash {
+	return sha256.New()
 }
 
 func (t Msg) Bytes() []byte {
@@ -63,6 +90,17 @@ func (e Error) Error() string {
 	return fmt.Sprintf("wrong message type, expected one of: (%s), got: (%s)", oneOfExpected, e.Got.Name())
 }
 
+// ChecksumError is returned when the checksum of the received payload does not match
+// the checksum announced by the sender.
+type ChecksumError struct {
+	Expected []byte
+	Got      []byte
+}
+
+func (e ChecksumError) Error() string {
+	return fmt.Sprintf("payload checksum mismatch, expected: (%x), got: (%x)", e.Expected, e.Got)
+}
+
 func (t MsgType) Name() string {
 	switch t {
 	case TransferError:
@@ -85,6 +123,8 @@ func (t MsgType) Name() string {
 		return "SenderClosing"
 	case ReceiverClosingAck:
 		return "ReceiverClosingAck"
+	case ReceiverChecksumMismatch:
+		return "ReceiverChecksumMismatch"
 	default:
 		return ""
 	}